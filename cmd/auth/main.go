@@ -1,25 +1,70 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
+	"net/url"
 	"os"
 	"time"
 
 	"github.com/asim/go-micro/v3"
+	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/Mikhalevich/filesharing-auth-service/internal/audit"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/cache"
 	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/directory"
 	"github.com/Mikhalevich/filesharing-auth-service/internal/handler"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/health"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/mail"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/oauth"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/throttle"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/tracing"
+	apikeypb "github.com/Mikhalevich/filesharing-auth-service/pkg/proto/apikey"
+	auditpb "github.com/Mikhalevich/filesharing-auth-service/pkg/proto/audit"
+	devicepb "github.com/Mikhalevich/filesharing-auth-service/pkg/proto/device"
+	magiclinkpb "github.com/Mikhalevich/filesharing-auth-service/pkg/proto/magiclink"
+	serviceaccountpb "github.com/Mikhalevich/filesharing-auth-service/pkg/proto/serviceaccount"
+	sessionpb "github.com/Mikhalevich/filesharing-auth-service/pkg/proto/session"
 	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
 	"github.com/Mikhalevich/filesharing/pkg/proto/auth"
 	"github.com/Mikhalevich/filesharing/pkg/service"
-	"github.com/Mikhalevich/repeater"
 )
 
 type config struct {
 	service.Config       `yaml:"service"`
-	DB                   string `yaml:"db"`
-	TokenExpirePeriodSec int    `yaml:"token_expire_period"`
+	DB                   string           `yaml:"db"`
+	DBReplicas           []string         `yaml:"db_replicas"`
+	DBQueryTimeoutSec    int              `yaml:"db_query_timeout"`
+	DBMaxOpenConns       int              `yaml:"db_max_open_conns"`
+	DBMaxIdleConns       int              `yaml:"db_max_idle_conns"`
+	DBConnMaxLifetimeSec int              `yaml:"db_conn_max_lifetime"`
+	DBConnMaxIdleTimeSec int              `yaml:"db_conn_max_idle_time"`
+	DBCheckSchema        bool             `yaml:"db_check_schema"`
+	UserCacheSize        int              `yaml:"user_cache_size"`
+	UserCacheTTLSec      int              `yaml:"user_cache_ttl"`
+	TokenExpirePeriodSec int              `yaml:"token_expire_period"`
+	TokenAudience        string           `yaml:"token_audience"`
+	TokenClockSkewSec    int              `yaml:"token_clock_skew"`
+	APIKeyTokenTTLSec    int              `yaml:"api_key_token_ttl"`
+	ServiceTokenTTLSec   int              `yaml:"service_token_ttl"`
+	LoginMaxFailures     int              `yaml:"login_max_failures"`
+	LoginLockoutSec      int              `yaml:"login_lockout"`
+	AuditCheckpointSec   int              `yaml:"audit_checkpoint_interval"`
+	Tracing              tracing.Config   `yaml:"tracing"`
+	OAuth                oauth.Config     `yaml:"oauth"`
+	LDAP                 directory.Config `yaml:"ldap"`
+	SMTP                 mail.Config      `yaml:"smtp"`
+	MagicLink            magicLinkConfig  `yaml:"magic_link"`
+}
+
+type magicLinkConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// URL is the frontend page exchanging the link, token query parameter is added to it.
+	URL    string `yaml:"url"`
+	TTLSec int    `yaml:"ttl"`
 }
 
 func (c *config) Service() service.Config {
@@ -31,43 +76,300 @@ func (c *config) Validate() error {
 		return errors.New("db is required")
 	}
 
+	if c.DBQueryTimeoutSec < 0 {
+		return fmt.Errorf("invalid db_query_timeout: %d", c.DBQueryTimeoutSec)
+	}
+
+	if c.DBMaxOpenConns < 0 {
+		return fmt.Errorf("invalid db_max_open_conns: %d", c.DBMaxOpenConns)
+	}
+
+	if c.DBMaxIdleConns < 0 {
+		return fmt.Errorf("invalid db_max_idle_conns: %d", c.DBMaxIdleConns)
+	}
+
+	if c.DBConnMaxLifetimeSec < 0 {
+		return fmt.Errorf("invalid db_conn_max_lifetime: %d", c.DBConnMaxLifetimeSec)
+	}
+
+	if c.DBConnMaxIdleTimeSec < 0 {
+		return fmt.Errorf("invalid db_conn_max_idle_time: %d", c.DBConnMaxIdleTimeSec)
+	}
+
+	if c.UserCacheSize < 0 {
+		return fmt.Errorf("invalid user_cache_size: %d", c.UserCacheSize)
+	}
+
+	if c.UserCacheSize > 0 && c.UserCacheTTLSec <= 0 {
+		return fmt.Errorf("invalid user_cache_ttl: %d", c.UserCacheTTLSec)
+	}
+
 	if c.TokenExpirePeriodSec <= 0 {
 		return fmt.Errorf("invalid token_expire_period: %d", c.TokenExpirePeriodSec)
 	}
 
+	if c.APIKeyTokenTTLSec < 0 {
+		return fmt.Errorf("invalid api_key_token_ttl: %d", c.APIKeyTokenTTLSec)
+	}
+
+	if c.TokenClockSkewSec < 0 || time.Duration(c.TokenClockSkewSec)*time.Second > token.MaxClockSkew {
+		return fmt.Errorf("invalid token_clock_skew: %d", c.TokenClockSkewSec)
+	}
+
+	if c.ServiceTokenTTLSec < 0 {
+		return fmt.Errorf("invalid service_token_ttl: %d", c.ServiceTokenTTLSec)
+	}
+
+	if c.LoginMaxFailures < 0 {
+		return fmt.Errorf("invalid login_max_failures: %d", c.LoginMaxFailures)
+	}
+
+	if c.LoginLockoutSec < 0 {
+		return fmt.Errorf("invalid login_lockout: %d", c.LoginLockoutSec)
+	}
+
+	if c.AuditCheckpointSec < 0 {
+		return fmt.Errorf("invalid audit_checkpoint_interval: %d", c.AuditCheckpointSec)
+	}
+
+	if c.OAuth.Enabled && c.OAuth.RegistrationToken == "" {
+		return errors.New("oauth registration_token is required")
+	}
+
+	if c.OAuth.Enabled && c.OAuth.Issuer == "" {
+		return errors.New("oauth issuer is required")
+	}
+
+	if c.LDAP.TimeoutSec < 0 {
+		return fmt.Errorf("invalid ldap timeout: %d", c.LDAP.TimeoutSec)
+	}
+
+	if c.OAuth.CodeTTLSec < 0 {
+		return fmt.Errorf("invalid oauth code_ttl: %d", c.OAuth.CodeTTLSec)
+	}
+
+	if c.MagicLink.Enabled {
+		if u, err := url.Parse(c.MagicLink.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid magic_link url: %q", c.MagicLink.URL)
+		}
+
+		if c.SMTP.Addr == "" {
+			return errors.New("smtp addr is required for magic_link")
+		}
+	}
+
+	if c.MagicLink.TTLSec < 0 {
+		return fmt.Errorf("invalid magic_link ttl: %d", c.MagicLink.TTLSec)
+	}
+
+	if c.OAuth.DeviceCodeTTLSec < 0 {
+		return fmt.Errorf("invalid oauth device_code_ttl: %d", c.OAuth.DeviceCodeTTLSec)
+	}
+
+	if c.OAuth.DevicePollIntervalSec < 0 {
+		return fmt.Errorf("invalid oauth device_poll_interval: %d", c.OAuth.DevicePollIntervalSec)
+	}
+
 	return nil
 }
 
+const healthCheckInterval = time.Second * 10
+
 func main() {
+	var command string
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	var err error
+	switch command {
+	case "migrate":
+		err = runMigrate(os.Args[2:])
+	case "verify-audit":
+		err = runVerifyAudit(os.Args[2:])
+	case "service-account":
+		err = runServiceAccount(os.Args[2:])
+	default:
+		runService()
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runService() {
 	var cfg config
 	service.Run(os.Getenv("FS_SERVICE_NAME"), &cfg, func(srv micro.Service, s service.Servicer) error {
-		var storage *db.Postgres
-		if err := repeater.Do(
-			func() error {
-				var err error
-				storage, err = db.NewPostgres(cfg.DB)
-				return err
-			},
-			repeater.WithTimeout(time.Second*1),
-			repeater.WithLogger(s.Logger()),
-			repeater.WithLogMessage("try to connect to database"),
-		); err != nil {
-			return fmt.Errorf("unable to connect to database: %w", err)
+		exporter, err := tracing.NewExporter(cfg.Tracing)
+		if err != nil {
+			return fmt.Errorf("unable to create tracing exporter: %w", err)
+		}
+
+		if exporter != nil {
+			tracing.SetExporter(exporter)
+			s.AddOption(service.WithPostAction(func() {
+				tracing.SetExporter(nil)
+				exporter.Close()
+			}))
+		}
+
+		srv.Init(micro.WrapHandler(tracing.HandlerWrapper()))
+
+		storage, err := newStorage(&cfg, s.Logger())
+		if err != nil {
+			return err
 		}
 
 		s.AddOption(service.WithPostAction(func() {
 			storage.Close()
 		}))
 
-		rsaEncoder, err := token.NewRSAEncoder(time.Duration(cfg.TokenExpirePeriodSec) * time.Second)
+		if m, ok := storage.(migrator); ok {
+			if err := m.Migrate(context.Background(), db.MigrateUp); err != nil {
+				return fmt.Errorf("unable to apply migrations: %w", err)
+			}
+
+			if cfg.DBCheckSchema {
+				if err := m.CheckSchema(context.Background()); err != nil {
+					return fmt.Errorf("check schema error: %w", err)
+				}
+			}
+		}
+
+		if c, ok := storage.(statsCollector); ok {
+			if err := prometheus.Register(c.StatsCollector()); err != nil {
+				return fmt.Errorf("unable to register db stats collector: %w", err)
+			}
+		}
+
+		// the only handle given to handlers, so every user write goes through the cache
+		var repo storager = storage
+		if cfg.UserCacheSize > 0 {
+			repo = withUsers(storage, cache.NewStorage(storage, cache.NewGoCache(cfg.UserCacheSize, time.Duration(cfg.UserCacheTTLSec)*time.Second)))
+		}
+
+		rsaEncoder, err := token.NewRSAEncoder(time.Duration(cfg.TokenExpirePeriodSec)*time.Second, token.WithDefaultAudience(cfg.TokenAudience))
 		if err != nil {
 			return fmt.Errorf("unable to create auth encoded: %w", err)
 		}
 
-		if err := auth.RegisterAuthServiceHandler(srv.Server(), handler.New(storage, rsaEncoder)); err != nil {
+		checker := health.NewChecker(s.Logger(), healthCheckInterval)
+		if p, ok := storage.(pinger); ok {
+			checker.Add("database", p.Ping)
+		}
+		if m, ok := storage.(migrator); ok {
+			checker.Add("migrations", m.CheckMigrations)
+		}
+		checker.Add("signing_keys", func(ctx context.Context) error {
+			_, err := rsaEncoder.Encode(token.User{})
+			return err
+		})
+		checker.Start()
+		s.AddOption(service.WithPostAction(checker.Stop))
+
+		s.Router().Path("/healthz").Handler(health.LiveHandler())
+		s.Router().Path("/readyz").Handler(checker.ReadyHandler())
+
+		if cfg.AuditCheckpointSec > 0 {
+			checkpointer := audit.NewCheckpointer(s.Logger(), storage, rsaEncoder, time.Duration(cfg.AuditCheckpointSec)*time.Second)
+			if err := checkpointer.Start(context.Background()); err != nil {
+				return fmt.Errorf("unable to start audit checkpointer: %w", err)
+			}
+			s.AddOption(service.WithPostAction(checkpointer.Stop))
+		}
+
+		rsaDecoder, err := token.NewRSADecoder(token.WithRequiredIssuer(token.Issuer), token.WithClockSkew(time.Duration(cfg.TokenClockSkewSec)*time.Second))
+		if err != nil {
+			return fmt.Errorf("unable to create auth decoder: %w", err)
+		}
+
+		lockout := throttle.DefaultWindow
+		if cfg.LoginLockoutSec > 0 {
+			lockout = time.Duration(cfg.LoginLockoutSec) * time.Second
+		}
+		// zero login_max_failures disables the lockout
+		loginThrottle := throttle.NewLimiter(cfg.LoginMaxFailures, lockout)
+
+		handlerOpts := []handler.Option{
+			handler.WithDefaultAudience(cfg.TokenAudience),
+			handler.WithLoginThrottle(loginThrottle),
+		}
+		if cfg.OAuth.Enabled {
+			handlerOpts = append(handlerOpts, handler.WithDeviceAuth(
+				cfg.OAuth.DeviceVerificationURI(),
+				time.Duration(cfg.OAuth.DeviceCodeTTLSec)*time.Second,
+				time.Duration(cfg.OAuth.DevicePollIntervalSec)*time.Second,
+			))
+		}
+
+		if cfg.APIKeyTokenTTLSec > 0 {
+			handlerOpts = append(handlerOpts, handler.WithAPIKeyTokenTTL(time.Duration(cfg.APIKeyTokenTTLSec)*time.Second))
+		}
+
+		if cfg.ServiceTokenTTLSec > 0 {
+			handlerOpts = append(handlerOpts, handler.WithServiceTokenTTL(time.Duration(cfg.ServiceTokenTTLSec)*time.Second))
+		}
+
+		if cfg.LDAP.Enabled {
+			ldap, err := directory.NewLDAP(cfg.LDAP)
+			if err != nil {
+				return fmt.Errorf("unable to configure ldap: %w", err)
+			}
+			handlerOpts = append(handlerOpts, handler.WithDirectory(ldap))
+		}
+
+		if cfg.MagicLink.Enabled {
+			mailer, err := mail.NewSMTP(cfg.SMTP)
+			if err != nil {
+				return fmt.Errorf("unable to configure smtp: %w", err)
+			}
+			handlerOpts = append(handlerOpts, handler.WithMagicLink(s.Logger(), mailer, cfg.MagicLink.URL, time.Duration(cfg.MagicLink.TTLSec)*time.Second, rsaEncoder, rsaDecoder))
+		}
+
+		h := handler.New(repo, repo, rsaEncoder, rsaDecoder, handlerOpts...)
+
+		if cfg.OAuth.Enabled {
+			// server pages authenticate users by the handler, so directory users can approve clients and devices
+			oauthServer, err := oauth.NewServer(s.Logger(), cfg.OAuth, repo, repo, rsaEncoder, rsaDecoder, time.Duration(cfg.TokenExpirePeriodSec)*time.Second,
+				oauth.WithLoginThrottle(loginThrottle),
+				oauth.WithAuthenticator(h),
+			)
+			if err != nil {
+				return fmt.Errorf("unable to create oauth server: %w", err)
+			}
+			s.Router().PathPrefix("/oauth/").Handler(oauthServer.Handler())
+			s.Router().Path(oauth.DiscoveryPath).Handler(oauthServer.Handler())
+		}
+
+		if err := auth.RegisterAuthServiceHandler(srv.Server(), h); err != nil {
 			return fmt.Errorf("unable register auth handler: %v", err)
 		}
 
+		if err := auditpb.RegisterAuditServiceHandler(srv.Server(), h); err != nil {
+			return fmt.Errorf("unable register audit handler: %v", err)
+		}
+
+		if err := sessionpb.RegisterSessionServiceHandler(srv.Server(), h); err != nil {
+			return fmt.Errorf("unable register session handler: %v", err)
+		}
+
+		if err := apikeypb.RegisterAPIKeyServiceHandler(srv.Server(), h); err != nil {
+			return fmt.Errorf("unable register api key handler: %v", err)
+		}
+
+		if err := devicepb.RegisterDeviceServiceHandler(srv.Server(), h); err != nil {
+			return fmt.Errorf("unable register device handler: %v", err)
+		}
+
+		if err := magiclinkpb.RegisterMagicLinkServiceHandler(srv.Server(), h); err != nil {
+			return fmt.Errorf("unable register magic link handler: %v", err)
+		}
+
+		if err := serviceaccountpb.RegisterServiceAccountServiceHandler(srv.Server(), h); err != nil {
+			return fmt.Errorf("unable register service account handler: %v", err)
+		}
+
 		return nil
 	})
 }
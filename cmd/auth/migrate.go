@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+)
+
+type stdLogger struct{}
+
+func (stdLogger) Infof(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
+
+func loadConfig(cfg *config, path string) error {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read file error: %w", err)
+	}
+
+	if err := yaml.Unmarshal(buf, cfg); err != nil {
+		return fmt.Errorf("unmarshal yml error: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("validate error: %w", err)
+	}
+
+	return nil
+}
+
+// runMigrate implements "migrate up|down|status" command.
+func runMigrate(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s migrate %s|%s|%s", os.Args[0], db.MigrateUp, db.MigrateDown, db.MigrateStatus)
+	}
+
+	var cfg config
+	if err := loadConfig(&cfg, os.Getenv("FS_CONFIG_FILE")); err != nil {
+		return fmt.Errorf("load config error: %w", err)
+	}
+
+	storage, err := newStorage(&cfg, stdLogger{})
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	return migrate(context.Background(), storage, args[0])
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/serviceaccount"
+)
+
+// runServiceAccount implements "service-account create|list|delete" command.
+func runServiceAccount(args []string) error {
+	usage := fmt.Errorf("usage: %s service-account create -name NAME -scopes SCOPES [-public-key FILE] | list | delete ID", os.Args[0])
+	if len(args) == 0 {
+		return usage
+	}
+
+	var cfg config
+	if err := loadConfig(&cfg, os.Getenv("FS_CONFIG_FILE")); err != nil {
+		return fmt.Errorf("load config error: %w", err)
+	}
+
+	storage, err := newStorage(&cfg, stdLogger{})
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "create":
+		return createServiceAccount(ctx, storage, args[1:])
+	case "list":
+		return listServiceAccounts(ctx, storage)
+	case "delete":
+		if len(args) != 2 {
+			return usage
+		}
+		return deleteServiceAccount(ctx, storage, args[1])
+	}
+
+	return usage
+}
+
+func createServiceAccount(ctx context.Context, storage storager, args []string) error {
+	fs := flag.NewFlagSet("service-account create", flag.ContinueOnError)
+	name := fs.String("name", "", "account name")
+	scopes := fs.String("scopes", "", "space separated scopes the account can request")
+	publicKeyFile := fs.String("public-key", "", "PEM encoded RSA public key verifying assertions, secret is generated if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var publicKey string
+	if *publicKeyFile != "" {
+		buf, err := os.ReadFile(*publicKeyFile)
+		if err != nil {
+			return fmt.Errorf("read public key error: %w", err)
+		}
+		publicKey = string(buf)
+	}
+
+	account, secret, err := serviceaccount.New(*name, strings.Fields(*scopes), publicKey)
+	if err != nil {
+		return err
+	}
+
+	if err := storage.CreateServiceAccount(ctx, account); err != nil {
+		if errors.Is(err, db.ErrAlreadyExist) {
+			return fmt.Errorf("service account %q already exists", account.Name)
+		}
+		return fmt.Errorf("create service account error: %w", err)
+	}
+
+	if err := storage.AddAuditEvent(ctx, &db.AuditEvent{
+		Type:    db.AuditServiceAccountCreate,
+		Details: "service account " + account.ID + " " + account.Name + ": " + strings.Join(account.Scopes, " "),
+	}); err != nil {
+		return fmt.Errorf("audit error: %w", err)
+	}
+
+	fmt.Printf("client_id: %s\n", account.ID)
+	if secret != "" {
+		// the secret is not stored, it can't be shown again
+		fmt.Printf("client_secret: %s\n", secret)
+	}
+	return nil
+}
+
+func listServiceAccounts(ctx context.Context, storage storager) error {
+	accounts, err := storage.ListServiceAccounts(ctx)
+	if err != nil {
+		return fmt.Errorf("list service accounts error: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tAUTH\tSCOPES\tCREATED")
+	for _, a := range accounts {
+		auth := "secret"
+		if a.PublicKey != "" {
+			auth = "private_key_jwt"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", a.ID, a.Name, auth, strings.Join(a.Scopes, " "), a.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+	return w.Flush()
+}
+
+func deleteServiceAccount(ctx context.Context, storage storager, id string) error {
+	if err := storage.DeleteServiceAccount(ctx, id); err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			return fmt.Errorf("service account %s not exists", id)
+		}
+		return fmt.Errorf("delete service account error: %w", err)
+	}
+
+	if err := storage.AddAuditEvent(ctx, &db.AuditEvent{
+		Type:    db.AuditServiceAccountDelete,
+		Details: "service account " + id,
+	}); err != nil {
+		return fmt.Errorf("audit error: %w", err)
+	}
+
+	fmt.Printf("service account %s deleted\n", id)
+	return nil
+}
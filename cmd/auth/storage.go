@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/repeater"
+)
+
+type userStorager interface {
+	GetByID(ctx context.Context, id int64) (*db.User, error)
+	GetByName(ctx context.Context, name string) (*db.User, error)
+	GetByEmail(ctx context.Context, email string) (*db.User, error)
+	Create(ctx context.Context, u *db.User) error
+	GetPublicUsers(ctx context.Context) ([]*db.User, error)
+	Close() error
+}
+
+type storager interface {
+	userStorager
+	AddAuditEvent(ctx context.Context, e *db.AuditEvent) error
+	ListAuditEvents(ctx context.Context, f db.AuditFilter) ([]*db.AuditEvent, error)
+	WalkAuditEvents(ctx context.Context, fn func(e *db.AuditEvent) error) error
+	ListAuditChainHeads(ctx context.Context, afterID int64) ([]*db.AuditEvent, error)
+	AddAuditCheckpoint(ctx context.Context, c *db.AuditCheckpoint) error
+	ListAuditCheckpoints(ctx context.Context) ([]*db.AuditCheckpoint, error)
+	CreateSession(ctx context.Context, s *db.Session) error
+	GetSession(ctx context.Context, id string) (*db.Session, error)
+	ListSessions(ctx context.Context, userID int64) ([]*db.Session, error)
+	TouchSession(ctx context.Context, id string) error
+	RevokeSession(ctx context.Context, userID int64, id string) error
+	RevokeOtherSessions(ctx context.Context, userID int64, exceptID string) ([]string, error)
+	CreateOAuthClient(ctx context.Context, c *db.OAuthClient) error
+	GetOAuthClient(ctx context.Context, id string) (*db.OAuthClient, error)
+	CreateOAuthCode(ctx context.Context, c *db.OAuthCode) error
+	ConsumeOAuthCode(ctx context.Context, codeHash string) (*db.OAuthCode, error)
+	SaveOAuthGrant(ctx context.Context, g *db.OAuthGrant) error
+	CreateIdentity(ctx context.Context, i *db.Identity) error
+	GetIdentity(ctx context.Context, provider string, subject string) (*db.Identity, error)
+	TouchIdentity(ctx context.Context, provider string, subject string) error
+	CreateAPIKey(ctx context.Context, k *db.APIKey) error
+	GetAPIKey(ctx context.Context, id string) (*db.APIKey, error)
+	ListAPIKeys(ctx context.Context, userID int64) ([]*db.APIKey, error)
+	TouchAPIKey(ctx context.Context, id string) error
+	RevokeAPIKey(ctx context.Context, userID int64, id string) error
+	CreateDeviceCode(ctx context.Context, c *db.DeviceCode) error
+	GetDeviceCode(ctx context.Context, codeHash string) (*db.DeviceCode, error)
+	GetDeviceCodeByUserCode(ctx context.Context, userCode string) (*db.DeviceCode, error)
+	DecideDeviceCode(ctx context.Context, userCode string, userID int64, status string) error
+	TouchDeviceCode(ctx context.Context, codeHash string, interval time.Duration) error
+	ConsumeDeviceCode(ctx context.Context, codeHash string) (*db.DeviceCode, error)
+	CreateMagicLink(ctx context.Context, l *db.MagicLink, limit int, window time.Duration) error
+	ConsumeMagicLink(ctx context.Context, tokenHash string) (*db.MagicLink, error)
+	CreateServiceAccount(ctx context.Context, a *db.ServiceAccount) error
+	GetServiceAccount(ctx context.Context, id string) (*db.ServiceAccount, error)
+	ListServiceAccounts(ctx context.Context) ([]*db.ServiceAccount, error)
+	DeleteServiceAccount(ctx context.Context, id string) error
+	UseServiceAssertion(ctx context.Context, accountID string, jti string, expiresAt time.Time) error
+}
+
+// userOverlay serves users by users and everything else by the storage.
+type userOverlay struct {
+	storager
+	users userStorager
+}
+
+// withUsers replaces user methods of the storage, so users cache can't be bypassed by writes to the storage.
+func withUsers(s storager, users userStorager) storager {
+	return &userOverlay{
+		storager: s,
+		users:    users,
+	}
+}
+
+func (o *userOverlay) GetByID(ctx context.Context, id int64) (*db.User, error) {
+	return o.users.GetByID(ctx, id)
+}
+
+func (o *userOverlay) GetByName(ctx context.Context, name string) (*db.User, error) {
+	return o.users.GetByName(ctx, name)
+}
+
+func (o *userOverlay) GetByEmail(ctx context.Context, email string) (*db.User, error) {
+	return o.users.GetByEmail(ctx, email)
+}
+
+func (o *userOverlay) Create(ctx context.Context, u *db.User) error {
+	return o.users.Create(ctx, u)
+}
+
+func (o *userOverlay) GetPublicUsers(ctx context.Context) ([]*db.User, error) {
+	return o.users.GetPublicUsers(ctx)
+}
+
+type migrator interface {
+	Migrate(ctx context.Context, command string) error
+	CheckSchema(ctx context.Context) error
+	CheckMigrations(ctx context.Context) error
+}
+
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type statsCollector interface {
+	StatsCollector() prometheus.Collector
+}
+
+// dbScheme returns url scheme of the db connection string.
+// Postgres key/value connection strings have no scheme.
+func dbScheme(connStr string) string {
+	idx := strings.Index(connStr, "://")
+	if idx <= 0 {
+		return ""
+	}
+	return connStr[:idx]
+}
+
+func newStorage(cfg *config, l repeater.Logger) (storager, error) {
+	queryTimeout := db.WithQueryTimeout(time.Duration(cfg.DBQueryTimeoutSec) * time.Second)
+	pool := db.WithPool(db.PoolOptions{
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: time.Duration(cfg.DBConnMaxLifetimeSec) * time.Second,
+		ConnMaxIdleTime: time.Duration(cfg.DBConnMaxIdleTimeSec) * time.Second,
+	})
+
+	switch scheme := dbScheme(cfg.DB); scheme {
+	case "memory":
+		l.Infof("using in-memory storage, data will be lost on restart")
+		return db.NewMemory(), nil
+
+	case "sqlite":
+		storage, err := db.NewSQLite(strings.TrimPrefix(cfg.DB, "sqlite://"), queryTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open sqlite database: %w", err)
+		}
+		return storage, nil
+
+	case "", "postgres", "postgresql":
+		var storage *db.Postgres
+		if err := repeater.Do(
+			func() error {
+				var err error
+				storage, err = db.NewPostgres(cfg.DB, queryTimeout, pool, db.WithReplicas(cfg.DBReplicas))
+				return err
+			},
+			repeater.WithTimeout(time.Second*1),
+			repeater.WithLogger(l),
+			repeater.WithLogMessage("try to connect to database"),
+		); err != nil {
+			return nil, fmt.Errorf("unable to connect to database: %w", err)
+		}
+		return storage, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported db scheme: %s", scheme)
+	}
+}
+
+func migrate(ctx context.Context, s storager, command string) error {
+	m, ok := s.(migrator)
+	if !ok {
+		return fmt.Errorf("storage doesn't support migrations")
+	}
+
+	return m.Migrate(ctx, command)
+}
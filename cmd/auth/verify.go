@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/audit"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+)
+
+// runVerifyAudit implements "verify-audit" command.
+func runVerifyAudit(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: %s verify-audit", os.Args[0])
+	}
+
+	var cfg config
+	if err := loadConfig(&cfg, os.Getenv("FS_CONFIG_FILE")); err != nil {
+		return fmt.Errorf("load config error: %w", err)
+	}
+
+	storage, err := newStorage(&cfg, stdLogger{})
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	decoder, err := token.NewRSADecoder()
+	if err != nil {
+		return fmt.Errorf("unable to create decoder: %w", err)
+	}
+
+	report, err := audit.Verify(context.Background(), storage, decoder)
+	if err != nil {
+		var brokenErr *audit.BrokenLinkError
+		if errors.As(err, &brokenErr) {
+			return fmt.Errorf("FAILED: %w", brokenErr)
+		}
+		return fmt.Errorf("verify audit error: %w", err)
+	}
+
+	log.Printf("OK: %d events in %d chains (last id %d), %d checkpoints verified, %d events after the last checkpoints",
+		report.Events, report.Chains, report.LastEventID, report.Checkpoints, report.Unverified)
+	return nil
+}
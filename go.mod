@@ -6,7 +6,15 @@ require (
 	github.com/Mikhalevich/filesharing v0.0.0-20220212202806-b5432a5805ee
 	github.com/Mikhalevich/repeater v0.0.0-20211001095921-a918445112cf
 	github.com/asim/go-micro/v3 v3.6.0
+	github.com/go-asn1-ber/asn1-ber v1.5.1
+	github.com/go-ldap/ldap/v3 v3.4.1
 	github.com/golang-jwt/jwt v3.2.2+incompatible
-	github.com/lib/pq v1.3.0
+	github.com/lib/pq v1.10.3
+	github.com/patrickmn/go-cache v2.1.0+incompatible
+	github.com/pressly/goose/v3 v3.5.0
+	github.com/prometheus/client_golang v1.1.0
 	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
+	google.golang.org/protobuf v1.27.1
+	gopkg.in/yaml.v2 v2.4.0
+	modernc.org/sqlite v1.14.6
 )
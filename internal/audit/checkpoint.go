@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+)
+
+const checkpointTimeout = time.Second * 10
+
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+type checkpointStorager interface {
+	ListAuditChainHeads(ctx context.Context, afterID int64) ([]*db.AuditEvent, error)
+	AddAuditCheckpoint(ctx context.Context, c *db.AuditCheckpoint) error
+	ListAuditCheckpoints(ctx context.Context) ([]*db.AuditCheckpoint, error)
+}
+
+// Checkpointer periodically signs the hash and the number of events of every audit chain
+// appended since the previous checkpoint, so chains can't be rewritten without the signing key.
+type Checkpointer struct {
+	l        Logger
+	s        checkpointStorager
+	signer   token.Signer
+	interval time.Duration
+
+	// lastEventID is the latest checkpointed event, chains appended after it are checkpointed next time.
+	lastEventID int64
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewCheckpointer(l Logger, s checkpointStorager, signer token.Signer, interval time.Duration) *Checkpointer {
+	return &Checkpointer{
+		l:        l,
+		s:        s,
+		signer:   signer,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start loads the last checkpoint and then makes checkpoints periodically in background until Stop.
+func (c *Checkpointer) Start(ctx context.Context) error {
+	checkpoints, err := c.s.ListAuditCheckpoints(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, cp := range checkpoints {
+		if cp.EventID > c.lastEventID {
+			c.lastEventID = cp.EventID
+		}
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), checkpointTimeout)
+				if err := c.Checkpoint(ctx); err != nil {
+					c.l.Errorf("audit checkpoint error: %v", err)
+				}
+				cancel()
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (c *Checkpointer) Stop() {
+	close(c.done)
+	c.wg.Wait()
+}
+
+// Checkpoint signs the last event of every chain appended since the previous checkpoint.
+func (c *Checkpointer) Checkpoint(ctx context.Context) error {
+	heads, err := c.s.ListAuditChainHeads(ctx, c.lastEventID)
+	if err != nil {
+		return err
+	}
+
+	// heads are oldest first, so chains left after failure are appended after lastEventID
+	for _, head := range heads {
+		cp := db.AuditCheckpoint{
+			Chain:   head.Chain,
+			EventID: head.ID,
+			Count:   head.Seq,
+			Hash:    head.Hash,
+		}
+
+		cp.Signature, err = c.signer.Sign(cp.SignedData())
+		if err != nil {
+			return err
+		}
+
+		if err := c.s.AddAuditCheckpoint(ctx, &cp); err != nil {
+			return err
+		}
+
+		c.lastEventID = cp.EventID
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+)
+
+type verifyStorager interface {
+	WalkAuditEvents(ctx context.Context, fn func(e *db.AuditEvent) error) error
+	ListAuditCheckpoints(ctx context.Context) ([]*db.AuditCheckpoint, error)
+}
+
+// BrokenLinkError reports the first audit event (or checkpoint) the chain doesn't hold at.
+type BrokenLinkError struct {
+	EventID int64
+	Reason  string
+}
+
+func (e *BrokenLinkError) Error() string {
+	return fmt.Sprintf("audit chain is broken at event %d: %s", e.EventID, e.Reason)
+}
+
+// Report summarizes successful verification.
+type Report struct {
+	Events      int
+	Chains      int
+	Checkpoints int
+	LastEventID int64
+	// Unverified is the number of events appended after the last checkpoint of their chain.
+	Unverified int
+}
+
+// chainState is the last verified event of the chain.
+type chainState struct {
+	hash string
+	seq  int64
+	// unverified is the number of events after the last checkpoint of the chain.
+	unverified int
+}
+
+// Verify walks audit chains oldest first checking event hashes, links between events
+// and checkpoint signatures, *BrokenLinkError is returned for the first broken link.
+// Checkpoints sign the number of events of the chain, so removing events before the checkpoint is detected
+// even if the remaining events are linked again. Events appended after the last checkpoint of the chain
+// are not covered: removing them along with later checkpoints can't be detected, they are counted as unverified.
+func Verify(ctx context.Context, s verifyStorager, verifier token.Verifier) (*Report, error) {
+	checkpoints, err := s.ListAuditCheckpoints(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list checkpoints error: %w", err)
+	}
+
+	byEventID := make(map[int64]*db.AuditCheckpoint, len(checkpoints))
+	for _, cp := range checkpoints {
+		if err := verifier.Verify(cp.SignedData(), cp.Signature); err != nil {
+			return nil, &BrokenLinkError{
+				EventID: cp.EventID,
+				Reason:  fmt.Sprintf("invalid signature of checkpoint %d: %v", cp.ID, err),
+			}
+		}
+		byEventID[cp.EventID] = cp
+	}
+
+	var (
+		report Report
+		chains = make(map[string]*chainState)
+	)
+
+	err = s.WalkAuditEvents(ctx, func(e *db.AuditEvent) error {
+		chain, ok := chains[e.Chain]
+		if !ok {
+			chain = &chainState{}
+			chains[e.Chain] = chain
+		}
+
+		if e.PrevHash != chain.hash {
+			return &BrokenLinkError{
+				EventID: e.ID,
+				Reason:  "previous hash doesn't match, preceding event was changed or removed",
+			}
+		}
+
+		if e.Seq != chain.seq+1 {
+			return &BrokenLinkError{
+				EventID: e.ID,
+				Reason:  fmt.Sprintf("sequence number %d doesn't follow %d", e.Seq, chain.seq),
+			}
+		}
+
+		if e.Hash != e.ComputeHash() {
+			return &BrokenLinkError{
+				EventID: e.ID,
+				Reason:  "hash doesn't match event content",
+			}
+		}
+
+		chain.hash, chain.seq = e.Hash, e.Seq
+		chain.unverified++
+
+		if cp, ok := byEventID[e.ID]; ok {
+			if cp.Hash != e.Hash || cp.Chain != e.Chain || cp.Count != e.Seq {
+				return &BrokenLinkError{
+					EventID: e.ID,
+					Reason:  fmt.Sprintf("event doesn't match checkpoint %d", cp.ID),
+				}
+			}
+			report.Checkpoints++
+			chain.unverified = 0
+			delete(byEventID, e.ID)
+		}
+
+		report.Events++
+		report.LastEventID = e.ID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Chains = len(chains)
+	for _, chain := range chains {
+		report.Unverified += chain.unverified
+	}
+
+	// checkpointed events missing from the chain were removed
+	for _, cp := range checkpoints {
+		if _, ok := byEventID[cp.EventID]; ok {
+			return nil, &BrokenLinkError{
+				EventID: cp.EventID,
+				Reason:  fmt.Sprintf("event of checkpoint %d is missing", cp.ID),
+			}
+		}
+	}
+
+	return &report, nil
+}
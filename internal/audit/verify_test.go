@@ -0,0 +1,218 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+)
+
+// tamperedStorage serves events copied from the storage, so tests can change them.
+type tamperedStorage struct {
+	events      []*db.AuditEvent
+	checkpoints []*db.AuditCheckpoint
+}
+
+func (s *tamperedStorage) WalkAuditEvents(ctx context.Context, fn func(e *db.AuditEvent) error) error {
+	for _, e := range s.events {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *tamperedStorage) ListAuditCheckpoints(ctx context.Context) ([]*db.AuditCheckpoint, error) {
+	return s.checkpoints, nil
+}
+
+// remove removes event with the id and links the rest of its chain again as the attacker without signing key can.
+func (s *tamperedStorage) remove(id int64) {
+	var (
+		removed  *db.AuditEvent
+		prevHash string
+		events   []*db.AuditEvent
+	)
+	for _, e := range s.events {
+		if e.ID == id {
+			removed, prevHash = e, e.PrevHash
+			continue
+		}
+
+		if removed != nil && e.Chain == removed.Chain {
+			e.PrevHash = prevHash
+			e.Seq--
+			e.Hash = e.ComputeHash()
+			prevHash = e.Hash
+		}
+		events = append(events, e)
+	}
+	s.events = events
+}
+
+type testAudit struct {
+	m            *db.Memory
+	checkpointer *Checkpointer
+	decoder      *token.RSADecoder
+}
+
+func newTestAudit(t *testing.T) *testAudit {
+	t.Helper()
+
+	encoder, err := token.NewRSAEncoder(time.Minute)
+	if err != nil {
+		t.Fatalf("create encoder: %v", err)
+	}
+
+	decoder, err := token.NewRSADecoder()
+	if err != nil {
+		t.Fatalf("create decoder: %v", err)
+	}
+
+	m := db.NewMemory()
+	return &testAudit{
+		m:            m,
+		checkpointer: NewCheckpointer(nil, m, encoder, time.Minute),
+		decoder:      decoder,
+	}
+}
+
+func (ta *testAudit) add(t *testing.T, userIDs ...int64) {
+	t.Helper()
+	for _, id := range userIDs {
+		if err := ta.m.AddAuditEvent(context.Background(), &db.AuditEvent{Type: db.AuditLoginSuccess, UserID: id}); err != nil {
+			t.Fatalf("add event: %v", err)
+		}
+	}
+}
+
+func (ta *testAudit) checkpoint(t *testing.T) {
+	t.Helper()
+	if err := ta.checkpointer.Checkpoint(context.Background()); err != nil {
+		t.Fatalf("checkpoint: %v", err)
+	}
+}
+
+func (ta *testAudit) copy(t *testing.T) *tamperedStorage {
+	t.Helper()
+
+	var s tamperedStorage
+	if err := ta.m.WalkAuditEvents(context.Background(), func(e *db.AuditEvent) error {
+		s.events = append(s.events, e)
+		return nil
+	}); err != nil {
+		t.Fatalf("walk events: %v", err)
+	}
+
+	checkpoints, err := ta.m.ListAuditCheckpoints(context.Background())
+	if err != nil {
+		t.Fatalf("list checkpoints: %v", err)
+	}
+	s.checkpoints = checkpoints
+	return &s
+}
+
+func TestVerify(t *testing.T) {
+	ta := newTestAudit(t)
+	ta.add(t, 1, 2, 0, 1)
+	ta.checkpoint(t)
+	ta.add(t, 2, 1)
+	ta.checkpoint(t)
+	ta.add(t, 1, 0)
+
+	report, err := Verify(context.Background(), ta.m, ta.decoder)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	want := Report{
+		Events:      8,
+		Chains:      3,
+		Checkpoints: 5,
+		LastEventID: 8,
+		Unverified:  2,
+	}
+	if *report != want {
+		t.Errorf("report %+v, want %+v", *report, want)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		tamper func(s *tamperedStorage)
+		// eventID is the event the chain is reported broken at
+		eventID int64
+	}{
+		{
+			name:    "changed event",
+			tamper:  func(s *tamperedStorage) { s.events[1].Details = "changed" },
+			eventID: 2,
+		},
+		{
+			name:    "removed event",
+			tamper:  func(s *tamperedStorage) { s.events = append(s.events[:1:1], s.events[2:]...) },
+			eventID: 5,
+		},
+		{
+			name:   "removed event relinked",
+			tamper: func(s *tamperedStorage) { s.remove(1) },
+			// the chain holds up to the checkpoint of its count and hash
+			eventID: 6,
+		},
+		{
+			name:    "moved to other chain",
+			tamper:  func(s *tamperedStorage) { s.events[3].Chain = db.AuditUserChain(2) },
+			eventID: 4,
+		},
+		{
+			name: "removed checkpointed event",
+			tamper: func(s *tamperedStorage) {
+				s.events = s.events[:len(s.events)-1]
+			},
+			eventID: 6,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ta := newTestAudit(t)
+			ta.add(t, 1, 2, 0, 1, 2, 1)
+			ta.checkpoint(t)
+
+			s := ta.copy(t)
+			tc.tamper(s)
+
+			_, err := Verify(context.Background(), s, ta.decoder)
+
+			var brokenErr *BrokenLinkError
+			if !errors.As(err, &brokenErr) {
+				t.Fatalf("verify: %v, want broken link", err)
+			}
+
+			if brokenErr.EventID != tc.eventID {
+				t.Errorf("broken at %d (%s), want %d", brokenErr.EventID, brokenErr.Reason, tc.eventID)
+			}
+		})
+	}
+}
+
+func TestVerifyDoesNotCoverEventsAfterCheckpoint(t *testing.T) {
+	ta := newTestAudit(t)
+	ta.add(t, 1, 1)
+	ta.checkpoint(t)
+	ta.add(t, 1)
+
+	s := ta.copy(t)
+	s.events = s.events[:2]
+
+	report, err := Verify(context.Background(), s, ta.decoder)
+	if err != nil {
+		t.Fatalf("verify of truncated tail: %v", err)
+	}
+
+	if report.Unverified != 0 || report.Events != 2 {
+		t.Errorf("report %+v, want 2 events all verified", *report)
+	}
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// Cacher is a key value cache used by Storage.
+// GoCache is used by default, distributed cache could be plugged in by implementing this interface.
+type Cacher interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{})
+	Delete(key string)
+	Flush()
+}
+
+// GoCache is an in-process go-cache with time to live for each entry and limited number of entries.
+// go-cache itself is unbounded, so new keys are not added while the cache is full of entries not expired yet.
+type GoCache struct {
+	// mu serializes additions, so the size is never exceeded
+	mu   sync.Mutex
+	size int
+	c    *gocache.Cache
+}
+
+// NewGoCache creates cache of size entries at most, expired entries are removed every ttl.
+func NewGoCache(size int, ttl time.Duration) *GoCache {
+	return &GoCache{
+		size: size,
+		c:    gocache.New(ttl, ttl),
+	}
+}
+
+func (g *GoCache) Get(key string) (interface{}, bool) {
+	return g.c.Get(key)
+}
+
+func (g *GoCache) Set(key string, value interface{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// existing entries are replaced whatever the size is
+	if err := g.c.Replace(key, value, gocache.DefaultExpiration); err == nil {
+		return
+	}
+
+	if g.c.ItemCount() >= g.size {
+		g.c.DeleteExpired()
+		if g.c.ItemCount() >= g.size {
+			return
+		}
+	}
+
+	g.c.SetDefault(key, value)
+}
+
+func (g *GoCache) Delete(key string) {
+	g.c.Delete(key)
+}
+
+func (g *GoCache) Flush() {
+	g.c.Flush()
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGoCacheSizeLimit(t *testing.T) {
+	c := NewGoCache(2, time.Minute)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	if _, ok := c.Get("c"); ok {
+		t.Error("c is added to the full cache")
+	}
+
+	// existing entries are replaced in the full cache
+	c.Set("a", 10)
+	if v, ok := c.Get("a"); !ok || v.(int) != 10 {
+		t.Errorf("get a: %v %t, want 10", v, ok)
+	}
+
+	c.Delete("b")
+	c.Set("c", 3)
+	if v, ok := c.Get("c"); !ok || v.(int) != 3 {
+		t.Errorf("get c after delete: %v %t, want 3", v, ok)
+	}
+}
+
+func TestGoCacheExpiration(t *testing.T) {
+	c := NewGoCache(1, time.Millisecond*10)
+
+	c.Set("a", 1)
+	time.Sleep(time.Millisecond * 20)
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("expired a is returned")
+	}
+
+	// expired entries make room for new ones
+	c.Set("b", 2)
+	if v, ok := c.Get("b"); !ok || v.(int) != 2 {
+		t.Errorf("get b: %v %t, want 2", v, ok)
+	}
+}
+
+func TestGoCacheFlush(t *testing.T) {
+	c := NewGoCache(2, time.Minute)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Flush()
+
+	for _, key := range []string{"a", "b"} {
+		if _, ok := c.Get(key); ok {
+			t.Errorf("%s is returned after flush", key)
+		}
+	}
+
+	c.Set("c", 3)
+	if v, ok := c.Get("c"); !ok || v.(int) != 3 {
+		t.Errorf("get c after flush: %v %t, want 3", v, ok)
+	}
+}
@@ -0,0 +1,25 @@
+package cache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var requestsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "auth_user_cache_requests_total",
+		Help: "Number of user cache lookups partitioned by lookup key and result (hit or miss).",
+	},
+	[]string{"key", "result"},
+)
+
+func init() {
+	prometheus.MustRegister(requestsCounter)
+}
+
+func observe(key string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	requestsCounter.WithLabelValues(key, result).Inc()
+}
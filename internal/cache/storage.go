@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+)
+
+const publicUsersKey = "public"
+
+type storager interface {
+	GetByID(ctx context.Context, id int64) (*db.User, error)
+	GetByName(ctx context.Context, name string) (*db.User, error)
+	GetByEmail(ctx context.Context, email string) (*db.User, error)
+	Create(ctx context.Context, u *db.User) error
+	GetPublicUsers(ctx context.Context) ([]*db.User, error)
+	Close() error
+}
+
+// Storage is a read-through cache decorator for the users storage.
+// Users are cached by id, name and emails, every write invalidates affected entries.
+type Storage struct {
+	s storager
+	c Cacher
+
+	// generation is increased on every invalidation,
+	// values loaded before invalidation are not stored to avoid caching stale users.
+	mu         sync.Mutex
+	generation uint64
+}
+
+func NewStorage(s storager, c Cacher) *Storage {
+	return &Storage{
+		s: s,
+		c: c,
+	}
+}
+
+func idKey(id int64) string {
+	return "id:" + strconv.FormatInt(id, 10)
+}
+
+func nameKey(name string) string {
+	return "name:" + name
+}
+
+func emailKey(email string) string {
+	return "email:" + email
+}
+
+func copyUser(u *db.User) *db.User {
+	user := *u
+	if u.Emails != nil {
+		user.Emails = make([]db.Email, len(u.Emails))
+		copy(user.Emails, u.Emails)
+	}
+	return &user
+}
+
+func (cs *Storage) currentGeneration() uint64 {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.generation
+}
+
+func (cs *Storage) cacheUser(u *db.User, generation uint64) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if generation != cs.generation {
+		return
+	}
+
+	u = copyUser(u)
+	cs.c.Set(idKey(u.ID), u)
+	cs.c.Set(nameKey(u.Name), u)
+	for _, e := range u.Emails {
+		cs.c.Set(emailKey(e.Email), u)
+	}
+}
+
+func (cs *Storage) cachedUser(key string, label string) (*db.User, bool) {
+	v, ok := cs.c.Get(key)
+	observe(label, ok)
+	if !ok {
+		return nil, false
+	}
+
+	return copyUser(v.(*db.User)), true
+}
+
+// invalidate removes all entries of the user found by the given keys and public users list.
+func (cs *Storage) invalidate(keys ...string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.generation++
+
+	for _, key := range keys {
+		if v, ok := cs.c.Get(key); ok {
+			u := v.(*db.User)
+			cs.c.Delete(idKey(u.ID))
+			cs.c.Delete(nameKey(u.Name))
+			for _, e := range u.Emails {
+				cs.c.Delete(emailKey(e.Email))
+			}
+		}
+		cs.c.Delete(key)
+	}
+
+	cs.c.Delete(publicUsersKey)
+}
+
+func (cs *Storage) GetByID(ctx context.Context, id int64) (*db.User, error) {
+	if u, ok := cs.cachedUser(idKey(id), "id"); ok {
+		return u, nil
+	}
+
+	generation := cs.currentGeneration()
+	u, err := cs.s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.cacheUser(u, generation)
+	return u, nil
+}
+
+func (cs *Storage) GetByName(ctx context.Context, name string) (*db.User, error) {
+	if u, ok := cs.cachedUser(nameKey(name), "name"); ok {
+		return u, nil
+	}
+
+	generation := cs.currentGeneration()
+	u, err := cs.s.GetByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.cacheUser(u, generation)
+	return u, nil
+}
+
+func (cs *Storage) GetByEmail(ctx context.Context, email string) (*db.User, error) {
+	if u, ok := cs.cachedUser(emailKey(email), "email"); ok {
+		return u, nil
+	}
+
+	generation := cs.currentGeneration()
+	u, err := cs.s.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.cacheUser(u, generation)
+	return u, nil
+}
+
+func (cs *Storage) Create(ctx context.Context, u *db.User) error {
+	keys := []string{nameKey(u.Name)}
+	for _, e := range u.Emails {
+		keys = append(keys, emailKey(e.Email))
+	}
+	defer cs.invalidate(keys...)
+
+	return cs.s.Create(ctx, u)
+}
+
+func (cs *Storage) GetPublicUsers(ctx context.Context) ([]*db.User, error) {
+	v, ok := cs.c.Get(publicUsersKey)
+	observe(publicUsersKey, ok)
+	if ok {
+		cached := v.([]*db.User)
+		users := make([]*db.User, 0, len(cached))
+		for _, u := range cached {
+			users = append(users, copyUser(u))
+		}
+		return users, nil
+	}
+
+	generation := cs.currentGeneration()
+	users, err := cs.s.GetPublicUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cached := make([]*db.User, 0, len(users))
+	for _, u := range users {
+		cached = append(cached, copyUser(u))
+	}
+
+	cs.mu.Lock()
+	if generation == cs.generation {
+		cs.c.Set(publicUsersKey, cached)
+	}
+	cs.mu.Unlock()
+
+	return users, nil
+}
+
+func (cs *Storage) Close() error {
+	return cs.s.Close()
+}
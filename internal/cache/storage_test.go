@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+)
+
+// countingStorage counts lookups reaching the storage, onLoad is called before each of them.
+type countingStorage struct {
+	*db.Memory
+	loads  int
+	onLoad func()
+}
+
+func (s *countingStorage) load() {
+	s.loads++
+	if s.onLoad != nil {
+		s.onLoad()
+	}
+}
+
+func (s *countingStorage) GetByID(ctx context.Context, id int64) (*db.User, error) {
+	s.load()
+	return s.Memory.GetByID(ctx, id)
+}
+
+func (s *countingStorage) GetByName(ctx context.Context, name string) (*db.User, error) {
+	s.load()
+	return s.Memory.GetByName(ctx, name)
+}
+
+func (s *countingStorage) GetByEmail(ctx context.Context, email string) (*db.User, error) {
+	s.load()
+	return s.Memory.GetByEmail(ctx, email)
+}
+
+func (s *countingStorage) GetPublicUsers(ctx context.Context) ([]*db.User, error) {
+	s.load()
+	return s.Memory.GetPublicUsers(ctx)
+}
+
+func newTestStorage(t *testing.T) (*Storage, *countingStorage) {
+	t.Helper()
+
+	s := &countingStorage{Memory: db.NewMemory()}
+	if err := s.Create(context.Background(), &db.User{
+		Name:   "alice",
+		Emails: []db.Email{{Email: "alice@example.com", Primary: true}},
+	}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	return NewStorage(s, NewGoCache(100, time.Minute)), s
+}
+
+func TestStorageCachesUserByAllKeys(t *testing.T) {
+	ctx := context.Background()
+	cs, s := newTestStorage(t)
+
+	u, err := cs.GetByName(ctx, "alice")
+	if err != nil {
+		t.Fatalf("get by name: %v", err)
+	}
+
+	// changes of the returned user don't affect the cached one
+	u.Name = "changed"
+
+	if got, err := cs.GetByID(ctx, u.ID); err != nil || got.Name != "alice" {
+		t.Errorf("get by id: %+v %v", got, err)
+	}
+
+	if got, err := cs.GetByEmail(ctx, "alice@example.com"); err != nil || got.Name != "alice" {
+		t.Errorf("get by email: %+v %v", got, err)
+	}
+
+	if s.loads != 1 {
+		t.Errorf("storage loads %d, want 1", s.loads)
+	}
+}
+
+func TestStorageCreateInvalidates(t *testing.T) {
+	ctx := context.Background()
+	cs, s := newTestStorage(t)
+
+	if _, err := cs.GetPublicUsers(ctx); err != nil {
+		t.Fatalf("get public users: %v", err)
+	}
+
+	if _, err := cs.GetByName(ctx, "alice"); err != nil {
+		t.Fatalf("get by name: %v", err)
+	}
+
+	// failed create with the cached name invalidates the user as well
+	if err := cs.Create(ctx, &db.User{Name: "alice"}); err == nil {
+		t.Fatal("duplicate user is created")
+	}
+
+	loads := s.loads
+	if _, err := cs.GetByEmail(ctx, "alice@example.com"); err != nil {
+		t.Fatalf("get by email: %v", err)
+	}
+
+	if _, err := cs.GetPublicUsers(ctx); err != nil {
+		t.Fatalf("get public users: %v", err)
+	}
+
+	if s.loads != loads+2 {
+		t.Errorf("storage loads %d after invalidation, want %d", s.loads, loads+2)
+	}
+}
+
+func TestStorageSkipsStaleLoad(t *testing.T) {
+	ctx := context.Background()
+	cs, s := newTestStorage(t)
+
+	// invalidation while the user is loaded makes the loaded value stale
+	s.onLoad = func() {
+		s.onLoad = nil
+		cs.invalidate(nameKey("alice"))
+	}
+
+	if _, err := cs.GetByName(ctx, "alice"); err != nil {
+		t.Fatalf("get by name: %v", err)
+	}
+
+	if _, err := cs.GetByName(ctx, "alice"); err != nil {
+		t.Fatalf("get by name: %v", err)
+	}
+
+	if s.loads != 2 {
+		t.Errorf("storage loads %d, want 2", s.loads)
+	}
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"time"
+)
+
+// APIKey is a personal access token scripts exchange for short-lived tokens instead of using the user password.
+type APIKey struct {
+	// ID is the public part of the key it is looked up by.
+	ID         string
+	UserID     int64
+	Name       string
+	SecretHash string
+	Scopes     []string
+	CreatedAt  time.Time
+	// ExpiresAt is zero for keys that never expire.
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+	// RevokedAt is zero for active keys.
+	RevokedAt time.Time
+}
+
+// IsRevoked reports whether the key is no longer accepted.
+func (k *APIKey) IsRevoked() bool {
+	return !k.RevokedAt.IsZero()
+}
+
+// IsExpired reports whether the key is expired at t.
+func (k *APIKey) IsExpired(t time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !t.Before(k.ExpiresAt)
+}
+
+// apiKeyColumns lists api_keys columns in the order they are scanned.
+var apiKeyColumns = []string{"id", "user_id", "name", "secret_hash", "scopes", "created_at", "expires_at", "last_used_at", "revoked_at"}
+
+func (k *APIKey) scanDest() []interface{} {
+	return []interface{}{&k.ID, &k.UserID, &k.Name, &k.SecretHash}
+}
@@ -0,0 +1,239 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+)
+
+// Audit event types.
+const (
+	AuditRegister     = "register"
+	AuditLoginSuccess = "login_success"
+	AuditLoginFailure = "login_failure"
+	AuditPublicLogin  = "public_login"
+
+	AuditSessionRevoke = "session_revoke"
+
+	AuditOAuthClientRegister = "oauth_client_register"
+	AuditOAuthAuthorize      = "oauth_authorize"
+	AuditOAuthToken          = "oauth_token"
+
+	AuditFederatedLogin = "federated_login"
+	AuditIdentityLink   = "identity_link"
+
+	AuditAPIKeyCreate   = "api_key_create"
+	AuditAPIKeyRevoke   = "api_key_revoke"
+	AuditAPIKeyExchange = "api_key_exchange"
+
+	AuditDeviceAuthorize = "device_authorize"
+
+	AuditMagicLinkRequest = "magic_link_request"
+
+	AuditServiceAccountCreate = "service_account_create"
+	AuditServiceAccountDelete = "service_account_delete"
+	AuditServiceToken         = "service_token"
+	AuditTokenExchange        = "token_exchange"
+)
+
+// AuditSystemChain is the chain of events not related to any user.
+const AuditSystemChain = "system"
+
+// AuditUserChain returns the chain of the user events.
+func AuditUserChain(userID int64) string {
+	return "user:" + strconv.FormatInt(userID, 10)
+}
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditEvent is an append-only record of security relevant action.
+type AuditEvent struct {
+	ID        int64
+	Type      string
+	UserID    int64
+	UserName  string
+	ActorID   int64
+	ClientIP  string
+	UserAgent string
+	Details   string
+	CreatedAt time.Time
+	// Chain is the chain the event is linked into, events of every user form a separate chain
+	// so they are appended independently. Seq is the number of the event in the chain starting from 1.
+	Chain string
+	Seq   int64
+
+	// PrevHash is the hash of the previous event of the chain, Hash covers PrevHash and all fields above except ID,
+	// so editing or removing any event breaks the chain.
+	PrevHash string
+	Hash     string
+}
+
+// auditChain returns the chain e is appended to.
+func (e *AuditEvent) auditChain() string {
+	if e.UserID != 0 {
+		return AuditUserChain(e.UserID)
+	}
+	return AuditSystemChain
+}
+
+// ComputeHash returns hash of the event linked to PrevHash.
+func (e *AuditEvent) ComputeHash() string {
+	fields := []string{
+		e.PrevHash,
+		e.Type,
+		strconv.FormatInt(e.UserID, 10),
+		e.UserName,
+		strconv.FormatInt(e.ActorID, 10),
+		e.ClientIP,
+		e.UserAgent,
+		e.Details,
+		strconv.FormatInt(e.CreatedAt.UnixNano(), 10),
+		e.Chain,
+		strconv.FormatInt(e.Seq, 10),
+	}
+
+	h := sha256.New()
+	for _, field := range fields {
+		// length prefix keeps field boundaries unambiguous
+		h.Write([]byte(strconv.Itoa(len(field)) + ":" + field))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// link links e to the previous event of its chain, prev is nil for the first event of the chain.
+// It sets CreatedAt, Seq and hashes, fields the client sets are truncated to sizes of their columns before they are hashed.
+func (e *AuditEvent) link(prev *AuditEvent) {
+	e.UserName = shared.Truncate(e.UserName, MaxUserNameLength)
+	e.ClientIP = shared.Truncate(e.ClientIP, shared.MaxClientIPLength)
+	e.UserAgent = shared.Truncate(e.UserAgent, shared.MaxUserAgentLength)
+
+	e.PrevHash, e.Seq = "", 1
+	if prev != nil {
+		e.PrevHash, e.Seq = prev.Hash, prev.Seq+1
+	}
+	e.CreatedAt = now()
+	e.Hash = e.ComputeHash()
+}
+
+// AuditCheckpoint is a signed statement that Chain up to EventID had Count events and ended with Hash.
+type AuditCheckpoint struct {
+	ID        int64
+	Chain     string
+	EventID   int64
+	Count     int64
+	Hash      string
+	Signature string
+	CreatedAt time.Time
+}
+
+// SignedData returns data covered by the checkpoint signature.
+func (c *AuditCheckpoint) SignedData() []byte {
+	return []byte(strconv.FormatInt(c.EventID, 10) + ":" + c.Hash + ":" + strconv.FormatInt(c.Count, 10) + ":" + c.Chain)
+}
+
+// AuditFilter selects audit events, zero fields are not used for filtering.
+// Events are returned newest first.
+type AuditFilter struct {
+	UserID   int64
+	Type     string
+	From     time.Time
+	To       time.Time
+	BeforeID int64
+	Limit    int
+}
+
+func (f AuditFilter) limit() int {
+	if f.Limit <= 0 {
+		return defaultAuditLimit
+	}
+	if f.Limit > maxAuditLimit {
+		return maxAuditLimit
+	}
+	return f.Limit
+}
+
+func (f AuditFilter) matches(e *AuditEvent) bool {
+	if f.UserID != 0 && e.UserID != f.UserID {
+		return false
+	}
+	if f.Type != "" && e.Type != f.Type {
+		return false
+	}
+	if !f.From.IsZero() && e.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !e.CreatedAt.Before(f.To) {
+		return false
+	}
+	if f.BeforeID != 0 && e.ID >= f.BeforeID {
+		return false
+	}
+	return true
+}
+
+// auditColumns lists audit_events columns in the order scanAuditEvent reads them.
+var auditColumns = []string{"id", "type", "user_id", "user_name", "actor_id", "client_ip", "user_agent", "details", "chain", "seq", "prev_hash", "hash", "created_at"}
+
+// checkpointColumns lists audit_checkpoints columns in the order they are scanned.
+var checkpointColumns = []string{"id", "chain", "event_id", "event_count", "hash", "signature", "created_at"}
+
+// auditQuery builds select of audit events matching f,
+// placeholder returns n-th query placeholder and timeArg converts time to the stored representation.
+func auditQuery(f AuditFilter, placeholder func(n int) string, timeArg func(t time.Time) interface{}) (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, condition+" "+placeholder(len(args)))
+	}
+
+	if f.UserID != 0 {
+		add("user_id =", f.UserID)
+	}
+	if f.Type != "" {
+		add("type =", f.Type)
+	}
+	if !f.From.IsZero() {
+		add("created_at >=", timeArg(f.From))
+	}
+	if !f.To.IsZero() {
+		add("created_at <", timeArg(f.To))
+	}
+	if f.BeforeID != 0 {
+		add("id <", f.BeforeID)
+	}
+
+	query := "SELECT " + strings.Join(auditColumns, ", ") + " FROM audit_events"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT " + strconv.Itoa(f.limit())
+
+	return query, args
+}
+
+// auditChainHeadsQuery selects the last event of every chain having events with id greater than the placeholder.
+func auditChainHeadsQuery(placeholder string) string {
+	return "SELECT " + strings.Join(auditColumns, ", ") + " FROM audit_events " +
+		"WHERE id IN (SELECT MAX(id) FROM audit_events WHERE id > " + placeholder + " AND hash <> '' GROUP BY chain) ORDER BY id"
+}
+
+// scanDest returns scan destinations of all auditColumns except created_at,
+// which is stored differently by backends.
+func (e *AuditEvent) scanDest() []interface{} {
+	return []interface{}{&e.ID, &e.Type, &e.UserID, &e.UserName, &e.ActorID, &e.ClientIP, &e.UserAgent, &e.Details, &e.Chain, &e.Seq, &e.PrevHash, &e.Hash}
+}
+
+func (c *AuditCheckpoint) scanDest() []interface{} {
+	return []interface{}{&c.ID, &c.Chain, &c.EventID, &c.Count, &c.Hash, &c.Signature}
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type auditStorager interface {
+	AddAuditEvent(ctx context.Context, e *AuditEvent) error
+	ListAuditChainHeads(ctx context.Context, afterID int64) ([]*AuditEvent, error)
+	ListAuditEvents(ctx context.Context, f AuditFilter) ([]*AuditEvent, error)
+}
+
+func TestMemoryAuditChains(t *testing.T) {
+	testAuditChains(t, NewMemory())
+}
+
+func TestSQLiteAuditChains(t *testing.T) {
+	testAuditChains(t, newTestSQLite(t))
+}
+
+func TestPostgresAuditChains(t *testing.T) {
+	testAuditChains(t, newTestPostgres(t))
+}
+
+func TestMemoryAuditOversizedFields(t *testing.T) {
+	testAuditOversizedFields(t, NewMemory())
+}
+
+func TestSQLiteAuditOversizedFields(t *testing.T) {
+	testAuditOversizedFields(t, newTestSQLite(t))
+}
+
+func TestPostgresAuditOversizedFields(t *testing.T) {
+	testAuditOversizedFields(t, newTestPostgres(t))
+}
+
+// testAuditChains checks that events are linked within chains of their users.
+// Chains of persistent database may have events already, so the first appended event is taken as the base.
+func testAuditChains(t *testing.T, s auditStorager) {
+	ctx := context.Background()
+
+	add := func(userID int64) *AuditEvent {
+		t.Helper()
+		e := AuditEvent{Type: AuditLoginSuccess, UserID: userID}
+		if err := s.AddAuditEvent(ctx, &e); err != nil {
+			t.Fatalf("add audit event: %v", err)
+		}
+		return &e
+	}
+
+	const user = 1 << 40
+	first := add(user)
+	system := add(0)
+	second := add(user)
+
+	if first.Chain != AuditUserChain(user) || system.Chain != AuditSystemChain {
+		t.Errorf("chains %q and %q, want %q and %q", first.Chain, system.Chain, AuditUserChain(user), AuditSystemChain)
+	}
+
+	if second.Chain != first.Chain || second.Seq != first.Seq+1 || second.PrevHash != first.Hash {
+		t.Errorf("event %+v is not linked to %+v", second, first)
+	}
+
+	if second.Hash != second.ComputeHash() {
+		t.Errorf("hash %s doesn't match content", second.Hash)
+	}
+
+	heads, err := s.ListAuditChainHeads(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("list chain heads: %v", err)
+	}
+
+	if len(heads) != 2 || heads[0].ID != system.ID || heads[1].ID != second.ID {
+		t.Fatalf("chain heads %+v, want events %d and %d", heads, system.ID, second.ID)
+	}
+
+	if heads[1].Seq != second.Seq || heads[1].Hash != second.Hash || heads[1].Chain != second.Chain {
+		t.Errorf("chain head %+v, want %+v", heads[1], second)
+	}
+}
+
+// testAuditOversizedFields checks that name of failed login and client info longer than their columns are stored truncated.
+func testAuditOversizedFields(t *testing.T, s auditStorager) {
+	ctx := context.Background()
+
+	const user = 1<<40 + 1
+	e := AuditEvent{
+		Type:      AuditLoginFailure,
+		UserID:    user,
+		UserName:  strings.Repeat("n", 200),
+		ClientIP:  strings.Repeat("i", 100),
+		UserAgent: strings.Repeat("ü", 300),
+	}
+	if err := s.AddAuditEvent(ctx, &e); err != nil {
+		t.Fatalf("add audit event: %v", err)
+	}
+
+	if len(e.UserName) != MaxUserNameLength || len(e.ClientIP) != 64 || len([]rune(e.UserAgent)) != 256 {
+		t.Errorf("event %+v is not truncated", e)
+	}
+
+	events, err := s.ListAuditEvents(ctx, AuditFilter{UserID: user, Limit: 1})
+	if err != nil {
+		t.Fatalf("list audit events: %v", err)
+	}
+
+	if len(events) != 1 || events[0].ID != e.ID {
+		t.Fatalf("events %+v, want %d", events, e.ID)
+	}
+
+	got := events[0]
+	if got.UserName != e.UserName || got.ClientIP != e.ClientIP || got.UserAgent != e.UserAgent || got.Hash != got.ComputeHash() {
+		t.Errorf("stored event %+v, want %+v", got, e)
+	}
+}
@@ -0,0 +1,377 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asim/go-micro/v3/metadata"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+)
+
+// testPostgresEnv is the connection string of the database postgres tests run against, they are skipped if it is empty.
+const testPostgresEnv = "FS_TEST_POSTGRES"
+
+type conformanceStorager interface {
+	GetByID(ctx context.Context, id int64) (*User, error)
+	GetByName(ctx context.Context, name string) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	Create(ctx context.Context, u *User) error
+	AddEmail(ctx context.Context, userID int64, e Email) error
+	GetPublicUsers(ctx context.Context) ([]*User, error)
+	CreateSession(ctx context.Context, s *Session) error
+	GetSession(ctx context.Context, id string) (*Session, error)
+	CreateDeviceCode(ctx context.Context, c *DeviceCode) error
+	GetDeviceCode(ctx context.Context, codeHash string) (*DeviceCode, error)
+	CreateMagicLink(ctx context.Context, l *MagicLink, limit int, window time.Duration) error
+}
+
+// oversizedClientContext returns context with client info longer than columns it is stored in,
+// the client sets it, so it is truncated before it is stored.
+func oversizedClientContext() context.Context {
+	return metadata.NewContext(context.Background(), metadata.Metadata{
+		"X-Forwarded-For": strings.Repeat("f", 100) + ", 10.0.0.1",
+		"User-Agent":      strings.Repeat("ü", 300) + "\xff",
+	})
+}
+
+func newTestSQLite(t *testing.T) *SQLite {
+	t.Helper()
+
+	s, err := NewSQLite(filepath.Join(t.TempDir(), "auth.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	if err := s.Migrate(context.Background(), MigrateUp); err != nil {
+		t.Fatalf("migrate sqlite: %v", err)
+	}
+	return s
+}
+
+func newTestPostgres(t *testing.T) *Postgres {
+	t.Helper()
+
+	connStr := os.Getenv(testPostgresEnv)
+	if connStr == "" {
+		t.Skipf("%s is not set", testPostgresEnv)
+	}
+
+	p, err := NewPostgres(connStr)
+	if err != nil {
+		t.Fatalf("open postgres: %v", err)
+	}
+	t.Cleanup(func() { p.Close() })
+
+	if err := p.Migrate(context.Background(), MigrateUp); err != nil {
+		t.Fatalf("migrate postgres: %v", err)
+	}
+	return p
+}
+
+func TestMemoryConformance(t *testing.T) {
+	testConformance(t, NewMemory())
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	testConformance(t, newTestSQLite(t))
+}
+
+func TestPostgresConformance(t *testing.T) {
+	testConformance(t, newTestPostgres(t))
+}
+
+// testConformance checks semantics every storage implementation must share.
+// Names are unique per run, so the suite can run against persistent database.
+func testConformance(t *testing.T, s conformanceStorager) {
+	ctx := context.Background()
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano())
+	name := func(n string) string {
+		return n + "_" + suffix
+	}
+	email := func(n string) string {
+		return n + "_" + suffix + "@example.com"
+	}
+
+	create := func(t *testing.T, u *User) *User {
+		t.Helper()
+		if err := s.Create(ctx, u); err != nil {
+			t.Fatalf("create %s: %v", u.Name, err)
+		}
+		if u.ID == 0 {
+			t.Fatalf("create %s: id is not set", u.Name)
+		}
+		return u
+	}
+
+	t.Run("create and get", func(t *testing.T) {
+		u := create(t, &User{
+			Name: name("alice"),
+			Pwd:  sql.NullString{String: "hash", Valid: true},
+			Emails: []Email{
+				{Email: email("alice"), Primary: true, Verified: true},
+			},
+		})
+
+		for _, get := range []struct {
+			by string
+			fn func() (*User, error)
+		}{
+			{"id", func() (*User, error) { return s.GetByID(ctx, u.ID) }},
+			{"name", func() (*User, error) { return s.GetByName(ctx, u.Name) }},
+			{"email", func() (*User, error) { return s.GetByEmail(ctx, email("alice")) }},
+		} {
+			got, err := get.fn()
+			if err != nil {
+				t.Fatalf("get by %s: %v", get.by, err)
+			}
+
+			if got.ID != u.ID || got.Name != u.Name || got.Pwd != u.Pwd || got.Public {
+				t.Errorf("get by %s: got %+v, want %+v", get.by, got, u)
+			}
+
+			if len(got.Emails) != 1 || got.Emails[0] != u.Emails[0] {
+				t.Errorf("get by %s: emails %+v, want %+v", get.by, got.Emails, u.Emails)
+			}
+		}
+	})
+
+	t.Run("user without emails", func(t *testing.T) {
+		u := create(t, &User{Name: name("noemail")})
+
+		got, err := s.GetByID(ctx, u.ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+
+		if got.Emails == nil || len(got.Emails) != 0 {
+			t.Errorf("emails %#v, want empty", got.Emails)
+		}
+	})
+
+	t.Run("not exist", func(t *testing.T) {
+		if _, err := s.GetByName(ctx, name("nobody")); !errors.Is(err, ErrNotExist) {
+			t.Errorf("get by name: %v, want %v", err, ErrNotExist)
+		}
+
+		if _, err := s.GetByID(ctx, -1); !errors.Is(err, ErrNotExist) {
+			t.Errorf("get by id: %v, want %v", err, ErrNotExist)
+		}
+
+		if _, err := s.GetByEmail(ctx, email("nobody")); !errors.Is(err, ErrNotExist) {
+			t.Errorf("get by email: %v, want %v", err, ErrNotExist)
+		}
+	})
+
+	t.Run("unique name", func(t *testing.T) {
+		create(t, &User{Name: name("bob")})
+
+		if err := s.Create(ctx, &User{Name: name("bob")}); !errors.Is(err, ErrAlreadyExist) {
+			t.Errorf("create duplicate: %v, want %v", err, ErrAlreadyExist)
+		}
+	})
+
+	t.Run("emails keep insertion order", func(t *testing.T) {
+		u := create(t, &User{Name: name("carol")})
+
+		var want []Email
+		for _, n := range []string{"c3", "c1", "c2", "c5", "c4"} {
+			e := Email{Email: email(n)}
+			if err := s.AddEmail(ctx, u.ID, e); err != nil {
+				t.Fatalf("add email %s: %v", e.Email, err)
+			}
+			want = append(want, e)
+		}
+
+		// upsert keeps the position of existing email
+		want[1].Verified = true
+		if err := s.AddEmail(ctx, u.ID, want[1]); err != nil {
+			t.Fatalf("update email: %v", err)
+		}
+
+		got, err := s.GetByID(ctx, u.ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+
+		if fmt.Sprint(got.Emails) != fmt.Sprint(want) {
+			t.Errorf("emails %+v, want %+v", got.Emails, want)
+		}
+	})
+
+	t.Run("email of unknown user", func(t *testing.T) {
+		if err := s.AddEmail(ctx, 1<<40, Email{Email: email("orphan")}); !errors.Is(err, ErrNotExist) {
+			t.Errorf("add email: %v, want %v", err, ErrNotExist)
+		}
+
+		if _, err := s.GetByEmail(ctx, email("orphan")); !errors.Is(err, ErrNotExist) {
+			t.Errorf("get by orphan email: %v, want %v", err, ErrNotExist)
+		}
+	})
+
+	t.Run("public users", func(t *testing.T) {
+		// public flag can't be set on creation
+		u := create(t, &User{Name: name("dave"), Public: true})
+
+		users, err := s.GetPublicUsers(ctx)
+		if err != nil {
+			t.Fatalf("get public users: %v", err)
+		}
+
+		var common bool
+		for i, pu := range users {
+			if !pu.Public {
+				t.Errorf("user %s is not public", pu.Name)
+			}
+
+			if pu.ID == u.ID {
+				t.Errorf("created user %s is public", pu.Name)
+			}
+
+			if pu.Name == "common" {
+				common = true
+			}
+
+			if i > 0 && users[i-1].ID >= pu.ID {
+				t.Errorf("public users are not ordered by id: %d before %d", users[i-1].ID, pu.ID)
+			}
+		}
+
+		if !common {
+			t.Errorf("public user common is missing in %+v", users)
+		}
+	})
+
+	t.Run("session with oversized client info", func(t *testing.T) {
+		u := create(t, &User{Name: name("erin")})
+
+		session := Session{UserID: u.ID}
+		session.ClientIP, session.UserAgent = shared.ClientInfoFromContext(oversizedClientContext())
+		if err := s.CreateSession(ctx, &session); err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+
+		got, err := s.GetSession(ctx, session.ID)
+		if err != nil {
+			t.Fatalf("get session: %v", err)
+		}
+
+		if got.ClientIP != session.ClientIP || got.UserAgent != session.UserAgent {
+			t.Errorf("client info %q, %q, want %q, %q", got.ClientIP, got.UserAgent, session.ClientIP, session.UserAgent)
+		}
+	})
+
+	t.Run("device code with oversized client ip", func(t *testing.T) {
+		userCode, err := NewUserCode()
+		if err != nil {
+			t.Fatalf("new user code: %v", err)
+		}
+
+		code := DeviceCode{
+			CodeHash:  name("device"),
+			UserCode:  userCode,
+			Interval:  time.Second * 5,
+			ExpiresAt: time.Now().Add(time.Minute),
+		}
+		code.ClientIP, _ = shared.ClientInfoFromContext(oversizedClientContext())
+		if err := s.CreateDeviceCode(ctx, &code); err != nil {
+			t.Fatalf("create device code: %v", err)
+		}
+
+		got, err := s.GetDeviceCode(ctx, code.CodeHash)
+		if err != nil {
+			t.Fatalf("get device code: %v", err)
+		}
+
+		if got.ClientIP != code.ClientIP {
+			t.Errorf("client ip %q, want %q", got.ClientIP, code.ClientIP)
+		}
+	})
+
+	t.Run("concurrent magic links within limit", func(t *testing.T) {
+		const (
+			workers = 8
+			limit   = 3
+		)
+
+		u := create(t, &User{Name: name("frank")})
+
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			created int
+			limited int
+		)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				err := s.CreateMagicLink(ctx, &MagicLink{
+					TokenHash: fmt.Sprintf("%s_%d", name("link"), i),
+					UserID:    u.ID,
+					Email:     email("frank"),
+					ExpiresAt: time.Now().Add(time.Minute),
+				}, limit, time.Hour)
+
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case err == nil:
+					created++
+				case errors.Is(err, ErrLimitExceeded):
+					limited++
+				default:
+					t.Errorf("create magic link: %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if created != limit || limited != workers-limit {
+			t.Errorf("created %d, limited %d, want %d and %d", created, limited, limit, workers-limit)
+		}
+	})
+
+	t.Run("concurrent create", func(t *testing.T) {
+		const workers = 8
+
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			created int
+			exists  int
+		)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := s.Create(ctx, &User{Name: name("race")})
+
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case err == nil:
+					created++
+				case errors.Is(err, ErrAlreadyExist):
+					exists++
+				default:
+					t.Errorf("create: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if created != 1 || exists != workers-1 {
+			t.Errorf("created %d, already exist %d, want 1 and %d", created, exists, workers-1)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"crypto/rand"
+	"strings"
+	"time"
+)
+
+// userCodeAlphabet has no vowels and no characters easily confused, see RFC 8628 section 6.1.
+const (
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// Statuses of device codes.
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+)
+
+// DeviceCode is the pending device authorization, see RFC 8628.
+// The device polls by the device code, the user approves it by the short user code.
+type DeviceCode struct {
+	CodeHash   string
+	UserCode   string
+	ClientName string
+	ClientIP   string
+	Status     string
+	// UserID is the user approved or denied the code, zero while pending.
+	UserID int64
+	// Interval is the minimal time between polls, it grows when the device polls too often.
+	Interval  time.Duration
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// PolledAt is zero until the first poll.
+	PolledAt time.Time
+}
+
+// deviceCodeColumns lists device_codes columns in the order they are scanned.
+var deviceCodeColumns = []string{"code_hash", "user_code", "client_name", "client_ip", "status", "user_id", "poll_interval", "created_at", "expires_at", "polled_at"}
+
+func (c *DeviceCode) scanDest() []interface{} {
+	return []interface{}{&c.CodeHash, &c.UserCode, &c.ClientName, &c.ClientIP, &c.Status}
+}
+
+// NewUserCode returns random user code formatted as XXXX-XXXX.
+func NewUserCode() (string, error) {
+	code := make([]byte, 0, userCodeLength)
+	b := make([]byte, 1)
+	for len(code) < userCodeLength {
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+
+		// skip bytes making distribution uneven
+		if int(b[0]) >= 256-256%len(userCodeAlphabet) {
+			continue
+		}
+		code = append(code, userCodeAlphabet[int(b[0])%len(userCodeAlphabet)])
+	}
+
+	return string(code[:userCodeLength/2]) + "-" + string(code[userCodeLength/2:]), nil
+}
+
+// NormalizeUserCode converts user code entered by the user to the stored format,
+// case, dashes and spaces are ignored.
+func NormalizeUserCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	if len(code) != userCodeLength {
+		return code
+	}
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
@@ -1,8 +1,22 @@
 package db
 
+// MaxEmailLength is the size of email columns.
+const MaxEmailLength = 100
+
 type Email struct {
-	Email            string
-	Verified         bool
-	Primary          bool
-	VerificationCode string
+	Email            string `json:"email"`
+	Verified         bool   `json:"verified"`
+	Primary          bool   `json:"prim"`
+	VerificationCode string `json:"verification_code"`
+}
+
+// HasVerifiedEmail reports whether the email of the user is verified. Emails are compared exactly as storage compares them,
+// so the email the user is found by with GetByEmail is the one checked.
+func (u *User) HasVerifiedEmail(email string) bool {
+	for _, e := range u.Emails {
+		if e.Email == email && e.Verified {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,27 @@
+package db
+
+import "testing"
+
+func TestHasVerifiedEmail(t *testing.T) {
+	u := User{
+		Emails: []Email{
+			{Email: "alice@example.com", Verified: true},
+			{Email: "alice@example.org"},
+		},
+	}
+
+	for _, tc := range []struct {
+		email string
+		want  bool
+	}{
+		{"alice@example.com", true},
+		{"alice@example.org", false},
+		{"Alice@example.com", false},
+		{"bob@example.com", false},
+		{"", false},
+	} {
+		if got := u.HasVerifiedEmail(tc.email); got != tc.want {
+			t.Errorf("has verified email %q: %v, want %v", tc.email, got, tc.want)
+		}
+	}
+}
@@ -5,4 +5,6 @@ import "errors"
 var (
 	ErrNotExist     = errors.New("not exist")
 	ErrAlreadyExist = errors.New("already exist")
+	// ErrLimitExceeded is returned when a record isn't created as too many of them are created recently.
+	ErrLimitExceeded = errors.New("limit exceeded")
 )
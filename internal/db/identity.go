@@ -0,0 +1,25 @@
+package db
+
+import (
+	"time"
+)
+
+// Identity links the subject of upstream identity provider to the local user.
+type Identity struct {
+	Provider string
+	Subject  string
+	UserID   int64
+	// Email is the email claimed by the provider on the first login.
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+// MaxIdentitySubjectLength is the size of identities subject column.
+const MaxIdentitySubjectLength = 255
+
+// IdentityDirectory is the provider of identities linking directory entries to the users provisioned for them,
+// the subject is dn of the entry.
+const IdentityDirectory = "ldap"
+
+var identityColumns = []string{"provider", "subject", "user_id", "email", "created_at", "last_login_at"}
@@ -0,0 +1,19 @@
+package db
+
+import (
+	"time"
+)
+
+// MagicLink is a one-time login link sent to the verified email of the user.
+type MagicLink struct {
+	TokenHash string
+	UserID    int64
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// UsedAt is zero until the link is exchanged for a token.
+	UsedAt time.Time
+}
+
+// magicLinkColumns lists magic_links columns in the order they are scanned.
+var magicLinkColumns = []string{"token_hash", "user_id", "email", "created_at", "expires_at", "used_at"}
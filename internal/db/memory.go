@@ -0,0 +1,227 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryEmail struct {
+	// seq keeps insertion order of emails as postgres serial id does.
+	seq    int64
+	userID int64
+	email  Email
+}
+
+// Memory is an in-memory storage with the same semantics as Postgres.
+// It is intended for development and tests, data is lost on restart.
+type Memory struct {
+	mu           sync.RWMutex
+	lastID       int64
+	lastEmailSeq int64
+	users        map[int64]*User
+	names        map[string]int64
+	emails       map[string]*memoryEmail
+
+	auditEvents      []*AuditEvent
+	auditHeads       map[string]*AuditEvent
+	auditCheckpoints []*AuditCheckpoint
+
+	sessions map[string]*Session
+
+	oauthClients map[string]*OAuthClient
+	oauthCodes   map[string]*OAuthCode
+	oauthGrants  map[oauthGrantKey]*OAuthGrant
+
+	identities map[identityKey]*Identity
+
+	apiKeys map[string]*APIKey
+
+	deviceCodes map[string]*DeviceCode
+
+	magicLinks map[string]*MagicLink
+	// serviceAccounts by id, serviceAssertions are used assertion ids with expiration by account id.
+	serviceAccounts   map[string]*ServiceAccount
+	serviceAssertions map[string]map[string]time.Time
+}
+
+func NewMemory() *Memory {
+	m := Memory{
+		users:  make(map[int64]*User),
+		names:  make(map[string]int64),
+		emails: make(map[string]*memoryEmail),
+
+		auditHeads: make(map[string]*AuditEvent),
+
+		sessions: make(map[string]*Session),
+
+		oauthClients: make(map[string]*OAuthClient),
+		oauthCodes:   make(map[string]*OAuthCode),
+		oauthGrants:  make(map[oauthGrantKey]*OAuthGrant),
+
+		identities: make(map[identityKey]*Identity),
+
+		apiKeys: make(map[string]*APIKey),
+
+		deviceCodes: make(map[string]*DeviceCode),
+
+		magicLinks: make(map[string]*MagicLink),
+
+		serviceAccounts:   make(map[string]*ServiceAccount),
+		serviceAssertions: make(map[string]map[string]time.Time),
+	}
+
+	// same as the public users migration
+	m.insertUser(&User{
+		Name:   "common",
+		Public: true,
+	})
+
+	return &m
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+func (m *Memory) insertUser(u *User) int64 {
+	m.lastID++
+	m.users[m.lastID] = &User{
+		ID:     m.lastID,
+		Name:   u.Name,
+		Pwd:    u.Pwd,
+		Public: u.Public,
+	}
+	m.names[u.Name] = m.lastID
+	return m.lastID
+}
+
+func (m *Memory) addEmail(userID int64, e Email) {
+	if me, ok := m.emails[e.Email]; ok {
+		// keep the owner as postgres upsert does
+		me.email = e
+		return
+	}
+
+	m.lastEmailSeq++
+	m.emails[e.Email] = &memoryEmail{
+		seq:    m.lastEmailSeq,
+		userID: userID,
+		email:  e,
+	}
+}
+
+func (m *Memory) userByID(id int64) *User {
+	u, ok := m.users[id]
+	if !ok {
+		return nil
+	}
+
+	var emails []*memoryEmail
+	for _, me := range m.emails {
+		if me.userID == id {
+			emails = append(emails, me)
+		}
+	}
+
+	sort.Slice(emails, func(i, j int) bool {
+		return emails[i].seq < emails[j].seq
+	})
+
+	user := *u
+	user.Emails = make([]Email, 0, len(emails))
+	for _, me := range emails {
+		user.Emails = append(user.Emails, me.email)
+	}
+
+	return &user
+}
+
+func (m *Memory) GetByName(ctx context.Context, name string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.names[name]
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	return m.userByID(id), nil
+}
+
+func (m *Memory) GetByID(ctx context.Context, id int64) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user := m.userByID(id)
+	if user == nil {
+		return nil, ErrNotExist
+	}
+
+	return user, nil
+}
+
+func (m *Memory) GetByEmail(ctx context.Context, email string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	me, ok := m.emails[email]
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	return m.userByID(me.userID), nil
+}
+
+func (m *Memory) AddEmail(ctx context.Context, userID int64, e Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// postgres rejects emails of unknown users by foreign key
+	if _, ok := m.users[userID]; !ok {
+		return ErrNotExist
+	}
+
+	m.addEmail(userID, e)
+	return nil
+}
+
+func (m *Memory) Create(ctx context.Context, u *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.names[u.Name]; ok {
+		return ErrAlreadyExist
+	}
+
+	// public flag is not stored on creation, same as for postgres
+	u.ID = m.insertUser(&User{
+		Name: u.Name,
+		Pwd:  u.Pwd,
+	})
+
+	for _, e := range u.Emails {
+		m.addEmail(u.ID, e)
+	}
+
+	return nil
+}
+
+func (m *Memory) GetPublicUsers(ctx context.Context) ([]*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var users []*User
+	for id, u := range m.users {
+		if u.Public {
+			users = append(users, m.userByID(id))
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+
+	return users, nil
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"sort"
+)
+
+// CreateAPIKey stores new key, CreatedAt of k is set on success.
+func (m *Memory) CreateAPIKey(ctx context.Context, k *APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.apiKeys[k.ID]; ok {
+		return ErrAlreadyExist
+	}
+
+	if _, ok := m.users[k.UserID]; !ok {
+		return ErrNotExist
+	}
+
+	k.CreatedAt = now()
+
+	stored := *k
+	m.apiKeys[k.ID] = &stored
+	return nil
+}
+
+// GetAPIKey returns key by id including revoked and expired one.
+func (m *Memory) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	k, ok := m.apiKeys[id]
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	key := *k
+	return &key, nil
+}
+
+// ListAPIKeys returns not revoked keys of the user including expired ones, newest first.
+func (m *Memory) ListAPIKeys(ctx context.Context, userID int64) ([]*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var keys []*APIKey
+	for _, k := range m.apiKeys {
+		if k.UserID == userID && !k.IsRevoked() {
+			key := *k
+			keys = append(keys, &key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+// TouchAPIKey updates last used time of the active key.
+func (m *Memory) TouchAPIKey(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if k, ok := m.apiKeys[id]; ok && !k.IsRevoked() {
+		k.LastUsedAt = now()
+	}
+	return nil
+}
+
+// RevokeAPIKey revokes active key of the user, ErrNotExist is returned if there is no such key.
+func (m *Memory) RevokeAPIKey(ctx context.Context, userID int64, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k, ok := m.apiKeys[id]
+	if !ok || k.UserID != userID || k.IsRevoked() {
+		return ErrNotExist
+	}
+
+	k.RevokedAt = now()
+	return nil
+}
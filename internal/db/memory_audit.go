@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// AddAuditEvent appends audit event to the hash chain, ID, CreatedAt and hashes of e are set.
+func (m *Memory) AddAuditEvent(ctx context.Context, e *AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e.ID = int64(len(m.auditEvents) + 1)
+	e.Chain = e.auditChain()
+	e.link(m.auditHeads[e.Chain])
+
+	stored := *e
+	m.auditEvents = append(m.auditEvents, &stored)
+	m.auditHeads[e.Chain] = &stored
+	return nil
+}
+
+// ListAuditEvents returns audit events matching the filter newest first.
+func (m *Memory) ListAuditEvents(ctx context.Context, f AuditFilter) ([]*AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var events []*AuditEvent
+	for i := len(m.auditEvents) - 1; i >= 0 && len(events) < f.limit(); i-- {
+		if e := m.auditEvents[i]; f.matches(e) {
+			stored := *e
+			events = append(events, &stored)
+		}
+	}
+
+	return events, nil
+}
+
+// WalkAuditEvents calls fn for every audit event oldest first, stops on the first fn error.
+func (m *Memory) WalkAuditEvents(ctx context.Context, fn func(e *AuditEvent) error) error {
+	m.mu.RLock()
+	events := make([]AuditEvent, 0, len(m.auditEvents))
+	for _, e := range m.auditEvents {
+		events = append(events, *e)
+	}
+	m.mu.RUnlock()
+
+	for i := range events {
+		if err := fn(&events[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListAuditChainHeads returns the last event of every chain appended after the event with afterID oldest first.
+func (m *Memory) ListAuditChainHeads(ctx context.Context, afterID int64) ([]*AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var heads []*AuditEvent
+	for _, e := range m.auditEvents {
+		if head := m.auditHeads[e.Chain]; head == e && e.ID > afterID {
+			stored := *e
+			heads = append(heads, &stored)
+		}
+	}
+	return heads, nil
+}
+
+// AddAuditCheckpoint stores signed checkpoint, ID and CreatedAt of c are set.
+func (m *Memory) AddAuditCheckpoint(ctx context.Context, c *AuditCheckpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c.ID = int64(len(m.auditCheckpoints) + 1)
+	c.CreatedAt = time.Now().UTC()
+
+	stored := *c
+	m.auditCheckpoints = append(m.auditCheckpoints, &stored)
+	return nil
+}
+
+// ListAuditCheckpoints returns all checkpoints oldest first.
+func (m *Memory) ListAuditCheckpoints(ctx context.Context) ([]*AuditCheckpoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	checkpoints := make([]*AuditCheckpoint, 0, len(m.auditCheckpoints))
+	for _, c := range m.auditCheckpoints {
+		stored := *c
+		checkpoints = append(checkpoints, &stored)
+	}
+	return checkpoints, nil
+}
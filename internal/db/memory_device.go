@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// CreateDeviceCode stores new pending device code, Status and CreatedAt of c are set on success.
+func (m *Memory) CreateDeviceCode(ctx context.Context, c *DeviceCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.deviceCodes[c.CodeHash]; ok {
+		return ErrAlreadyExist
+	}
+
+	for _, stored := range m.deviceCodes {
+		if stored.UserCode == c.UserCode {
+			return ErrAlreadyExist
+		}
+	}
+
+	c.Status = DeviceCodePending
+	c.CreatedAt = now()
+
+	stored := *c
+	m.deviceCodes[c.CodeHash] = &stored
+	return nil
+}
+
+// GetDeviceCode returns device code by hash including expired one.
+func (m *Memory) GetDeviceCode(ctx context.Context, codeHash string) (*DeviceCode, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.deviceCodes[codeHash]
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	code := *c
+	return &code, nil
+}
+
+// GetDeviceCodeByUserCode returns device code by user code including expired one.
+func (m *Memory) GetDeviceCodeByUserCode(ctx context.Context, userCode string) (*DeviceCode, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, c := range m.deviceCodes {
+		if c.UserCode == userCode {
+			code := *c
+			return &code, nil
+		}
+	}
+
+	return nil, ErrNotExist
+}
+
+// DecideDeviceCode sets status of pending not expired code approved or denied by the user,
+// userID is zero if the code is denied anonymously. ErrNotExist is returned if there is no such code.
+func (m *Memory) DecideDeviceCode(ctx context.Context, userCode string, userID int64, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range m.deviceCodes {
+		if c.UserCode == userCode && c.Status == DeviceCodePending && c.ExpiresAt.After(now()) {
+			c.Status = status
+			c.UserID = userID
+			return nil
+		}
+	}
+
+	return ErrNotExist
+}
+
+// TouchDeviceCode records poll of the device and sets poll interval.
+func (m *Memory) TouchDeviceCode(ctx context.Context, codeHash string, interval time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if c, ok := m.deviceCodes[codeHash]; ok {
+		c.PolledAt = now()
+		c.Interval = interval
+	}
+	return nil
+}
+
+// ConsumeDeviceCode removes and returns approved or denied code, so the token is issued only once.
+// ErrNotExist is returned for unknown and pending codes.
+func (m *Memory) ConsumeDeviceCode(ctx context.Context, codeHash string) (*DeviceCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.deviceCodes[codeHash]
+	if !ok || c.Status == DeviceCodePending {
+		return nil, ErrNotExist
+	}
+
+	delete(m.deviceCodes, codeHash)
+	return c, nil
+}
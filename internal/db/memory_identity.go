@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+)
+
+type identityKey struct {
+	provider string
+	subject  string
+}
+
+// CreateIdentity links identity to the user, CreatedAt and LastLoginAt of i are set on success.
+func (m *Memory) CreateIdentity(ctx context.Context, i *Identity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := identityKey{
+		provider: i.Provider,
+		subject:  i.Subject,
+	}
+
+	if _, ok := m.identities[key]; ok {
+		return ErrAlreadyExist
+	}
+
+	if m.userByID(i.UserID) == nil {
+		return ErrNotExist
+	}
+
+	t := now()
+	i.CreatedAt = t
+	i.LastLoginAt = t
+
+	stored := *i
+	m.identities[key] = &stored
+	return nil
+}
+
+// GetIdentity returns identity by provider and subject.
+func (m *Memory) GetIdentity(ctx context.Context, provider string, subject string) (*Identity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i, ok := m.identities[identityKey{provider: provider, subject: subject}]
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	identity := *i
+	return &identity, nil
+}
+
+// TouchIdentity updates last login time of the identity.
+func (m *Memory) TouchIdentity(ctx context.Context, provider string, subject string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if i, ok := m.identities[identityKey{provider: provider, subject: subject}]; ok {
+		i.LastLoginAt = now()
+	}
+	return nil
+}
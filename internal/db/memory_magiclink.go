@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// CreateMagicLink stores new link unless limit links are sent to its email within the window already,
+// ErrLimitExceeded is returned then. CreatedAt of l is set on success.
+func (m *Memory) CreateMagicLink(ctx context.Context, l *MagicLink, limit int, window time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[l.UserID]; !ok {
+		return ErrNotExist
+	}
+
+	createdAt := now()
+	since := createdAt.Add(-window)
+
+	var count int
+	for _, stored := range m.magicLinks {
+		if stored.Email == l.Email && !stored.CreatedAt.Before(since) {
+			count++
+		}
+	}
+
+	if count >= limit {
+		return ErrLimitExceeded
+	}
+
+	l.CreatedAt = createdAt
+
+	stored := *l
+	m.magicLinks[l.TokenHash] = &stored
+	return nil
+}
+
+// ConsumeMagicLink marks unused link used and returns it, so it can be used only once.
+// Expired links are returned as well, the caller checks ExpiresAt.
+func (m *Memory) ConsumeMagicLink(ctx context.Context, tokenHash string) (*MagicLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.magicLinks[tokenHash]
+	if !ok || !l.UsedAt.IsZero() {
+		return nil, ErrNotExist
+	}
+
+	l.UsedAt = now()
+	link := *l
+	return &link, nil
+}
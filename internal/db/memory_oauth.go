@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+)
+
+type oauthGrantKey struct {
+	userID   int64
+	clientID string
+}
+
+// CreateOAuthClient stores new client, CreatedAt of c is set.
+func (m *Memory) CreateOAuthClient(ctx context.Context, c *OAuthClient) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.oauthClients[c.ID]; ok {
+		return ErrAlreadyExist
+	}
+
+	c.CreatedAt = now()
+
+	stored := *c
+	m.oauthClients[c.ID] = &stored
+	return nil
+}
+
+// GetOAuthClient returns client by id.
+func (m *Memory) GetOAuthClient(ctx context.Context, id string) (*OAuthClient, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.oauthClients[id]
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	client := *c
+	return &client, nil
+}
+
+// CreateOAuthCode stores authorization code.
+func (m *Memory) CreateOAuthCode(ctx context.Context, c *OAuthCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.oauthClients[c.ClientID]; !ok {
+		return ErrNotExist
+	}
+
+	stored := *c
+	m.oauthCodes[c.CodeHash] = &stored
+	return nil
+}
+
+// ConsumeOAuthCode removes and returns authorization code, so it can be used only once.
+// Expired codes are returned as well, the caller checks ExpiresAt.
+func (m *Memory) ConsumeOAuthCode(ctx context.Context, codeHash string) (*OAuthCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.oauthCodes[codeHash]
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	delete(m.oauthCodes, codeHash)
+	return c, nil
+}
+
+// SaveOAuthGrant creates or updates scopes the user approved for the client.
+func (m *Memory) SaveOAuthGrant(ctx context.Context, g *OAuthGrant) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := oauthGrantKey{
+		userID:   g.UserID,
+		clientID: g.ClientID,
+	}
+
+	t := now()
+	if stored, ok := m.oauthGrants[key]; ok {
+		stored.Scope = g.Scope
+		stored.UpdatedAt = t
+		return nil
+	}
+
+	m.oauthGrants[key] = &OAuthGrant{
+		UserID:    g.UserID,
+		ClientID:  g.ClientID,
+		Scope:     g.Scope,
+		CreatedAt: t,
+		UpdatedAt: t,
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// CreateServiceAccount stores new account, CreatedAt of a is set on success.
+func (m *Memory) CreateServiceAccount(ctx context.Context, a *ServiceAccount) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.serviceAccounts[a.ID]; ok {
+		return ErrAlreadyExist
+	}
+
+	for _, existing := range m.serviceAccounts {
+		if existing.Name == a.Name {
+			return ErrAlreadyExist
+		}
+	}
+
+	a.CreatedAt = now()
+
+	stored := *a
+	m.serviceAccounts[a.ID] = &stored
+	return nil
+}
+
+// GetServiceAccount returns account by id.
+func (m *Memory) GetServiceAccount(ctx context.Context, id string) (*ServiceAccount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	a, ok := m.serviceAccounts[id]
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	account := *a
+	return &account, nil
+}
+
+// ListServiceAccounts returns all accounts ordered by name.
+func (m *Memory) ListServiceAccounts(ctx context.Context) ([]*ServiceAccount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	accounts := make([]*ServiceAccount, 0, len(m.serviceAccounts))
+	for _, a := range m.serviceAccounts {
+		account := *a
+		accounts = append(accounts, &account)
+	}
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].Name < accounts[j].Name
+	})
+
+	return accounts, nil
+}
+
+// DeleteServiceAccount removes account, ErrNotExist is returned if there is no such account.
+func (m *Memory) DeleteServiceAccount(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.serviceAccounts[id]; !ok {
+		return ErrNotExist
+	}
+
+	delete(m.serviceAccounts, id)
+	delete(m.serviceAssertions, id)
+	return nil
+}
+
+// UseServiceAssertion records id of the assertion until it expires,
+// ErrAlreadyExist is returned if the assertion is already used. Expired ids of the account are removed.
+func (m *Memory) UseServiceAssertion(ctx context.Context, accountID string, jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.serviceAccounts[accountID]; !ok {
+		return ErrNotExist
+	}
+
+	assertions := m.serviceAssertions[accountID]
+	if assertions == nil {
+		assertions = make(map[string]time.Time)
+		m.serviceAssertions[accountID] = assertions
+	}
+
+	current := now()
+	for id, exp := range assertions {
+		if exp.Before(current) {
+			delete(assertions, id)
+		}
+	}
+
+	if _, ok := assertions[jti]; ok {
+		return ErrAlreadyExist
+	}
+
+	assertions[jti] = expiresAt
+	return nil
+}
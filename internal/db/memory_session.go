@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"sort"
+)
+
+// CreateSession stores new session of s.UserID, ID, CreatedAt and LastSeenAt of s are set.
+func (m *Memory) CreateSession(ctx context.Context, s *Session) error {
+	id, err := newSessionID()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[s.UserID]; !ok {
+		return ErrNotExist
+	}
+
+	s.ID = id
+	s.CreatedAt = now()
+	s.LastSeenAt = s.CreatedAt
+
+	stored := *s
+	m.sessions[id] = &stored
+	return nil
+}
+
+// GetSession returns session by id including revoked one.
+func (m *Memory) GetSession(ctx context.Context, id string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	session := *s
+	return &session, nil
+}
+
+// ListSessions returns active sessions of the user most recently seen first.
+func (m *Memory) ListSessions(ctx context.Context, userID int64) ([]*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var sessions []*Session
+	for _, s := range m.sessions {
+		if s.UserID == userID && !s.IsRevoked() {
+			session := *s
+			sessions = append(sessions, &session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+
+	return sessions, nil
+}
+
+// TouchSession updates last seen time of the active session.
+func (m *Memory) TouchSession(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.sessions[id]; ok && !s.IsRevoked() {
+		s.LastSeenAt = now()
+	}
+	return nil
+}
+
+// RevokeSession revokes active session of the user, ErrNotExist is returned if there is no such session.
+func (m *Memory) RevokeSession(ctx context.Context, userID int64, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok || s.UserID != userID || s.IsRevoked() {
+		return ErrNotExist
+	}
+
+	s.RevokedAt = now()
+	return nil
+}
+
+// RevokeOtherSessions revokes all active sessions of the user except exceptID and returns their ids.
+func (m *Memory) RevokeOtherSessions(ctx context.Context, userID int64, exceptID string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []string
+	revokedAt := now()
+	for id, s := range m.sessions {
+		if s.UserID == userID && id != exceptID && !s.IsRevoked() {
+			s.RevokedAt = revokedAt
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
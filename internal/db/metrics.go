@@ -0,0 +1,24 @@
+package db
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var queryDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "auth_repository_query_duration_seconds",
+		Help:    "Duration of repository operations partitioned by backend and operation.",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"backend", "operation"},
+)
+
+func init() {
+	prometheus.MustRegister(queryDuration)
+}
+
+func observeQuery(backend string, operation string, start time.Time) {
+	queryDuration.WithLabelValues(backend, operation).Observe(time.Since(start).Seconds())
+}
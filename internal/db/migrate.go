@@ -0,0 +1,81 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"sync"
+
+	"github.com/pressly/goose/v3"
+)
+
+const (
+	MigrateUp     = "up"
+	MigrateDown   = "down"
+	MigrateStatus = "status"
+)
+
+var (
+	//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+	migrationsFS embed.FS
+
+	// goose keeps dialect and file system in globals
+	gooseMu sync.Mutex
+)
+
+func runMigrations(database *sql.DB, dialect string, dir string, command string) error {
+	switch command {
+	case MigrateUp, MigrateDown, MigrateStatus:
+	default:
+		return fmt.Errorf("unsupported migrate command: %s", command)
+	}
+
+	gooseMu.Lock()
+	defer gooseMu.Unlock()
+
+	goose.SetBaseFS(migrationsFS)
+
+	if err := goose.SetDialect(dialect); err != nil {
+		return fmt.Errorf("set dialect error: %w", err)
+	}
+
+	if err := goose.Run(command, database, dir); err != nil {
+		return fmt.Errorf("migrate %s error: %w", command, err)
+	}
+
+	return nil
+}
+
+// checkMigrationsVersion verifies that database is migrated at least to the latest embedded migration.
+// Newer versions are applied by newer instances during rolling deploy, migrations keep schema compatible with older ones.
+func checkMigrationsVersion(database *sql.DB, dialect string, dir string) error {
+	gooseMu.Lock()
+	defer gooseMu.Unlock()
+
+	goose.SetBaseFS(migrationsFS)
+
+	if err := goose.SetDialect(dialect); err != nil {
+		return fmt.Errorf("set dialect error: %w", err)
+	}
+
+	migrations, err := goose.CollectMigrations(dir, 0, goose.MaxVersion)
+	if err != nil {
+		return fmt.Errorf("collect migrations error: %w", err)
+	}
+
+	last, err := migrations.Last()
+	if err != nil {
+		return fmt.Errorf("get last migration error: %w", err)
+	}
+
+	current, err := goose.GetDBVersion(database)
+	if err != nil {
+		return fmt.Errorf("get db version error: %w", err)
+	}
+
+	if current < last.Version {
+		return fmt.Errorf("db version %d, expected at least %d", current, last.Version)
+	}
+
+	return nil
+}
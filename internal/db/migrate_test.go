@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckMigrations(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("latest", func(t *testing.T) {
+		s := newTestSQLite(t)
+
+		if err := s.CheckMigrations(ctx); err != nil {
+			t.Errorf("check migrations: %v", err)
+		}
+	})
+
+	t.Run("newer", func(t *testing.T) {
+		s := newTestSQLite(t)
+
+		// a newer instance has applied migration this one doesn't know yet
+		if _, err := s.db.ExecContext(ctx, "INSERT INTO goose_db_version(version_id, is_applied) VALUES(?, ?)", 99990101000000, true); err != nil {
+			t.Fatalf("insert newer version: %v", err)
+		}
+
+		if err := s.CheckMigrations(ctx); err != nil {
+			t.Errorf("check migrations: %v", err)
+		}
+	})
+
+	t.Run("older", func(t *testing.T) {
+		s := newTestSQLite(t)
+
+		if err := s.Migrate(ctx, MigrateDown); err != nil {
+			t.Fatalf("migrate down: %v", err)
+		}
+
+		if err := s.CheckMigrations(ctx); err == nil {
+			t.Error("check migrations: no error for missing migration")
+		}
+	})
+}
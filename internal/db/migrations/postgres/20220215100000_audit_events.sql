@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE audit_events(
+    id BIGSERIAL PRIMARY KEY,
+    type varchar(50) NOT NULL,
+    user_id bigint NOT NULL DEFAULT 0,
+    user_name varchar(100) NOT NULL DEFAULT '',
+    actor_id bigint NOT NULL DEFAULT 0,
+    client_ip varchar(64) NOT NULL DEFAULT '',
+    user_agent varchar(256) NOT NULL DEFAULT '',
+    details text NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL
+);
+
+CREATE INDEX audit_events_user_id_idx ON audit_events(user_id, id);
+CREATE INDEX audit_events_created_at_idx ON audit_events(created_at);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE PROCEDURE audit_events_append_only();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE audit_events;
+DROP FUNCTION audit_events_append_only();
+-- +goose StatementEnd
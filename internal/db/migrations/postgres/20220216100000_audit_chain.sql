@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE audit_events
+    ADD COLUMN chain varchar(100) NOT NULL DEFAULT '',
+    ADD COLUMN seq bigint NOT NULL DEFAULT 0,
+    ADD COLUMN prev_hash varchar(64) NOT NULL DEFAULT '',
+    ADD COLUMN hash varchar(64) NOT NULL DEFAULT '';
+
+CREATE INDEX audit_events_chain_idx ON audit_events(chain, id);
+
+CREATE TABLE audit_checkpoints(
+    id BIGSERIAL PRIMARY KEY,
+    chain varchar(100) NOT NULL,
+    event_id bigint NOT NULL,
+    event_count bigint NOT NULL,
+    hash varchar(64) NOT NULL,
+    signature text NOT NULL,
+    created_at timestamptz NOT NULL
+);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_checkpoints_append_only BEFORE UPDATE OR DELETE ON audit_checkpoints
+    FOR EACH ROW EXECUTE PROCEDURE audit_events_append_only();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE audit_checkpoints;
+
+DROP INDEX audit_events_chain_idx;
+
+ALTER TABLE audit_events
+    DROP COLUMN chain,
+    DROP COLUMN seq,
+    DROP COLUMN prev_hash,
+    DROP COLUMN hash;
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE oauth_clients(
+    id varchar(64) PRIMARY KEY,
+    -- empty for public clients
+    secret_hash varchar(64) NOT NULL DEFAULT '',
+    token_endpoint_auth_method varchar(32) NOT NULL,
+    name varchar(100) NOT NULL,
+    redirect_uris text NOT NULL,
+    scopes text NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL
+);
+
+CREATE TABLE oauth_codes(
+    code_hash varchar(64) PRIMARY KEY,
+    client_id varchar(64) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id integer NOT NULL REFERENCES Users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    redirect_uri text NOT NULL,
+    scope text NOT NULL DEFAULT '',
+    code_challenge varchar(128) NOT NULL,
+    expires_at timestamptz NOT NULL
+);
+
+CREATE TABLE oauth_grants(
+    user_id integer NOT NULL REFERENCES Users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    client_id varchar(64) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    scope text NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL,
+    PRIMARY KEY(user_id, client_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE oauth_grants;
+DROP TABLE oauth_codes;
+DROP TABLE oauth_clients;
+-- +goose StatementEnd
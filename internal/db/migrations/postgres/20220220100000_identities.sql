@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE identities(
+    provider varchar(64) NOT NULL,
+    subject varchar(255) NOT NULL,
+    user_id integer NOT NULL REFERENCES Users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    email varchar(100) NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL,
+    last_login_at timestamptz NOT NULL,
+    PRIMARY KEY(provider, subject)
+);
+
+CREATE INDEX identities_user_id_idx ON identities(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE identities;
+-- +goose StatementEnd
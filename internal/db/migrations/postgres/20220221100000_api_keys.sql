@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE api_keys(
+    id varchar(32) PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES Users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    name varchar(100) NOT NULL,
+    secret_hash varchar(64) NOT NULL,
+    scopes text NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL,
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    revoked_at timestamptz
+);
+
+CREATE INDEX api_keys_user_id_idx ON api_keys(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE api_keys;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE magic_links(
+    token_hash varchar(64) PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES Users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    email varchar(100) NOT NULL,
+    created_at timestamptz NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz
+);
+
+CREATE INDEX magic_links_email_created_at_idx ON magic_links(email, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE magic_links;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE Users(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name varchar(100) UNIQUE,
+    password varchar(100),
+    public boolean DEFAULT FALSE
+);
+
+CREATE TABLE Emails(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    userID integer REFERENCES Users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    email varchar(100) UNIQUE,
+    prim boolean,
+    verified boolean,
+    verification_code varchar(50)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE Emails;
+DROP TABLE Users;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE audit_events(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type varchar(50) NOT NULL,
+    user_id integer NOT NULL DEFAULT 0,
+    user_name varchar(100) NOT NULL DEFAULT '',
+    actor_id integer NOT NULL DEFAULT 0,
+    client_ip varchar(64) NOT NULL DEFAULT '',
+    user_agent varchar(256) NOT NULL DEFAULT '',
+    details text NOT NULL DEFAULT '',
+    -- unix time in nanoseconds
+    created_at integer NOT NULL
+);
+
+CREATE INDEX audit_events_user_id_idx ON audit_events(user_id, id);
+CREATE INDEX audit_events_created_at_idx ON audit_events(created_at);
+
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE audit_events;
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE audit_events ADD COLUMN chain varchar(100) NOT NULL DEFAULT '';
+ALTER TABLE audit_events ADD COLUMN seq integer NOT NULL DEFAULT 0;
+ALTER TABLE audit_events ADD COLUMN prev_hash varchar(64) NOT NULL DEFAULT '';
+ALTER TABLE audit_events ADD COLUMN hash varchar(64) NOT NULL DEFAULT '';
+
+CREATE INDEX audit_events_chain_idx ON audit_events(chain, id);
+
+CREATE TABLE audit_checkpoints(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chain varchar(100) NOT NULL,
+    event_id integer NOT NULL,
+    event_count integer NOT NULL,
+    hash varchar(64) NOT NULL,
+    signature text NOT NULL,
+    -- unix time in nanoseconds
+    created_at integer NOT NULL
+);
+
+CREATE TRIGGER audit_checkpoints_no_update BEFORE UPDATE ON audit_checkpoints
+BEGIN
+    SELECT RAISE(ABORT, 'audit_checkpoints is append-only');
+END;
+
+CREATE TRIGGER audit_checkpoints_no_delete BEFORE DELETE ON audit_checkpoints
+BEGIN
+    SELECT RAISE(ABORT, 'audit_checkpoints is append-only');
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE audit_checkpoints;
+DROP INDEX audit_events_chain_idx;
+ALTER TABLE audit_events DROP COLUMN hash;
+ALTER TABLE audit_events DROP COLUMN prev_hash;
+ALTER TABLE audit_events DROP COLUMN seq;
+ALTER TABLE audit_events DROP COLUMN chain;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE sessions(
+    id varchar(64) PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES Users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    user_agent varchar(256) NOT NULL DEFAULT '',
+    client_ip varchar(64) NOT NULL DEFAULT '',
+    -- unix time in nanoseconds
+    created_at integer NOT NULL,
+    last_seen_at integer NOT NULL,
+    revoked_at integer
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE sessions;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- nonce of openid connect authorization request, returned in the id token
+ALTER TABLE oauth_codes ADD COLUMN nonce varchar(255) NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE oauth_codes DROP COLUMN nonce;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE api_keys(
+    id varchar(32) PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES Users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    name varchar(100) NOT NULL,
+    secret_hash varchar(64) NOT NULL,
+    scopes text NOT NULL DEFAULT '',
+    -- unix time in nanoseconds
+    created_at integer NOT NULL,
+    expires_at integer,
+    last_used_at integer,
+    revoked_at integer
+);
+
+CREATE INDEX api_keys_user_id_idx ON api_keys(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE api_keys;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE device_codes(
+    code_hash varchar(64) PRIMARY KEY,
+    user_code varchar(16) NOT NULL UNIQUE,
+    client_name varchar(100) NOT NULL DEFAULT '',
+    client_ip varchar(64) NOT NULL DEFAULT '',
+    status varchar(16) NOT NULL,
+    -- user approved or denied the code
+    user_id integer REFERENCES Users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    -- seconds
+    poll_interval integer NOT NULL,
+    -- unix time in nanoseconds
+    created_at integer NOT NULL,
+    expires_at integer NOT NULL,
+    polled_at integer
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE device_codes;
+-- +goose StatementEnd
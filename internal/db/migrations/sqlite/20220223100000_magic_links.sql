@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE magic_links(
+    token_hash varchar(64) PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES Users(id) ON DELETE CASCADE ON UPDATE CASCADE,
+    email varchar(100) NOT NULL,
+    -- unix time in nanoseconds
+    created_at integer NOT NULL,
+    expires_at integer NOT NULL,
+    used_at integer
+);
+
+CREATE INDEX magic_links_email_created_at_idx ON magic_links(email, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE magic_links;
+-- +goose StatementEnd
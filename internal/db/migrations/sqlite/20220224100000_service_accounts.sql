@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE service_accounts(
+    id varchar(64) PRIMARY KEY,
+    name varchar(100) NOT NULL UNIQUE,
+    -- empty for accounts authenticated by private key
+    secret_hash varchar(64) NOT NULL DEFAULT '',
+    public_key text NOT NULL DEFAULT '',
+    scopes text NOT NULL DEFAULT '',
+    -- unix time in nanoseconds
+    created_at integer NOT NULL
+);
+
+-- ids of used assertions, kept until they expire to reject replays
+CREATE TABLE service_assertions(
+    account_id varchar(64) NOT NULL REFERENCES service_accounts(id) ON DELETE CASCADE,
+    jti varchar(256) NOT NULL,
+    expires_at integer NOT NULL,
+    PRIMARY KEY(account_id, jti)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE service_assertions;
+DROP TABLE service_accounts;
+-- +goose StatementEnd
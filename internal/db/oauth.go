@@ -0,0 +1,66 @@
+package db
+
+import (
+	"strings"
+	"time"
+)
+
+// OAuthClient is a third-party application registered for delegated access.
+type OAuthClient struct {
+	ID string
+	// SecretHash is empty for public clients, which authenticate by PKCE only.
+	SecretHash string
+	// AuthMethod is the token_endpoint_auth_method the client registered, see RFC 7591 section 2.
+	AuthMethod   string
+	Name         string
+	RedirectURIs []string
+	Scopes       []string
+	CreatedAt    time.Time
+}
+
+const (
+	// MaxNonceLength is the size of oauth_codes nonce column.
+	MaxNonceLength = 255
+	// MaxCodeChallengeLength is the size of oauth_codes code_challenge column.
+	MaxCodeChallengeLength = 128
+)
+
+// OAuthCode is a single-use authorization code issued to the client on user approval.
+type OAuthCode struct {
+	CodeHash      string
+	ClientID      string
+	UserID        int64
+	RedirectURI   string
+	Scope         string
+	CodeChallenge string
+	ExpiresAt     time.Time
+	// Nonce is the openid connect nonce of the authorization request.
+	Nonce string
+}
+
+// OAuthGrant records scopes the user has approved for the client.
+type OAuthGrant struct {
+	UserID    int64
+	ClientID  string
+	Scope     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+var (
+	oauthClientColumns = []string{"id", "secret_hash", "token_endpoint_auth_method", "name", "redirect_uris", "scopes", "created_at"}
+	oauthCodeColumns   = []string{"code_hash", "client_id", "user_id", "redirect_uri", "scope", "code_challenge", "expires_at", "nonce"}
+	oauthGrantColumns  = []string{"user_id", "client_id", "scope", "created_at", "updated_at"}
+)
+
+// redirect uris can't contain spaces or newlines, so lists are stored joined.
+func joinList(values []string) string {
+	return strings.Join(values, "\n")
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, "\n")
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type Option func(o *options)
+
+type options struct {
+	queryTimeout time.Duration
+	replicas     []string
+	pool         PoolOptions
+}
+
+// PoolOptions are connection pool settings, zero value keeps database/sql default.
+type PoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+func (po PoolOptions) apply(database *sql.DB) {
+	if po.MaxOpenConns > 0 {
+		database.SetMaxOpenConns(po.MaxOpenConns)
+	}
+
+	if po.MaxIdleConns > 0 {
+		database.SetMaxIdleConns(po.MaxIdleConns)
+	}
+
+	if po.ConnMaxLifetime > 0 {
+		database.SetConnMaxLifetime(po.ConnMaxLifetime)
+	}
+
+	if po.ConnMaxIdleTime > 0 {
+		database.SetConnMaxIdleTime(po.ConnMaxIdleTime)
+	}
+}
+
+func makeOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithQueryTimeout limits the duration of every query (or transaction) issued by the storage.
+// Zero timeout means that only the caller context is taken into account.
+func WithQueryTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.queryTimeout = timeout
+	}
+}
+
+// WithReplicas sets connection strings of read only replicas, supported by Postgres only.
+func WithReplicas(connectionStrs []string) Option {
+	return func(o *options) {
+		o.replicas = connectionStrs
+	}
+}
+
+// WithPool sets connection pool settings for postgres primary and replicas.
+// SQLite always uses single connection.
+func WithPool(po PoolOptions) Option {
+	return func(o *options) {
+		o.pool = po
+	}
+}
+
+func (o options) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, o.queryTimeout)
+}
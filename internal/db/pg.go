@@ -1,96 +1,208 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type Postgres struct {
-	db *sql.DB
+	db            *sql.DB
+	conn          Transaction
+	replicas      *replicaSet
+	opts          options
+	connectionStr string
 }
 
-func NewPostgres(connectionStr string) (*Postgres, error) {
+func NewPostgres(connectionStr string, opts ...Option) (*Postgres, error) {
 	pgDB, err := sql.Open("postgres", connectionStr)
 	if err != nil {
 		return nil, err
 	}
 
+	p := Postgres{
+		db:            pgDB,
+		conn:          traceConn("postgres", pgDB),
+		opts:          makeOptions(opts),
+		connectionStr: connectionStr,
+	}
+
+	p.opts.pool.apply(pgDB)
+
 	if err = pgDB.Ping(); err != nil {
+		pgDB.Close()
 		return nil, err
 	}
 
-	return &Postgres{
-		db: pgDB,
-	}, nil
+	if len(p.opts.replicas) > 0 {
+		p.replicas, err = newReplicaSet(p.opts.replicas, p.opts.pool)
+		if err != nil {
+			pgDB.Close()
+			return nil, fmt.Errorf("unable to open replicas: %w", err)
+		}
+	}
+
+	return &p, nil
 }
 
 func (p *Postgres) Close() error {
+	if p.replicas != nil {
+		p.replicas.Close()
+	}
+
 	return p.db.Close()
 }
 
-func (p *Postgres) emailsByUserID(userID int64) ([]Email, error) {
-	rows, err := p.db.Query("SELECT email, prim, verified, verification_code FROM Emails WHERE userID = $1", userID)
-	if err != nil {
-		return nil, err
+// Ping checks primary database availability.
+func (p *Postgres) Ping(ctx context.Context) error {
+	return p.db.PingContext(ctx)
+}
+
+// StatsCollector returns prometheus collector of connection pool statistics for primary and replicas.
+func (p *Postgres) StatsCollector() prometheus.Collector {
+	dbs := map[string]*sql.DB{
+		"primary": p.db,
 	}
-	defer rows.Close()
 
-	emails := []Email{}
-	for rows.Next() {
-		e := Email{}
-		if err := rows.Scan(&e.Email, &e.Primary, &e.Verified, &e.VerificationCode); err != nil {
-			return nil, err
+	if p.replicas != nil {
+		for i, r := range p.replicas.replicas {
+			dbs[fmt.Sprintf("replica_%d", i)] = r.db
 		}
-		emails = append(emails, e)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+	return newStatsCollector(dbs)
+}
+
+// read runs read only query fn on replica if any is healthy, falls back to primary if replica fails.
+// Reads within WithPrimary context or of recently written key are always served by primary.
+func (p *Postgres) read(ctx context.Context, key string, fn func(q Transaction) error) error {
+	if p.replicas != nil && !isPrimaryRequired(ctx) && !p.replicas.isRecentlyWritten(key) {
+		if r := p.replicas.pick(); r != nil {
+			err := fn(traceConn("postgres", r.db))
+			if !isReplicaFailure(err) {
+				return err
+			}
+			r.setHealthy(false)
+		}
+	}
+
+	return fn(p.conn)
+}
+
+func (p *Postgres) written(key string) {
+	if p.replicas != nil {
+		p.replicas.written(key)
+	}
+}
+
+// migrationLockID is the key of postgres advisory lock held while migrations are applied,
+// so several replicas starting at the same time don't race.
+const migrationLockID = 6231942183
+
+// Migrate runs migrate command (up, down, status) against the embedded postgres migrations.
+// Advisory lock is held by the session, so migrations run on the same single connection
+// opened apart from the pool, whatever the pool size is.
+func (p *Postgres) Migrate(ctx context.Context, command string) error {
+	lockDB, err := sql.Open("postgres", p.connectionStr)
+	if err != nil {
+		return fmt.Errorf("unable to open migration connection: %w", err)
+	}
+	defer lockDB.Close()
+
+	lockDB.SetMaxOpenConns(1)
+	lockDB.SetMaxIdleConns(1)
+
+	if _, err := lockDB.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("unable to acquire migration lock: %w", err)
 	}
+	defer lockDB.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	return runMigrations(lockDB, "postgres", "migrations/postgres", command)
+}
+
+// CheckMigrations verifies that all embedded migrations are applied.
+func (p *Postgres) CheckMigrations(ctx context.Context) error {
+	return checkMigrationsVersion(p.db, "postgres", "migrations/postgres")
+}
 
-	return emails, nil
+func (p *Postgres) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return p.opts.withTimeout(ctx)
 }
 
-func (p *Postgres) userByQuery(query string, args ...interface{}) (*User, error) {
-	row := p.db.QueryRow(query, args...)
+// pgUsersQuery selects users with emails aggregated into json array, should be followed by WHERE and GROUP BY Users.id.
+var pgUsersQuery = "SELECT " + qualifiedColumns("Users", userColumns) + ", " +
+	"COALESCE(json_agg(json_build_object('email', Emails.email, 'prim', Emails.prim, 'verified', Emails.verified, 'verification_code', Emails.verification_code) ORDER BY Emails.id) " +
+	"FILTER (WHERE Emails.id IS NOT NULL), '[]') " +
+	"FROM Users LEFT JOIN Emails ON Emails.userID = Users.id"
 
-	user := User{}
-	err := row.Scan(&user.ID, &user.Name, &user.Pwd, &user.Public)
+func (p *Postgres) userByQuery(ctx context.Context, q Transaction, query string, args ...interface{}) (*User, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
 
+	user, err := scanUser(q.QueryRowContext(ctx, query, args...))
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, ErrNotExist
 	} else if err != nil {
 		return nil, err
 	}
 
-	emails, err := p.emailsByUserID(user.ID)
-	if err != nil {
-		return nil, err
-	}
-	user.Emails = emails
+	return user, nil
+}
+
+func (p *Postgres) GetByName(ctx context.Context, name string) (*User, error) {
+	defer observeQuery("postgres", "get_by_name", time.Now())
 
-	return &user, nil
+	var user *User
+	err := p.read(ctx, name, func(q Transaction) error {
+		var err error
+		user, err = p.userByQuery(ctx, q, pgUsersQuery+" WHERE Users.name = $1 GROUP BY Users.id", name)
+		return err
+	})
+	return user, err
 }
 
-func (p *Postgres) GetByName(name string) (*User, error) {
-	return p.userByQuery("SELECT * FROM Users WHERE name = $1", name)
+func (p *Postgres) GetByID(ctx context.Context, id int64) (*User, error) {
+	defer observeQuery("postgres", "get_by_id", time.Now())
+
+	var user *User
+	err := p.read(ctx, userIDKey(id), func(q Transaction) error {
+		var err error
+		user, err = p.userByQuery(ctx, q, pgUsersQuery+" WHERE Users.id = $1 GROUP BY Users.id", id)
+		return err
+	})
+	return user, err
 }
 
-func (p *Postgres) GetByEmail(email string) (*User, error) {
-	return p.userByQuery("SELECT * FROM Users WHERE Users.id = (SELECT userID FROM Emails WHERE email = $1)", email)
+func (p *Postgres) GetByEmail(ctx context.Context, email string) (*User, error) {
+	defer observeQuery("postgres", "get_by_email", time.Now())
+
+	return p.userByQuery(ctx, p.conn, pgUsersQuery+" WHERE Users.id = (SELECT userID FROM Emails WHERE email = $1) GROUP BY Users.id", email)
 }
 
-func (p *Postgres) addEmailTx(userID int64, e Email, tx Transaction) error {
-	_, err := tx.Exec("INSERT INTO Emails(userID, email, prim, verified, verification_code) VALUES($1, $2, $3, $4, $5)"+
-		"ON CONFLICT(email) DO UPDATE SET email = excluded.email, prim = excluded.prim, verified = excluded.verified, verification_code = excluded.verification_code",
-		userID, e.Email, e.Primary, e.Verified, e.VerificationCode)
+func (p *Postgres) addEmailTx(ctx context.Context, userID int64, e Email, tx Transaction) error {
+	query := "INSERT INTO Emails(userID, email, prim, verified, verification_code) VALUES($1, $2, $3, $4, $5)" +
+		"ON CONFLICT(email) DO UPDATE SET email = excluded.email, prim = excluded.prim, verified = excluded.verified, verification_code = excluded.verification_code"
+
+	_, err := tx.ExecContext(ctx, query, userID, e.Email, e.Primary, e.Verified, e.VerificationCode)
 	return err
 }
 
-func (p *Postgres) AddEmail(userID int64, e Email) error {
-	return p.addEmailTx(userID, e, p.db)
+func (p *Postgres) AddEmail(ctx context.Context, userID int64, e Email) error {
+	defer observeQuery("postgres", "add_email", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	err := p.addEmailTx(ctx, userID, e, p.conn)
+	if isForeignKeyViolationError(err) {
+		return ErrNotExist
+	}
+	return err
 }
 
 func isUniqueViolationError(err error) bool {
@@ -103,10 +215,34 @@ func isUniqueViolationError(err error) bool {
 	return false
 }
 
-func (p *Postgres) Create(u *User) error {
-	return WithTransaction(p.db, func(tx Transaction) error {
+func isForeignKeyViolationError(err error) bool {
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
+		if pgErr.Code == "23503" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Postgres) Create(ctx context.Context, u *User) error {
+	defer observeQuery("postgres", "create", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	defer p.written(u.Name)
+	defer func() {
+		if u.ID != 0 {
+			p.written(userIDKey(u.ID))
+		}
+	}()
+
+	return WithTransaction(ctx, p.conn, func(tx Transaction) error {
+		query := "INSERT INTO Users(name, password) VALUES($1, $2) RETURNING id"
+
 		var id int64
-		err := tx.QueryRow("INSERT INTO Users(name, password) VALUES($1, $2) RETURNING id", u.Name, u.Pwd).Scan(&id)
+		err := tx.QueryRowContext(ctx, query, u.Name, u.Pwd).Scan(&id)
 		if err != nil {
 			if isUniqueViolationError(err) {
 				return ErrAlreadyExist
@@ -117,7 +253,7 @@ func (p *Postgres) Create(u *User) error {
 		u.ID = id
 
 		for _, e := range u.Emails {
-			err := p.addEmailTx(id, e, tx)
+			err := p.addEmailTx(ctx, id, e, tx)
 			if err != nil {
 				return err
 			}
@@ -127,8 +263,25 @@ func (p *Postgres) Create(u *User) error {
 	})
 }
 
-func (p *Postgres) GetPublicUsers() ([]*User, error) {
-	rows, err := p.db.Query("SELECT * FROM Users WHERE public = TRUE")
+func (p *Postgres) GetPublicUsers(ctx context.Context) ([]*User, error) {
+	defer observeQuery("postgres", "get_public_users", time.Now())
+
+	var users []*User
+	err := p.read(ctx, "", func(q Transaction) error {
+		var err error
+		users, err = p.publicUsers(ctx, q)
+		return err
+	})
+	return users, err
+}
+
+func (p *Postgres) publicUsers(ctx context.Context, q Transaction) ([]*User, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	query := pgUsersQuery + " WHERE Users.public = TRUE GROUP BY Users.id ORDER BY Users.id"
+
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -137,13 +290,51 @@ func (p *Postgres) GetPublicUsers() ([]*User, error) {
 
 	var users []*User
 	for rows.Next() {
-		user := User{}
-		if err := rows.Scan(&user.ID, &user.Name, &user.Pwd, &user.Public); err != nil {
+		user, err := scanUser(rows)
+		if err != nil {
 			return nil, err
 		}
 
-		users = append(users, &user)
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
 	return users, nil
 }
+
+// CheckSchema verifies that table columns match the ones used by queries.
+func (p *Postgres) CheckSchema(ctx context.Context) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	for table, expected := range schemaTables {
+		rows, err := p.conn.QueryContext(ctx, "SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1", table)
+		if err != nil {
+			return err
+		}
+
+		var actual []string
+		for rows.Next() {
+			var column string
+			if err := rows.Scan(&column); err != nil {
+				rows.Close()
+				return err
+			}
+			actual = append(actual, column)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if err := compareColumns(table, expected, actual); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// CreateAPIKey stores new key, CreatedAt of k is set on success.
+func (p *Postgres) CreateAPIKey(ctx context.Context, k *APIKey) error {
+	defer observeQuery("postgres", "create_api_key", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	expiresAt := sql.NullTime{
+		Time:  k.ExpiresAt,
+		Valid: !k.ExpiresAt.IsZero(),
+	}
+
+	createdAt := now()
+	_, err := p.conn.ExecContext(ctx, "INSERT INTO api_keys(id, user_id, name, secret_hash, scopes, created_at, expires_at) VALUES($1, $2, $3, $4, $5, $6, $7)",
+		k.ID, k.UserID, k.Name, k.SecretHash, joinList(k.Scopes), createdAt, expiresAt)
+	if err != nil {
+		if isUniqueViolationError(err) {
+			return ErrAlreadyExist
+		}
+		return err
+	}
+
+	k.CreatedAt = createdAt
+	return nil
+}
+
+func scanPGAPIKey(r rowScanner) (*APIKey, error) {
+	var (
+		k                                APIKey
+		scopes                           string
+		expiresAt, lastUsedAt, revokedAt sql.NullTime
+	)
+	if err := r.Scan(append(k.scanDest(), &scopes, &k.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt)...); err != nil {
+		return nil, err
+	}
+
+	k.Scopes = splitList(scopes)
+	k.CreatedAt = k.CreatedAt.UTC()
+	if expiresAt.Valid {
+		k.ExpiresAt = expiresAt.Time.UTC()
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = lastUsedAt.Time.UTC()
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = revokedAt.Time.UTC()
+	}
+	return &k, nil
+}
+
+// GetAPIKey returns key by id including revoked and expired one.
+func (p *Postgres) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	defer observeQuery("postgres", "get_api_key", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	k, err := scanPGAPIKey(p.conn.QueryRowContext(ctx, "SELECT "+strings.Join(apiKeyColumns, ", ")+" FROM api_keys WHERE id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// ListAPIKeys returns not revoked keys of the user including expired ones, newest first.
+func (p *Postgres) ListAPIKeys(ctx context.Context, userID int64) ([]*APIKey, error) {
+	defer observeQuery("postgres", "list_api_keys", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.conn.QueryContext(ctx, "SELECT "+strings.Join(apiKeyColumns, ", ")+" FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var keys []*APIKey
+	for rows.Next() {
+		k, err := scanPGAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// TouchAPIKey updates last used time of the active key.
+func (p *Postgres) TouchAPIKey(ctx context.Context, id string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.conn.ExecContext(ctx, "UPDATE api_keys SET last_used_at = $1 WHERE id = $2 AND revoked_at IS NULL", now(), id)
+	return err
+}
+
+// RevokeAPIKey revokes active key of the user, ErrNotExist is returned if there is no such key.
+func (p *Postgres) RevokeAPIKey(ctx context.Context, userID int64, id string) error {
+	defer observeQuery("postgres", "revoke_api_key", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.conn.ExecContext(ctx, "UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL", now(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotExist
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// auditChainLockClass is the first key of postgres advisory locks serializing appends to audit chains,
+// the second key is the hash of the chain name, so only appends to the same chain wait for each other.
+const auditChainLockClass = 623194218
+
+// AddAuditEvent appends audit event to the hash chain, ID, CreatedAt and hashes of e are set on success.
+func (p *Postgres) AddAuditEvent(ctx context.Context, e *AuditEvent) error {
+	defer observeQuery("postgres", "add_audit_event", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	e.Chain = e.auditChain()
+
+	return WithTransaction(ctx, p.conn, func(tx Transaction) error {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1, hashtext($2))", auditChainLockClass, e.Chain); err != nil {
+			return err
+		}
+
+		var prev AuditEvent
+		err := tx.QueryRowContext(ctx, "SELECT seq, hash FROM audit_events WHERE chain = $1 ORDER BY id DESC LIMIT 1", e.Chain).Scan(&prev.Seq, &prev.Hash)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			e.link(nil)
+		case err != nil:
+			return err
+		default:
+			e.link(&prev)
+		}
+
+		query := "INSERT INTO audit_events(type, user_id, user_name, actor_id, client_ip, user_agent, details, chain, seq, prev_hash, hash, created_at) " +
+			"VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id"
+
+		err = tx.QueryRowContext(ctx, query, e.Type, e.UserID, e.UserName, e.ActorID, e.ClientIP, e.UserAgent, e.Details, e.Chain, e.Seq, e.PrevHash, e.Hash, e.CreatedAt).Scan(&e.ID)
+		return err
+	})
+}
+
+func pgPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func pgTime(t time.Time) interface{} {
+	return t
+}
+
+// ListAuditEvents returns audit events matching the filter newest first.
+func (p *Postgres) ListAuditEvents(ctx context.Context, f AuditFilter) ([]*AuditEvent, error) {
+	defer observeQuery("postgres", "list_audit_events", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	query, args := auditQuery(f, pgPlaceholder, pgTime)
+
+	var events []*AuditEvent
+	err := p.scanAuditEvents(ctx, query, args, func(e *AuditEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// WalkAuditEvents calls fn for every audit event oldest first, stops on the first fn error.
+func (p *Postgres) WalkAuditEvents(ctx context.Context, fn func(e *AuditEvent) error) error {
+	return p.scanAuditEvents(ctx, "SELECT "+strings.Join(auditColumns, ", ")+" FROM audit_events ORDER BY id", nil, fn)
+}
+
+// ListAuditChainHeads returns the last event of every chain appended after the event with afterID oldest first.
+func (p *Postgres) ListAuditChainHeads(ctx context.Context, afterID int64) ([]*AuditEvent, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var events []*AuditEvent
+	err := p.scanAuditEvents(ctx, auditChainHeadsQuery("$1"), []interface{}{afterID}, func(e *AuditEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (p *Postgres) scanAuditEvents(ctx context.Context, query string, args []interface{}, fn func(e *AuditEvent) error) error {
+	rows, err := p.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var e AuditEvent
+		if err := rows.Scan(append(e.scanDest(), &e.CreatedAt)...); err != nil {
+			return err
+		}
+		e.CreatedAt = e.CreatedAt.UTC()
+
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// AddAuditCheckpoint stores signed checkpoint, ID and CreatedAt of c are set on success.
+func (p *Postgres) AddAuditCheckpoint(ctx context.Context, c *AuditCheckpoint) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	createdAt := now()
+	err := p.conn.QueryRowContext(ctx, "INSERT INTO audit_checkpoints(chain, event_id, event_count, hash, signature, created_at) VALUES($1, $2, $3, $4, $5, $6) RETURNING id",
+		c.Chain, c.EventID, c.Count, c.Hash, c.Signature, createdAt).Scan(&c.ID)
+	if err != nil {
+		return err
+	}
+
+	c.CreatedAt = createdAt
+	return nil
+}
+
+// ListAuditCheckpoints returns all checkpoints oldest first.
+func (p *Postgres) ListAuditCheckpoints(ctx context.Context) ([]*AuditCheckpoint, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.conn.QueryContext(ctx, "SELECT "+strings.Join(checkpointColumns, ", ")+" FROM audit_checkpoints ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var checkpoints []*AuditCheckpoint
+	for rows.Next() {
+		var c AuditCheckpoint
+		if err := rows.Scan(append(c.scanDest(), &c.CreatedAt)...); err != nil {
+			return nil, err
+		}
+		c.CreatedAt = c.CreatedAt.UTC()
+		checkpoints = append(checkpoints, &c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return checkpoints, nil
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// CreateDeviceCode stores new pending device code, Status and CreatedAt of c are set on success.
+func (p *Postgres) CreateDeviceCode(ctx context.Context, c *DeviceCode) error {
+	defer observeQuery("postgres", "create_device_code", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	createdAt := now()
+	_, err := p.conn.ExecContext(ctx, "INSERT INTO device_codes(code_hash, user_code, client_name, client_ip, status, poll_interval, created_at, expires_at) VALUES($1, $2, $3, $4, $5, $6, $7, $8)",
+		c.CodeHash, c.UserCode, c.ClientName, c.ClientIP, DeviceCodePending, int64(c.Interval/time.Second), createdAt, c.ExpiresAt)
+	if err != nil {
+		if isUniqueViolationError(err) {
+			return ErrAlreadyExist
+		}
+		return err
+	}
+
+	c.Status = DeviceCodePending
+	c.CreatedAt = createdAt
+	return nil
+}
+
+func scanPGDeviceCode(r rowScanner) (*DeviceCode, error) {
+	var (
+		c        DeviceCode
+		userID   sql.NullInt64
+		interval int64
+		polledAt sql.NullTime
+	)
+	if err := r.Scan(append(c.scanDest(), &userID, &interval, &c.CreatedAt, &c.ExpiresAt, &polledAt)...); err != nil {
+		return nil, err
+	}
+
+	c.UserID = userID.Int64
+	c.Interval = time.Duration(interval) * time.Second
+	c.CreatedAt = c.CreatedAt.UTC()
+	c.ExpiresAt = c.ExpiresAt.UTC()
+	if polledAt.Valid {
+		c.PolledAt = polledAt.Time.UTC()
+	}
+	return &c, nil
+}
+
+func (p *Postgres) getDeviceCode(ctx context.Context, op string, column string, value string) (*DeviceCode, error) {
+	defer observeQuery("postgres", op, time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	c, err := scanPGDeviceCode(p.conn.QueryRowContext(ctx, "SELECT "+strings.Join(deviceCodeColumns, ", ")+" FROM device_codes WHERE "+column+" = $1", value))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetDeviceCode returns device code by hash including expired one.
+func (p *Postgres) GetDeviceCode(ctx context.Context, codeHash string) (*DeviceCode, error) {
+	return p.getDeviceCode(ctx, "get_device_code", "code_hash", codeHash)
+}
+
+// GetDeviceCodeByUserCode returns device code by user code including expired one.
+func (p *Postgres) GetDeviceCodeByUserCode(ctx context.Context, userCode string) (*DeviceCode, error) {
+	return p.getDeviceCode(ctx, "get_device_code_by_user_code", "user_code", userCode)
+}
+
+// DecideDeviceCode sets status of pending not expired code approved or denied by the user,
+// userID is zero if the code is denied anonymously. ErrNotExist is returned if there is no such code.
+func (p *Postgres) DecideDeviceCode(ctx context.Context, userCode string, userID int64, status string) error {
+	defer observeQuery("postgres", "decide_device_code", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	decidedBy := sql.NullInt64{
+		Int64: userID,
+		Valid: userID != 0,
+	}
+
+	res, err := p.conn.ExecContext(ctx, "UPDATE device_codes SET status = $1, user_id = $2 WHERE user_code = $3 AND status = $4 AND expires_at > $5",
+		status, decidedBy, userCode, DeviceCodePending, now())
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotExist
+	}
+
+	return nil
+}
+
+// TouchDeviceCode records poll of the device and sets poll interval.
+func (p *Postgres) TouchDeviceCode(ctx context.Context, codeHash string, interval time.Duration) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.conn.ExecContext(ctx, "UPDATE device_codes SET polled_at = $1, poll_interval = $2 WHERE code_hash = $3", now(), int64(interval/time.Second), codeHash)
+	return err
+}
+
+// ConsumeDeviceCode removes and returns approved or denied code, so the token is issued only once.
+// ErrNotExist is returned for unknown and pending codes.
+func (p *Postgres) ConsumeDeviceCode(ctx context.Context, codeHash string) (*DeviceCode, error) {
+	defer observeQuery("postgres", "consume_device_code", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	c, err := scanPGDeviceCode(p.conn.QueryRowContext(ctx, "DELETE FROM device_codes WHERE code_hash = $1 AND status <> $2 RETURNING "+strings.Join(deviceCodeColumns, ", "), codeHash, DeviceCodePending))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
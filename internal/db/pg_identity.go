@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// CreateIdentity links identity to the user, CreatedAt and LastLoginAt of i are set on success.
+func (p *Postgres) CreateIdentity(ctx context.Context, i *Identity) error {
+	defer observeQuery("postgres", "create_identity", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	t := now()
+	_, err := p.conn.ExecContext(ctx, "INSERT INTO identities("+strings.Join(identityColumns, ", ")+") VALUES($1, $2, $3, $4, $5, $5)",
+		i.Provider, i.Subject, i.UserID, i.Email, t)
+	if err != nil {
+		if isUniqueViolationError(err) {
+			return ErrAlreadyExist
+		}
+		return err
+	}
+
+	i.CreatedAt = t
+	i.LastLoginAt = t
+	return nil
+}
+
+// GetIdentity returns identity by provider and subject.
+func (p *Postgres) GetIdentity(ctx context.Context, provider string, subject string) (*Identity, error) {
+	defer observeQuery("postgres", "get_identity", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var i Identity
+	err := p.conn.QueryRowContext(ctx, "SELECT "+strings.Join(identityColumns, ", ")+" FROM identities WHERE provider = $1 AND subject = $2", provider, subject).
+		Scan(&i.Provider, &i.Subject, &i.UserID, &i.Email, &i.CreatedAt, &i.LastLoginAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	i.CreatedAt = i.CreatedAt.UTC()
+	i.LastLoginAt = i.LastLoginAt.UTC()
+	return &i, nil
+}
+
+// TouchIdentity updates last login time of the identity.
+func (p *Postgres) TouchIdentity(ctx context.Context, provider string, subject string) error {
+	defer observeQuery("postgres", "touch_identity", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.conn.ExecContext(ctx, "UPDATE identities SET last_login_at = $1 WHERE provider = $2 AND subject = $3", now(), provider, subject)
+	return err
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// magicLinkLockClass is the first key of postgres advisory locks serializing links sent to the same email,
+// the second key is the hash of the email.
+const magicLinkLockClass = 623194219
+
+// CreateMagicLink stores new link unless limit links are sent to its email within the window already,
+// ErrLimitExceeded is returned then. CreatedAt of l is set on success.
+// Links of the email are counted and inserted holding transaction advisory lock of the email,
+// so concurrent requests can't exceed the limit.
+func (p *Postgres) CreateMagicLink(ctx context.Context, l *MagicLink, limit int, window time.Duration) error {
+	defer observeQuery("postgres", "create_magic_link", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	return WithTransaction(ctx, p.conn, func(tx Transaction) error {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1, hashtext($2))", magicLinkLockClass, l.Email); err != nil {
+			return err
+		}
+
+		createdAt := now()
+
+		var count int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM magic_links WHERE email = $1 AND created_at >= $2", l.Email, createdAt.Add(-window)).Scan(&count); err != nil {
+			return err
+		}
+
+		if count >= limit {
+			return ErrLimitExceeded
+		}
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO magic_links(token_hash, user_id, email, created_at, expires_at) VALUES($1, $2, $3, $4, $5)",
+			l.TokenHash, l.UserID, l.Email, createdAt, l.ExpiresAt); err != nil {
+			return err
+		}
+
+		l.CreatedAt = createdAt
+		return nil
+	})
+}
+
+// ConsumeMagicLink marks unused link used and returns it, so it can be used only once.
+// Expired links are returned as well, the caller checks ExpiresAt.
+func (p *Postgres) ConsumeMagicLink(ctx context.Context, tokenHash string) (*MagicLink, error) {
+	defer observeQuery("postgres", "consume_magic_link", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		l      MagicLink
+		usedAt sql.NullTime
+	)
+	err := p.conn.QueryRowContext(ctx, "UPDATE magic_links SET used_at = $1 WHERE token_hash = $2 AND used_at IS NULL RETURNING "+strings.Join(magicLinkColumns, ", "), now(), tokenHash).
+		Scan(&l.TokenHash, &l.UserID, &l.Email, &l.CreatedAt, &l.ExpiresAt, &usedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	l.CreatedAt = l.CreatedAt.UTC()
+	l.ExpiresAt = l.ExpiresAt.UTC()
+	l.UsedAt = usedAt.Time.UTC()
+	return &l, nil
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// CreateOAuthClient stores new client, CreatedAt of c is set on success.
+func (p *Postgres) CreateOAuthClient(ctx context.Context, c *OAuthClient) error {
+	defer observeQuery("postgres", "create_oauth_client", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	createdAt := now()
+	_, err := p.conn.ExecContext(ctx, "INSERT INTO oauth_clients(id, secret_hash, token_endpoint_auth_method, name, redirect_uris, scopes, created_at) VALUES($1, $2, $3, $4, $5, $6, $7)",
+		c.ID, c.SecretHash, c.AuthMethod, c.Name, joinList(c.RedirectURIs), joinList(c.Scopes), createdAt)
+	if err != nil {
+		if isUniqueViolationError(err) {
+			return ErrAlreadyExist
+		}
+		return err
+	}
+
+	c.CreatedAt = createdAt
+	return nil
+}
+
+// GetOAuthClient returns client by id.
+func (p *Postgres) GetOAuthClient(ctx context.Context, id string) (*OAuthClient, error) {
+	defer observeQuery("postgres", "get_oauth_client", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		c                    OAuthClient
+		redirectURIs, scopes string
+	)
+	err := p.conn.QueryRowContext(ctx, "SELECT "+strings.Join(oauthClientColumns, ", ")+" FROM oauth_clients WHERE id = $1", id).
+		Scan(&c.ID, &c.SecretHash, &c.AuthMethod, &c.Name, &redirectURIs, &scopes, &c.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	c.RedirectURIs = splitList(redirectURIs)
+	c.Scopes = splitList(scopes)
+	c.CreatedAt = c.CreatedAt.UTC()
+	return &c, nil
+}
+
+// CreateOAuthCode stores authorization code.
+func (p *Postgres) CreateOAuthCode(ctx context.Context, c *OAuthCode) error {
+	defer observeQuery("postgres", "create_oauth_code", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.conn.ExecContext(ctx, "INSERT INTO oauth_codes("+strings.Join(oauthCodeColumns, ", ")+") VALUES($1, $2, $3, $4, $5, $6, $7, $8)",
+		c.CodeHash, c.ClientID, c.UserID, c.RedirectURI, c.Scope, c.CodeChallenge, c.ExpiresAt, c.Nonce)
+	return err
+}
+
+// ConsumeOAuthCode removes and returns authorization code, so it can be used only once.
+// Expired codes are returned as well, the caller checks ExpiresAt.
+func (p *Postgres) ConsumeOAuthCode(ctx context.Context, codeHash string) (*OAuthCode, error) {
+	defer observeQuery("postgres", "consume_oauth_code", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var c OAuthCode
+	err := p.conn.QueryRowContext(ctx, "DELETE FROM oauth_codes WHERE code_hash = $1 RETURNING "+strings.Join(oauthCodeColumns, ", "), codeHash).
+		Scan(&c.CodeHash, &c.ClientID, &c.UserID, &c.RedirectURI, &c.Scope, &c.CodeChallenge, &c.ExpiresAt, &c.Nonce)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	c.ExpiresAt = c.ExpiresAt.UTC()
+	return &c, nil
+}
+
+// SaveOAuthGrant creates or updates scopes the user approved for the client.
+func (p *Postgres) SaveOAuthGrant(ctx context.Context, g *OAuthGrant) error {
+	defer observeQuery("postgres", "save_oauth_grant", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	t := now()
+	_, err := p.conn.ExecContext(ctx, "INSERT INTO oauth_grants(user_id, client_id, scope, created_at, updated_at) VALUES($1, $2, $3, $4, $4) "+
+		"ON CONFLICT(user_id, client_id) DO UPDATE SET scope = excluded.scope, updated_at = excluded.updated_at",
+		g.UserID, g.ClientID, g.Scope, t)
+	return err
+}
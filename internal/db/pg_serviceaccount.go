@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// CreateServiceAccount stores new account, CreatedAt of a is set on success.
+func (p *Postgres) CreateServiceAccount(ctx context.Context, a *ServiceAccount) error {
+	defer observeQuery("postgres", "create_service_account", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	createdAt := now()
+	_, err := p.conn.ExecContext(ctx, "INSERT INTO service_accounts(id, name, secret_hash, public_key, scopes, created_at) VALUES($1, $2, $3, $4, $5, $6)",
+		a.ID, a.Name, a.SecretHash, a.PublicKey, joinList(a.Scopes), createdAt)
+	if err != nil {
+		if isUniqueViolationError(err) {
+			return ErrAlreadyExist
+		}
+		return err
+	}
+
+	a.CreatedAt = createdAt
+	return nil
+}
+
+func scanPGServiceAccount(r rowScanner) (*ServiceAccount, error) {
+	var (
+		a      ServiceAccount
+		scopes string
+	)
+	if err := r.Scan(&a.ID, &a.Name, &a.SecretHash, &a.PublicKey, &scopes, &a.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	a.Scopes = splitList(scopes)
+	a.CreatedAt = a.CreatedAt.UTC()
+	return &a, nil
+}
+
+// GetServiceAccount returns account by id.
+func (p *Postgres) GetServiceAccount(ctx context.Context, id string) (*ServiceAccount, error) {
+	defer observeQuery("postgres", "get_service_account", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	a, err := scanPGServiceAccount(p.conn.QueryRowContext(ctx, "SELECT "+strings.Join(serviceAccountColumns, ", ")+" FROM service_accounts WHERE id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// ListServiceAccounts returns all accounts ordered by name.
+func (p *Postgres) ListServiceAccounts(ctx context.Context) ([]*ServiceAccount, error) {
+	defer observeQuery("postgres", "list_service_accounts", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.conn.QueryContext(ctx, "SELECT "+strings.Join(serviceAccountColumns, ", ")+" FROM service_accounts ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var accounts []*ServiceAccount
+	for rows.Next() {
+		a, err := scanPGServiceAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// DeleteServiceAccount removes account, ErrNotExist is returned if there is no such account.
+func (p *Postgres) DeleteServiceAccount(ctx context.Context, id string) error {
+	defer observeQuery("postgres", "delete_service_account", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.conn.ExecContext(ctx, "DELETE FROM service_accounts WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotExist
+	}
+
+	return nil
+}
+
+// UseServiceAssertion records id of the assertion until it expires,
+// ErrAlreadyExist is returned if the assertion is already used. Expired ids of the account are removed.
+func (p *Postgres) UseServiceAssertion(ctx context.Context, accountID string, jti string, expiresAt time.Time) error {
+	defer observeQuery("postgres", "use_service_assertion", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := p.conn.ExecContext(ctx, "DELETE FROM service_assertions WHERE account_id = $1 AND expires_at < $2", accountID, now()); err != nil {
+		return err
+	}
+
+	_, err := p.conn.ExecContext(ctx, "INSERT INTO service_assertions(account_id, jti, expires_at) VALUES($1, $2, $3)", accountID, jti, expiresAt)
+	if err != nil {
+		if isUniqueViolationError(err) {
+			return ErrAlreadyExist
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// CreateSession stores new session of s.UserID, ID, CreatedAt and LastSeenAt of s are set on success.
+func (p *Postgres) CreateSession(ctx context.Context, s *Session) error {
+	defer observeQuery("postgres", "create_session", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	id, err := newSessionID()
+	if err != nil {
+		return err
+	}
+
+	createdAt := now()
+	_, err = p.conn.ExecContext(ctx, "INSERT INTO sessions(id, user_id, user_agent, client_ip, created_at, last_seen_at) VALUES($1, $2, $3, $4, $5, $5)",
+		id, s.UserID, s.UserAgent, s.ClientIP, createdAt)
+	if err != nil {
+		return err
+	}
+
+	s.ID = id
+	s.CreatedAt = createdAt
+	s.LastSeenAt = createdAt
+	return nil
+}
+
+func scanPGSession(r rowScanner) (*Session, error) {
+	var (
+		s         Session
+		revokedAt sql.NullTime
+	)
+	if err := r.Scan(append(s.scanDest(), &s.CreatedAt, &s.LastSeenAt, &revokedAt)...); err != nil {
+		return nil, err
+	}
+
+	s.CreatedAt = s.CreatedAt.UTC()
+	s.LastSeenAt = s.LastSeenAt.UTC()
+	if revokedAt.Valid {
+		s.RevokedAt = revokedAt.Time.UTC()
+	}
+	return &s, nil
+}
+
+// GetSession returns session by id including revoked one.
+func (p *Postgres) GetSession(ctx context.Context, id string) (*Session, error) {
+	defer observeQuery("postgres", "get_session", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	s, err := scanPGSession(p.conn.QueryRowContext(ctx, "SELECT "+strings.Join(sessionColumns, ", ")+" FROM sessions WHERE id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// ListSessions returns active sessions of the user most recently seen first.
+func (p *Postgres) ListSessions(ctx context.Context, userID int64) ([]*Session, error) {
+	defer observeQuery("postgres", "list_sessions", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.conn.QueryContext(ctx, "SELECT "+strings.Join(sessionColumns, ", ")+" FROM sessions WHERE user_id = $1 AND revoked_at IS NULL ORDER BY last_seen_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		s, err := scanPGSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// TouchSession updates last seen time of the active session.
+func (p *Postgres) TouchSession(ctx context.Context, id string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.conn.ExecContext(ctx, "UPDATE sessions SET last_seen_at = $1 WHERE id = $2 AND revoked_at IS NULL", now(), id)
+	return err
+}
+
+// RevokeSession revokes active session of the user, ErrNotExist is returned if there is no such session.
+func (p *Postgres) RevokeSession(ctx context.Context, userID int64, id string) error {
+	defer observeQuery("postgres", "revoke_session", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.conn.ExecContext(ctx, "UPDATE sessions SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL", now(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotExist
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions revokes all active sessions of the user except exceptID and returns their ids.
+func (p *Postgres) RevokeOtherSessions(ctx context.Context, userID int64, exceptID string) ([]string, error) {
+	defer observeQuery("postgres", "revoke_other_sessions", time.Now())
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.conn.QueryContext(ctx, "UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND id <> $3 AND revoked_at IS NULL RETURNING id", now(), userID, exceptID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanIDs(rows)
+}
+
+func scanIDs(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
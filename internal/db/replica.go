@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	replicaCheckInterval = time.Second * 5
+	replicaCheckTimeout  = time.Second * 2
+
+	// readYourWritesPeriod is the time reads of the just written user are served by primary,
+	// it should cover replication lag.
+	readYourWritesPeriod = time.Second * 5
+)
+
+type primaryKey struct{}
+
+// WithPrimary marks context so that all reads within it are served by primary database.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func isPrimaryRequired(ctx context.Context) bool {
+	required, _ := ctx.Value(primaryKey{}).(bool)
+	return required
+}
+
+type replica struct {
+	db      *sql.DB
+	healthy int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+func (r *replica) setHealthy(healthy bool) {
+	var v int32
+	if healthy {
+		v = 1
+	}
+	atomic.StoreInt32(&r.healthy, v)
+}
+
+// replicaSet balances read only queries between healthy replicas.
+type replicaSet struct {
+	replicas []*replica
+	next     uint32
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mu           sync.Mutex
+	recentWrites map[string]time.Time
+}
+
+func newReplicaSet(connectionStrs []string, po PoolOptions) (*replicaSet, error) {
+	rs := replicaSet{
+		done:         make(chan struct{}),
+		recentWrites: make(map[string]time.Time),
+	}
+
+	for _, connStr := range connectionStrs {
+		replicaDB, err := sql.Open("postgres", connStr)
+		if err != nil {
+			rs.Close()
+			return nil, err
+		}
+
+		po.apply(replicaDB)
+
+		rs.replicas = append(rs.replicas, &replica{
+			db: replicaDB,
+		})
+	}
+
+	rs.check()
+
+	rs.wg.Add(1)
+	go func() {
+		defer rs.wg.Done()
+		rs.run()
+	}()
+
+	return &rs, nil
+}
+
+func (rs *replicaSet) run() {
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rs.done:
+			return
+		case <-ticker.C:
+			rs.check()
+		}
+	}
+}
+
+func (rs *replicaSet) check() {
+	for _, r := range rs.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), replicaCheckTimeout)
+		r.setHealthy(r.db.PingContext(ctx) == nil)
+		cancel()
+	}
+
+	rs.mu.Lock()
+	now := time.Now()
+	for key, expiresAt := range rs.recentWrites {
+		if now.After(expiresAt) {
+			delete(rs.recentWrites, key)
+		}
+	}
+	rs.mu.Unlock()
+}
+
+// pick returns next healthy replica or nil if there is no one.
+func (rs *replicaSet) pick() *replica {
+	count := len(rs.replicas)
+	for i := 0; i < count; i++ {
+		r := rs.replicas[int(atomic.AddUint32(&rs.next, 1))%count]
+		if r.isHealthy() {
+			return r
+		}
+	}
+	return nil
+}
+
+// userIDKey is the read-your-writes key of user lookups by id, lookups by name use the name itself.
+func userIDKey(id int64) string {
+	return "id:" + strconv.FormatInt(id, 10)
+}
+
+// written pins reads by the key to primary for readYourWritesPeriod.
+func (rs *replicaSet) written(key string) {
+	rs.mu.Lock()
+	rs.recentWrites[key] = time.Now().Add(readYourWritesPeriod)
+	rs.mu.Unlock()
+}
+
+func (rs *replicaSet) isRecentlyWritten(key string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	expiresAt, ok := rs.recentWrites[key]
+	return ok && time.Now().Before(expiresAt)
+}
+
+func (rs *replicaSet) Close() error {
+	close(rs.done)
+	rs.wg.Wait()
+
+	var err error
+	for _, r := range rs.replicas {
+		if closeErr := r.db.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// isReplicaFailure checks whether query should be repeated on primary.
+// Query results (including not found) and query errors reported by server are not failures.
+func isReplicaFailure(err error) bool {
+	if err == nil ||
+		errors.Is(err, ErrNotExist) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr *pq.Error
+	return !errors.As(err, &pgErr)
+}
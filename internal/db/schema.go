@@ -0,0 +1,58 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// userColumns and emailColumns list all columns of Users and Emails tables.
+// Queries select users by userColumns and scanUser reads them in the same order,
+// schema tests verify the lists against migrated tables so they can't silently diverge.
+var (
+	userColumns  = []string{"id", "name", "password", "public"}
+	emailColumns = []string{"id", "userid", "email", "prim", "verified", "verification_code"}
+)
+
+// schemaTables maps tables to the columns queries rely on, it is verified by CheckSchema.
+var schemaTables = map[string][]string{
+	"users":              userColumns,
+	"emails":             emailColumns,
+	"audit_events":       auditColumns,
+	"audit_checkpoints":  checkpointColumns,
+	"sessions":           sessionColumns,
+	"oauth_clients":      oauthClientColumns,
+	"oauth_codes":        oauthCodeColumns,
+	"oauth_grants":       oauthGrantColumns,
+	"identities":         identityColumns,
+	"api_keys":           apiKeyColumns,
+	"device_codes":       deviceCodeColumns,
+	"magic_links":        magicLinkColumns,
+	"service_accounts":   serviceAccountColumns,
+	"service_assertions": serviceAssertionColumns,
+}
+
+func qualifiedColumns(table string, columns []string) string {
+	qualified := make([]string, 0, len(columns))
+	for _, c := range columns {
+		qualified = append(qualified, table+"."+c)
+	}
+	return strings.Join(qualified, ", ")
+}
+
+func compareColumns(table string, expected []string, actual []string) error {
+	normalize := func(columns []string) string {
+		n := make([]string, 0, len(columns))
+		for _, c := range columns {
+			n = append(n, strings.ToLower(c))
+		}
+		sort.Strings(n)
+		return strings.Join(n, ", ")
+	}
+
+	if e, a := normalize(expected), normalize(actual); e != a {
+		return fmt.Errorf("schema drift for table %s: expected columns [%s], actual [%s]", table, e, a)
+	}
+
+	return nil
+}
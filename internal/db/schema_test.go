@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// gooseTable is created by migrations to keep applied versions, queries don't use it.
+const gooseTable = "goose_db_version"
+
+type schemaChecker interface {
+	CheckSchema(ctx context.Context) error
+}
+
+func TestSQLiteSchema(t *testing.T) {
+	s := newTestSQLite(t)
+	testSchema(t, s, s.db, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'")
+}
+
+func TestPostgresSchema(t *testing.T) {
+	p := newTestPostgres(t)
+	testSchema(t, p, p.db, "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema()")
+}
+
+// testSchema compares column lists queries rely on with the migrated tables,
+// every migrated table must be listed in schemaTables.
+func testSchema(t *testing.T, c schemaChecker, conn *sql.DB, tablesQuery string) {
+	if err := c.CheckSchema(context.Background()); err != nil {
+		t.Fatalf("check schema: %v", err)
+	}
+
+	rows, err := conn.Query(tablesQuery)
+	if err != nil {
+		t.Fatalf("list tables: %v", err)
+	}
+	defer rows.Close()
+
+	var missing []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatalf("scan table: %v", err)
+		}
+
+		table = strings.ToLower(table)
+		if _, ok := schemaTables[table]; !ok && table != gooseTable {
+			missing = append(missing, table)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		t.Fatalf("list tables: %v", err)
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		t.Errorf("tables are not listed in schemaTables: %s", strings.Join(missing, ", "))
+	}
+}
+
+func TestSQLiteSchemaDrift(t *testing.T) {
+	s := newTestSQLite(t)
+
+	if _, err := s.db.Exec("ALTER TABLE Users ADD COLUMN nickname TEXT"); err != nil {
+		t.Fatalf("alter table: %v", err)
+	}
+
+	if err := s.CheckSchema(context.Background()); err == nil {
+		t.Error("check schema: drift is not detected")
+	}
+}
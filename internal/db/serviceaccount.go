@@ -0,0 +1,22 @@
+package db
+
+import (
+	"time"
+)
+
+// ServiceAccount is the identity of back-end service, it authenticates by secret or by assertion signed with its private key.
+type ServiceAccount struct {
+	ID   string
+	Name string
+	// SecretHash is empty for accounts authenticated by private key.
+	SecretHash string
+	// PublicKey is PEM encoded public key verifying assertions, empty for accounts authenticated by secret.
+	PublicKey string
+	Scopes    []string
+	CreatedAt time.Time
+}
+
+var (
+	serviceAccountColumns   = []string{"id", "name", "secret_hash", "public_key", "scopes", "created_at"}
+	serviceAssertionColumns = []string{"account_id", "jti", "expires_at"}
+)
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Session is a login of the user from some device, tokens issued on login are bound to the session.
+type Session struct {
+	ID         string
+	UserID     int64
+	UserAgent  string
+	ClientIP   string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	// RevokedAt is zero for active sessions.
+	RevokedAt time.Time
+}
+
+// IsRevoked reports whether session tokens are no longer accepted.
+func (s *Session) IsRevoked() bool {
+	return !s.RevokedAt.IsZero()
+}
+
+// sessionColumns lists sessions columns in the order they are scanned.
+var sessionColumns = []string{"id", "user_id", "user_agent", "client_ip", "created_at", "last_seen_at", "revoked_at"}
+
+func (s *Session) scanDest() []interface{} {
+	return []interface{}{&s.ID, &s.UserID, &s.UserAgent, &s.ClientIP}
+}
+
+// newSessionID returns random session id.
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// now returns current time with precision all backends store.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
@@ -0,0 +1,247 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+type SQLite struct {
+	db   *sql.DB
+	conn Transaction
+	opts options
+}
+
+func NewSQLite(path string, opts ...Option) (*SQLite, error) {
+	sqlDB, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite allows only one writer at a time
+	sqlDB.SetMaxOpenConns(1)
+
+	if err = sqlDB.Ping(); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
+	return &SQLite{
+		db:   sqlDB,
+		conn: traceConn("sqlite", sqlDB),
+		opts: makeOptions(opts),
+	}, nil
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+// CheckMigrations verifies that all embedded migrations are applied.
+func (s *SQLite) CheckMigrations(ctx context.Context) error {
+	return checkMigrationsVersion(s.db, "sqlite3", "migrations/sqlite")
+}
+
+// Ping checks database availability.
+func (s *SQLite) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// StatsCollector returns prometheus collector of connection pool statistics.
+func (s *SQLite) StatsCollector() prometheus.Collector {
+	return newStatsCollector(map[string]*sql.DB{
+		"sqlite": s.db,
+	})
+}
+
+// Migrate runs migrate command (up, down, status) against the embedded sqlite migrations.
+func (s *SQLite) Migrate(ctx context.Context, command string) error {
+	return runMigrations(s.db, "sqlite3", "migrations/sqlite", command)
+}
+
+// sqliteUsersQuery selects users with emails aggregated into json array, should be followed by WHERE and GROUP BY Users.id.
+// Emails are joined from ordered subquery to keep insertion order, sqlite has no ORDER BY within aggregate.
+var sqliteUsersQuery = "SELECT " + qualifiedColumns("Users", userColumns) + ", " +
+	"json_group_array(json_object('email', Emails.email, " +
+	"'prim', json(CASE WHEN Emails.prim THEN 'true' ELSE 'false' END), " +
+	"'verified', json(CASE WHEN Emails.verified THEN 'true' ELSE 'false' END), " +
+	"'verification_code', Emails.verification_code)) FILTER (WHERE Emails.id IS NOT NULL) " +
+	"FROM Users LEFT JOIN (SELECT * FROM Emails ORDER BY id) Emails ON Emails.userID = Users.id"
+
+func (s *SQLite) userByQuery(ctx context.Context, query string, args ...interface{}) (*User, error) {
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	user, err := scanUser(s.conn.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *SQLite) GetByName(ctx context.Context, name string) (*User, error) {
+	defer observeQuery("sqlite", "get_by_name", time.Now())
+
+	return s.userByQuery(ctx, sqliteUsersQuery+" WHERE Users.name = ? GROUP BY Users.id", name)
+}
+
+func (s *SQLite) GetByID(ctx context.Context, id int64) (*User, error) {
+	defer observeQuery("sqlite", "get_by_id", time.Now())
+
+	return s.userByQuery(ctx, sqliteUsersQuery+" WHERE Users.id = ? GROUP BY Users.id", id)
+}
+
+func (s *SQLite) GetByEmail(ctx context.Context, email string) (*User, error) {
+	defer observeQuery("sqlite", "get_by_email", time.Now())
+
+	return s.userByQuery(ctx, sqliteUsersQuery+" WHERE Users.id = (SELECT userID FROM Emails WHERE email = ?) GROUP BY Users.id", email)
+}
+
+func (s *SQLite) addEmailTx(ctx context.Context, userID int64, e Email, tx Transaction) error {
+	query := "INSERT INTO Emails(userID, email, prim, verified, verification_code) VALUES(?, ?, ?, ?, ?) " +
+		"ON CONFLICT(email) DO UPDATE SET email = excluded.email, prim = excluded.prim, verified = excluded.verified, verification_code = excluded.verification_code"
+
+	_, err := tx.ExecContext(ctx, query, userID, e.Email, e.Primary, e.Verified, e.VerificationCode)
+	return err
+}
+
+func (s *SQLite) AddEmail(ctx context.Context, userID int64, e Email) error {
+	defer observeQuery("sqlite", "add_email", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	err := s.addEmailTx(ctx, userID, e, s.conn)
+	if isSQLiteForeignKeyViolationError(err) {
+		return ErrNotExist
+	}
+	return err
+}
+
+func isSQLiteForeignKeyViolationError(err error) bool {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		if sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY {
+			return true
+		}
+	}
+	return false
+}
+
+// isSQLiteUniqueViolationError reports whether err violates unique or primary key constraint,
+// postgres reports both as unique violation.
+func isSQLiteUniqueViolationError(err error) bool {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SQLite) Create(ctx context.Context, u *User) error {
+	defer observeQuery("sqlite", "create", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	return WithTransaction(ctx, s.conn, func(tx Transaction) error {
+		query := "INSERT INTO Users(name, password) VALUES(?, ?) RETURNING id"
+
+		var id int64
+		err := tx.QueryRowContext(ctx, query, u.Name, u.Pwd).Scan(&id)
+		if err != nil {
+			if isSQLiteUniqueViolationError(err) {
+				return ErrAlreadyExist
+			}
+			return err
+		}
+
+		u.ID = id
+
+		for _, e := range u.Emails {
+			err := s.addEmailTx(ctx, id, e, tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *SQLite) GetPublicUsers(ctx context.Context) ([]*User, error) {
+	defer observeQuery("sqlite", "get_public_users", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	query := sqliteUsersQuery + " WHERE Users.public = TRUE GROUP BY Users.id ORDER BY Users.id"
+
+	rows, err := s.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// CheckSchema verifies that table columns match the ones used by queries.
+func (s *SQLite) CheckSchema(ctx context.Context) error {
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	for table, expected := range schemaTables {
+		rows, err := s.conn.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
+		if err != nil {
+			return err
+		}
+
+		var actual []string
+		for rows.Next() {
+			var column string
+			if err := rows.Scan(&column); err != nil {
+				rows.Close()
+				return err
+			}
+			actual = append(actual, column)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if err := compareColumns(table, expected, actual); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
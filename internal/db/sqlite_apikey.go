@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// CreateAPIKey stores new key, CreatedAt of k is set on success.
+func (s *SQLite) CreateAPIKey(ctx context.Context, k *APIKey) error {
+	defer observeQuery("sqlite", "create_api_key", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	var expiresAt sql.NullInt64
+	if !k.ExpiresAt.IsZero() {
+		expiresAt = sql.NullInt64{
+			Int64: k.ExpiresAt.UnixNano(),
+			Valid: true,
+		}
+	}
+
+	createdAt := now()
+	_, err := s.conn.ExecContext(ctx, "INSERT INTO api_keys(id, user_id, name, secret_hash, scopes, created_at, expires_at) VALUES(?, ?, ?, ?, ?, ?, ?)",
+		k.ID, k.UserID, k.Name, k.SecretHash, joinList(k.Scopes), createdAt.UnixNano(), expiresAt)
+	if err != nil {
+		if isSQLiteUniqueViolationError(err) {
+			return ErrAlreadyExist
+		}
+		return err
+	}
+
+	k.CreatedAt = createdAt
+	return nil
+}
+
+func scanSQLiteAPIKey(r rowScanner) (*APIKey, error) {
+	var (
+		k                                APIKey
+		scopes                           string
+		createdAt                        int64
+		expiresAt, lastUsedAt, revokedAt sql.NullInt64
+	)
+	if err := r.Scan(append(k.scanDest(), &scopes, &createdAt, &expiresAt, &lastUsedAt, &revokedAt)...); err != nil {
+		return nil, err
+	}
+
+	k.Scopes = splitList(scopes)
+	k.CreatedAt = time.Unix(0, createdAt).UTC()
+	if expiresAt.Valid {
+		k.ExpiresAt = time.Unix(0, expiresAt.Int64).UTC()
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = time.Unix(0, lastUsedAt.Int64).UTC()
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = time.Unix(0, revokedAt.Int64).UTC()
+	}
+	return &k, nil
+}
+
+// GetAPIKey returns key by id including revoked and expired one.
+func (s *SQLite) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	defer observeQuery("sqlite", "get_api_key", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	k, err := scanSQLiteAPIKey(s.conn.QueryRowContext(ctx, "SELECT "+strings.Join(apiKeyColumns, ", ")+" FROM api_keys WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// ListAPIKeys returns not revoked keys of the user including expired ones, newest first.
+func (s *SQLite) ListAPIKeys(ctx context.Context, userID int64) ([]*APIKey, error) {
+	defer observeQuery("sqlite", "list_api_keys", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn.QueryContext(ctx, "SELECT "+strings.Join(apiKeyColumns, ", ")+" FROM api_keys WHERE user_id = ? AND revoked_at IS NULL ORDER BY created_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var keys []*APIKey
+	for rows.Next() {
+		k, err := scanSQLiteAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// TouchAPIKey updates last used time of the active key.
+func (s *SQLite) TouchAPIKey(ctx context.Context, id string) error {
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn.ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ? AND revoked_at IS NULL", now().UnixNano(), id)
+	return err
+}
+
+// RevokeAPIKey revokes active key of the user, ErrNotExist is returned if there is no such key.
+func (s *SQLite) RevokeAPIKey(ctx context.Context, userID int64, id string) error {
+	defer observeQuery("sqlite", "revoke_api_key", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.conn.ExecContext(ctx, "UPDATE api_keys SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL", now().UnixNano(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotExist
+	}
+
+	return nil
+}
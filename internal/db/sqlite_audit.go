@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// AddAuditEvent appends audit event to the hash chain, ID, CreatedAt and hashes of e are set on success.
+func (s *SQLite) AddAuditEvent(ctx context.Context, e *AuditEvent) error {
+	defer observeQuery("sqlite", "add_audit_event", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	e.Chain = e.auditChain()
+
+	// the only connection serializes chain appends
+	return WithTransaction(ctx, s.conn, func(tx Transaction) error {
+		var prev AuditEvent
+		err := tx.QueryRowContext(ctx, "SELECT seq, hash FROM audit_events WHERE chain = ? ORDER BY id DESC LIMIT 1", e.Chain).Scan(&prev.Seq, &prev.Hash)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			e.link(nil)
+		case err != nil:
+			return err
+		default:
+			e.link(&prev)
+		}
+
+		query := "INSERT INTO audit_events(type, user_id, user_name, actor_id, client_ip, user_agent, details, chain, seq, prev_hash, hash, created_at) " +
+			"VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id"
+
+		err = tx.QueryRowContext(ctx, query, e.Type, e.UserID, e.UserName, e.ActorID, e.ClientIP, e.UserAgent, e.Details, e.Chain, e.Seq, e.PrevHash, e.Hash, e.CreatedAt.UnixNano()).Scan(&e.ID)
+		return err
+	})
+}
+
+func sqlitePlaceholder(n int) string {
+	return "?"
+}
+
+func sqliteTime(t time.Time) interface{} {
+	return t.UnixNano()
+}
+
+// ListAuditEvents returns audit events matching the filter newest first.
+func (s *SQLite) ListAuditEvents(ctx context.Context, f AuditFilter) ([]*AuditEvent, error) {
+	defer observeQuery("sqlite", "list_audit_events", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	query, args := auditQuery(f, sqlitePlaceholder, sqliteTime)
+
+	var events []*AuditEvent
+	err := s.scanAuditEvents(ctx, query, args, func(e *AuditEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// WalkAuditEvents calls fn for every audit event oldest first, stops on the first fn error.
+func (s *SQLite) WalkAuditEvents(ctx context.Context, fn func(e *AuditEvent) error) error {
+	return s.scanAuditEvents(ctx, "SELECT "+strings.Join(auditColumns, ", ")+" FROM audit_events ORDER BY id", nil, fn)
+}
+
+// ListAuditChainHeads returns the last event of every chain appended after the event with afterID oldest first.
+func (s *SQLite) ListAuditChainHeads(ctx context.Context, afterID int64) ([]*AuditEvent, error) {
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	var events []*AuditEvent
+	err := s.scanAuditEvents(ctx, auditChainHeadsQuery("?"), []interface{}{afterID}, func(e *AuditEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (s *SQLite) scanAuditEvents(ctx context.Context, query string, args []interface{}, fn func(e *AuditEvent) error) error {
+	rows, err := s.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			e         AuditEvent
+			createdAt int64
+		)
+		if err := rows.Scan(append(e.scanDest(), &createdAt)...); err != nil {
+			return err
+		}
+		e.CreatedAt = time.Unix(0, createdAt).UTC()
+
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// AddAuditCheckpoint stores signed checkpoint, ID and CreatedAt of c are set on success.
+func (s *SQLite) AddAuditCheckpoint(ctx context.Context, c *AuditCheckpoint) error {
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	createdAt := now()
+	err := s.conn.QueryRowContext(ctx, "INSERT INTO audit_checkpoints(chain, event_id, event_count, hash, signature, created_at) VALUES(?, ?, ?, ?, ?, ?) RETURNING id",
+		c.Chain, c.EventID, c.Count, c.Hash, c.Signature, createdAt.UnixNano()).Scan(&c.ID)
+	if err != nil {
+		return err
+	}
+
+	c.CreatedAt = createdAt
+	return nil
+}
+
+// ListAuditCheckpoints returns all checkpoints oldest first.
+func (s *SQLite) ListAuditCheckpoints(ctx context.Context) ([]*AuditCheckpoint, error) {
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn.QueryContext(ctx, "SELECT "+strings.Join(checkpointColumns, ", ")+" FROM audit_checkpoints ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var checkpoints []*AuditCheckpoint
+	for rows.Next() {
+		var (
+			c         AuditCheckpoint
+			createdAt int64
+		)
+		if err := rows.Scan(append(c.scanDest(), &createdAt)...); err != nil {
+			return nil, err
+		}
+		c.CreatedAt = time.Unix(0, createdAt).UTC()
+		checkpoints = append(checkpoints, &c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return checkpoints, nil
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// CreateDeviceCode stores new pending device code, Status and CreatedAt of c are set on success.
+func (s *SQLite) CreateDeviceCode(ctx context.Context, c *DeviceCode) error {
+	defer observeQuery("sqlite", "create_device_code", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	createdAt := now()
+	_, err := s.conn.ExecContext(ctx, "INSERT INTO device_codes(code_hash, user_code, client_name, client_ip, status, poll_interval, created_at, expires_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?)",
+		c.CodeHash, c.UserCode, c.ClientName, c.ClientIP, DeviceCodePending, int64(c.Interval/time.Second), createdAt.UnixNano(), c.ExpiresAt.UnixNano())
+	if err != nil {
+		if isSQLiteUniqueViolationError(err) {
+			return ErrAlreadyExist
+		}
+		return err
+	}
+
+	c.Status = DeviceCodePending
+	c.CreatedAt = createdAt
+	return nil
+}
+
+func scanSQLiteDeviceCode(r rowScanner) (*DeviceCode, error) {
+	var (
+		c                              DeviceCode
+		userID, polledAt               sql.NullInt64
+		interval, createdAt, expiresAt int64
+	)
+	if err := r.Scan(append(c.scanDest(), &userID, &interval, &createdAt, &expiresAt, &polledAt)...); err != nil {
+		return nil, err
+	}
+
+	c.UserID = userID.Int64
+	c.Interval = time.Duration(interval) * time.Second
+	c.CreatedAt = time.Unix(0, createdAt).UTC()
+	c.ExpiresAt = time.Unix(0, expiresAt).UTC()
+	if polledAt.Valid {
+		c.PolledAt = time.Unix(0, polledAt.Int64).UTC()
+	}
+	return &c, nil
+}
+
+func (s *SQLite) getDeviceCode(ctx context.Context, op string, column string, value string) (*DeviceCode, error) {
+	defer observeQuery("sqlite", op, time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	c, err := scanSQLiteDeviceCode(s.conn.QueryRowContext(ctx, "SELECT "+strings.Join(deviceCodeColumns, ", ")+" FROM device_codes WHERE "+column+" = ?", value))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetDeviceCode returns device code by hash including expired one.
+func (s *SQLite) GetDeviceCode(ctx context.Context, codeHash string) (*DeviceCode, error) {
+	return s.getDeviceCode(ctx, "get_device_code", "code_hash", codeHash)
+}
+
+// GetDeviceCodeByUserCode returns device code by user code including expired one.
+func (s *SQLite) GetDeviceCodeByUserCode(ctx context.Context, userCode string) (*DeviceCode, error) {
+	return s.getDeviceCode(ctx, "get_device_code_by_user_code", "user_code", userCode)
+}
+
+// DecideDeviceCode sets status of pending not expired code approved or denied by the user,
+// userID is zero if the code is denied anonymously. ErrNotExist is returned if there is no such code.
+func (s *SQLite) DecideDeviceCode(ctx context.Context, userCode string, userID int64, status string) error {
+	defer observeQuery("sqlite", "decide_device_code", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	decidedBy := sql.NullInt64{
+		Int64: userID,
+		Valid: userID != 0,
+	}
+
+	res, err := s.conn.ExecContext(ctx, "UPDATE device_codes SET status = ?, user_id = ? WHERE user_code = ? AND status = ? AND expires_at > ?",
+		status, decidedBy, userCode, DeviceCodePending, now().UnixNano())
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotExist
+	}
+
+	return nil
+}
+
+// TouchDeviceCode records poll of the device and sets poll interval.
+func (s *SQLite) TouchDeviceCode(ctx context.Context, codeHash string, interval time.Duration) error {
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn.ExecContext(ctx, "UPDATE device_codes SET polled_at = ?, poll_interval = ? WHERE code_hash = ?", now().UnixNano(), int64(interval/time.Second), codeHash)
+	return err
+}
+
+// ConsumeDeviceCode removes and returns approved or denied code, so the token is issued only once.
+// ErrNotExist is returned for unknown and pending codes.
+func (s *SQLite) ConsumeDeviceCode(ctx context.Context, codeHash string) (*DeviceCode, error) {
+	defer observeQuery("sqlite", "consume_device_code", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	c, err := scanSQLiteDeviceCode(s.conn.QueryRowContext(ctx, "DELETE FROM device_codes WHERE code_hash = ? AND status <> ? RETURNING "+strings.Join(deviceCodeColumns, ", "), codeHash, DeviceCodePending))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// CreateIdentity links identity to the user, CreatedAt and LastLoginAt of i are set on success.
+func (s *SQLite) CreateIdentity(ctx context.Context, i *Identity) error {
+	defer observeQuery("sqlite", "create_identity", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	t := now()
+	_, err := s.conn.ExecContext(ctx, "INSERT INTO identities("+strings.Join(identityColumns, ", ")+") VALUES(?, ?, ?, ?, ?, ?)",
+		i.Provider, i.Subject, i.UserID, i.Email, t.UnixNano(), t.UnixNano())
+	if err != nil {
+		if isSQLiteUniqueViolationError(err) {
+			return ErrAlreadyExist
+		}
+		return err
+	}
+
+	i.CreatedAt = t
+	i.LastLoginAt = t
+	return nil
+}
+
+// GetIdentity returns identity by provider and subject.
+func (s *SQLite) GetIdentity(ctx context.Context, provider string, subject string) (*Identity, error) {
+	defer observeQuery("sqlite", "get_identity", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		i                      Identity
+		createdAt, lastLoginAt int64
+	)
+	err := s.conn.QueryRowContext(ctx, "SELECT "+strings.Join(identityColumns, ", ")+" FROM identities WHERE provider = ? AND subject = ?", provider, subject).
+		Scan(&i.Provider, &i.Subject, &i.UserID, &i.Email, &createdAt, &lastLoginAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	i.CreatedAt = time.Unix(0, createdAt).UTC()
+	i.LastLoginAt = time.Unix(0, lastLoginAt).UTC()
+	return &i, nil
+}
+
+// TouchIdentity updates last login time of the identity.
+func (s *SQLite) TouchIdentity(ctx context.Context, provider string, subject string) error {
+	defer observeQuery("sqlite", "touch_identity", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn.ExecContext(ctx, "UPDATE identities SET last_login_at = ? WHERE provider = ? AND subject = ?", now().UnixNano(), provider, subject)
+	return err
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// CreateMagicLink stores new link unless limit links are sent to its email within the window already,
+// ErrLimitExceeded is returned then. CreatedAt of l is set on success.
+// The link is counted and inserted in one transaction, the single connection serializes them.
+func (s *SQLite) CreateMagicLink(ctx context.Context, l *MagicLink, limit int, window time.Duration) error {
+	defer observeQuery("sqlite", "create_magic_link", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	createdAt := now()
+	return WithTransaction(ctx, s.conn, func(tx Transaction) error {
+		var count int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM magic_links WHERE email = ? AND created_at >= ?", l.Email, createdAt.Add(-window).UnixNano()).Scan(&count); err != nil {
+			return err
+		}
+
+		if count >= limit {
+			return ErrLimitExceeded
+		}
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO magic_links(token_hash, user_id, email, created_at, expires_at) VALUES(?, ?, ?, ?, ?)",
+			l.TokenHash, l.UserID, l.Email, createdAt.UnixNano(), l.ExpiresAt.UnixNano()); err != nil {
+			return err
+		}
+
+		l.CreatedAt = createdAt
+		return nil
+	})
+}
+
+// ConsumeMagicLink marks unused link used and returns it, so it can be used only once.
+// Expired links are returned as well, the caller checks ExpiresAt.
+func (s *SQLite) ConsumeMagicLink(ctx context.Context, tokenHash string) (*MagicLink, error) {
+	defer observeQuery("sqlite", "consume_magic_link", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		l                            MagicLink
+		createdAt, expiresAt, usedAt int64
+	)
+	err := s.conn.QueryRowContext(ctx, "UPDATE magic_links SET used_at = ? WHERE token_hash = ? AND used_at IS NULL RETURNING "+strings.Join(magicLinkColumns, ", "), now().UnixNano(), tokenHash).
+		Scan(&l.TokenHash, &l.UserID, &l.Email, &createdAt, &expiresAt, &usedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	l.CreatedAt = time.Unix(0, createdAt).UTC()
+	l.ExpiresAt = time.Unix(0, expiresAt).UTC()
+	l.UsedAt = time.Unix(0, usedAt).UTC()
+	return &l, nil
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// CreateOAuthClient stores new client, CreatedAt of c is set on success.
+func (s *SQLite) CreateOAuthClient(ctx context.Context, c *OAuthClient) error {
+	defer observeQuery("sqlite", "create_oauth_client", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	createdAt := now()
+	_, err := s.conn.ExecContext(ctx, "INSERT INTO oauth_clients(id, secret_hash, token_endpoint_auth_method, name, redirect_uris, scopes, created_at) VALUES(?, ?, ?, ?, ?, ?, ?)",
+		c.ID, c.SecretHash, c.AuthMethod, c.Name, joinList(c.RedirectURIs), joinList(c.Scopes), createdAt.UnixNano())
+	if err != nil {
+		if isSQLiteUniqueViolationError(err) {
+			return ErrAlreadyExist
+		}
+		return err
+	}
+
+	c.CreatedAt = createdAt
+	return nil
+}
+
+// GetOAuthClient returns client by id.
+func (s *SQLite) GetOAuthClient(ctx context.Context, id string) (*OAuthClient, error) {
+	defer observeQuery("sqlite", "get_oauth_client", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		c                    OAuthClient
+		redirectURIs, scopes string
+		createdAt            int64
+	)
+	err := s.conn.QueryRowContext(ctx, "SELECT "+strings.Join(oauthClientColumns, ", ")+" FROM oauth_clients WHERE id = ?", id).
+		Scan(&c.ID, &c.SecretHash, &c.AuthMethod, &c.Name, &redirectURIs, &scopes, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	c.RedirectURIs = splitList(redirectURIs)
+	c.Scopes = splitList(scopes)
+	c.CreatedAt = time.Unix(0, createdAt).UTC()
+	return &c, nil
+}
+
+// CreateOAuthCode stores authorization code.
+func (s *SQLite) CreateOAuthCode(ctx context.Context, c *OAuthCode) error {
+	defer observeQuery("sqlite", "create_oauth_code", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn.ExecContext(ctx, "INSERT INTO oauth_codes("+strings.Join(oauthCodeColumns, ", ")+") VALUES(?, ?, ?, ?, ?, ?, ?, ?)",
+		c.CodeHash, c.ClientID, c.UserID, c.RedirectURI, c.Scope, c.CodeChallenge, c.ExpiresAt.UnixNano(), c.Nonce)
+	return err
+}
+
+// ConsumeOAuthCode removes and returns authorization code, so it can be used only once.
+// Expired codes are returned as well, the caller checks ExpiresAt.
+func (s *SQLite) ConsumeOAuthCode(ctx context.Context, codeHash string) (*OAuthCode, error) {
+	defer observeQuery("sqlite", "consume_oauth_code", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		c         OAuthCode
+		expiresAt int64
+	)
+	err := s.conn.QueryRowContext(ctx, "DELETE FROM oauth_codes WHERE code_hash = ? RETURNING "+strings.Join(oauthCodeColumns, ", "), codeHash).
+		Scan(&c.CodeHash, &c.ClientID, &c.UserID, &c.RedirectURI, &c.Scope, &c.CodeChallenge, &expiresAt, &c.Nonce)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	c.ExpiresAt = time.Unix(0, expiresAt).UTC()
+	return &c, nil
+}
+
+// SaveOAuthGrant creates or updates scopes the user approved for the client.
+func (s *SQLite) SaveOAuthGrant(ctx context.Context, g *OAuthGrant) error {
+	defer observeQuery("sqlite", "save_oauth_grant", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	t := now().UnixNano()
+	_, err := s.conn.ExecContext(ctx, "INSERT INTO oauth_grants(user_id, client_id, scope, created_at, updated_at) VALUES(?, ?, ?, ?, ?) "+
+		"ON CONFLICT(user_id, client_id) DO UPDATE SET scope = excluded.scope, updated_at = excluded.updated_at",
+		g.UserID, g.ClientID, g.Scope, t, t)
+	return err
+}
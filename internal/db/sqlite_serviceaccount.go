@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// CreateServiceAccount stores new account, CreatedAt of a is set on success.
+func (s *SQLite) CreateServiceAccount(ctx context.Context, a *ServiceAccount) error {
+	defer observeQuery("sqlite", "create_service_account", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	createdAt := now()
+	_, err := s.conn.ExecContext(ctx, "INSERT INTO service_accounts(id, name, secret_hash, public_key, scopes, created_at) VALUES(?, ?, ?, ?, ?, ?)",
+		a.ID, a.Name, a.SecretHash, a.PublicKey, joinList(a.Scopes), createdAt.UnixNano())
+	if err != nil {
+		if isSQLiteUniqueViolationError(err) {
+			return ErrAlreadyExist
+		}
+		return err
+	}
+
+	a.CreatedAt = createdAt
+	return nil
+}
+
+func scanSQLiteServiceAccount(r rowScanner) (*ServiceAccount, error) {
+	var (
+		a         ServiceAccount
+		scopes    string
+		createdAt int64
+	)
+	if err := r.Scan(&a.ID, &a.Name, &a.SecretHash, &a.PublicKey, &scopes, &createdAt); err != nil {
+		return nil, err
+	}
+
+	a.Scopes = splitList(scopes)
+	a.CreatedAt = time.Unix(0, createdAt).UTC()
+	return &a, nil
+}
+
+// GetServiceAccount returns account by id.
+func (s *SQLite) GetServiceAccount(ctx context.Context, id string) (*ServiceAccount, error) {
+	defer observeQuery("sqlite", "get_service_account", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	a, err := scanSQLiteServiceAccount(s.conn.QueryRowContext(ctx, "SELECT "+strings.Join(serviceAccountColumns, ", ")+" FROM service_accounts WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// ListServiceAccounts returns all accounts ordered by name.
+func (s *SQLite) ListServiceAccounts(ctx context.Context) ([]*ServiceAccount, error) {
+	defer observeQuery("sqlite", "list_service_accounts", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn.QueryContext(ctx, "SELECT "+strings.Join(serviceAccountColumns, ", ")+" FROM service_accounts ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var accounts []*ServiceAccount
+	for rows.Next() {
+		a, err := scanSQLiteServiceAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// DeleteServiceAccount removes account, ErrNotExist is returned if there is no such account.
+func (s *SQLite) DeleteServiceAccount(ctx context.Context, id string) error {
+	defer observeQuery("sqlite", "delete_service_account", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.conn.ExecContext(ctx, "DELETE FROM service_accounts WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotExist
+	}
+
+	return nil
+}
+
+// UseServiceAssertion records id of the assertion until it expires,
+// ErrAlreadyExist is returned if the assertion is already used. Expired ids of the account are removed.
+func (s *SQLite) UseServiceAssertion(ctx context.Context, accountID string, jti string, expiresAt time.Time) error {
+	defer observeQuery("sqlite", "use_service_assertion", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.conn.ExecContext(ctx, "DELETE FROM service_assertions WHERE account_id = ? AND expires_at < ?", accountID, now().UnixNano()); err != nil {
+		return err
+	}
+
+	_, err := s.conn.ExecContext(ctx, "INSERT INTO service_assertions(account_id, jti, expires_at) VALUES(?, ?, ?)", accountID, jti, expiresAt.UnixNano())
+	if err != nil {
+		if isSQLiteUniqueViolationError(err) {
+			return ErrAlreadyExist
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// CreateSession stores new session of s.UserID, ID, CreatedAt and LastSeenAt of s are set on success.
+func (s *SQLite) CreateSession(ctx context.Context, session *Session) error {
+	defer observeQuery("sqlite", "create_session", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	id, err := newSessionID()
+	if err != nil {
+		return err
+	}
+
+	createdAt := now()
+	_, err = s.conn.ExecContext(ctx, "INSERT INTO sessions(id, user_id, user_agent, client_ip, created_at, last_seen_at) VALUES(?, ?, ?, ?, ?, ?)",
+		id, session.UserID, session.UserAgent, session.ClientIP, createdAt.UnixNano(), createdAt.UnixNano())
+	if err != nil {
+		return err
+	}
+
+	session.ID = id
+	session.CreatedAt = createdAt
+	session.LastSeenAt = createdAt
+	return nil
+}
+
+func scanSQLiteSession(r rowScanner) (*Session, error) {
+	var (
+		s                     Session
+		createdAt, lastSeenAt int64
+		revokedAt             sql.NullInt64
+	)
+	if err := r.Scan(append(s.scanDest(), &createdAt, &lastSeenAt, &revokedAt)...); err != nil {
+		return nil, err
+	}
+
+	s.CreatedAt = time.Unix(0, createdAt).UTC()
+	s.LastSeenAt = time.Unix(0, lastSeenAt).UTC()
+	if revokedAt.Valid {
+		s.RevokedAt = time.Unix(0, revokedAt.Int64).UTC()
+	}
+	return &s, nil
+}
+
+// GetSession returns session by id including revoked one.
+func (s *SQLite) GetSession(ctx context.Context, id string) (*Session, error) {
+	defer observeQuery("sqlite", "get_session", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	session, err := scanSQLiteSession(s.conn.QueryRowContext(ctx, "SELECT "+strings.Join(sessionColumns, ", ")+" FROM sessions WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// ListSessions returns active sessions of the user most recently seen first.
+func (s *SQLite) ListSessions(ctx context.Context, userID int64) ([]*Session, error) {
+	defer observeQuery("sqlite", "list_sessions", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn.QueryContext(ctx, "SELECT "+strings.Join(sessionColumns, ", ")+" FROM sessions WHERE user_id = ? AND revoked_at IS NULL ORDER BY last_seen_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		session, err := scanSQLiteSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// TouchSession updates last seen time of the active session.
+func (s *SQLite) TouchSession(ctx context.Context, id string) error {
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.conn.ExecContext(ctx, "UPDATE sessions SET last_seen_at = ? WHERE id = ? AND revoked_at IS NULL", now().UnixNano(), id)
+	return err
+}
+
+// RevokeSession revokes active session of the user, ErrNotExist is returned if there is no such session.
+func (s *SQLite) RevokeSession(ctx context.Context, userID int64, id string) error {
+	defer observeQuery("sqlite", "revoke_session", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.conn.ExecContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL", now().UnixNano(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotExist
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions revokes all active sessions of the user except exceptID and returns their ids.
+func (s *SQLite) RevokeOtherSessions(ctx context.Context, userID int64, exceptID string) ([]string, error) {
+	defer observeQuery("sqlite", "revoke_other_sessions", time.Now())
+
+	ctx, cancel := s.opts.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.conn.QueryContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND id <> ? AND revoked_at IS NULL RETURNING id", now().UnixNano(), userID, exceptID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanIDs(rows)
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// statsCollector exports sql.DBStats of several databases labeled by db_name.
+type statsCollector struct {
+	dbs map[string]*sql.DB
+
+	maxOpenConnections *prometheus.Desc
+	openConnections    *prometheus.Desc
+	inUseConnections   *prometheus.Desc
+	idleConnections    *prometheus.Desc
+	waitCount          *prometheus.Desc
+	waitDuration       *prometheus.Desc
+	maxIdleClosed      *prometheus.Desc
+	maxIdleTimeClosed  *prometheus.Desc
+	maxLifetimeClosed  *prometheus.Desc
+}
+
+func newStatsCollector(dbs map[string]*sql.DB) *statsCollector {
+	desc := func(name string, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("go", "sql", name), help, []string{"db_name"}, nil)
+	}
+
+	return &statsCollector{
+		dbs:                dbs,
+		maxOpenConnections: desc("max_open_connections", "Maximum number of open connections to the database."),
+		openConnections:    desc("open_connections", "The number of established connections both in use and idle."),
+		inUseConnections:   desc("in_use_connections", "The number of connections currently in use."),
+		idleConnections:    desc("idle_connections", "The number of idle connections."),
+		waitCount:          desc("wait_count_total", "The total number of connections waited for."),
+		waitDuration:       desc("wait_duration_seconds_total", "The total time blocked waiting for a new connection."),
+		maxIdleClosed:      desc("max_idle_closed_total", "The total number of connections closed due to SetMaxIdleConns."),
+		maxIdleTimeClosed:  desc("max_idle_time_closed_total", "The total number of connections closed due to SetConnMaxIdleTime."),
+		maxLifetimeClosed:  desc("max_lifetime_closed_total", "The total number of connections closed due to SetConnMaxLifetime."),
+	}
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpenConnections
+	ch <- c.openConnections
+	ch <- c.inUseConnections
+	ch <- c.idleConnections
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClosed
+	ch <- c.maxIdleTimeClosed
+	ch <- c.maxLifetimeClosed
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, database := range c.dbs {
+		stats := database.Stats()
+		ch <- prometheus.MustNewConstMetric(c.maxOpenConnections, prometheus.GaugeValue, float64(stats.MaxOpenConnections), name)
+		ch <- prometheus.MustNewConstMetric(c.openConnections, prometheus.GaugeValue, float64(stats.OpenConnections), name)
+		ch <- prometheus.MustNewConstMetric(c.inUseConnections, prometheus.GaugeValue, float64(stats.InUse), name)
+		ch <- prometheus.MustNewConstMetric(c.idleConnections, prometheus.GaugeValue, float64(stats.Idle), name)
+		ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount), name)
+		ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(stats.MaxIdleClosed), name)
+		ch <- prometheus.MustNewConstMetric(c.maxIdleTimeClosed, prometheus.CounterValue, float64(stats.MaxIdleTimeClosed), name)
+		ch <- prometheus.MustNewConstMetric(c.maxLifetimeClosed, prometheus.CounterValue, float64(stats.MaxLifetimeClosed), name)
+	}
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/tracing"
+)
+
+// tracedConn starts span for every statement run on conn, query arguments are never recorded.
+// Postgres and SQLite storages run all statements through it.
+type tracedConn struct {
+	system string
+	conn   Transaction
+}
+
+// traceConn wraps database, replica or transaction conn of the system (postgres, sqlite).
+func traceConn(system string, conn Transaction) Transaction {
+	return &tracedConn{
+		system: system,
+		conn:   conn,
+	}
+}
+
+func (c *tracedConn) startSpan(ctx context.Context, query string) (context.Context, *tracing.Span) {
+	ctx, span := tracing.StartSpan(ctx, "sql.query")
+	span.SetAttribute("db.system", c.system)
+	span.SetAttribute("db.statement", query)
+	return ctx, span
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := c.startSpan(ctx, query)
+	defer span.Finish()
+
+	res, err := c.conn.ExecContext(ctx, query, args...)
+	span.SetError(err)
+	return res, err
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := c.startSpan(ctx, query)
+	defer span.Finish()
+
+	stmt, err := c.conn.PrepareContext(ctx, query)
+	span.SetError(err)
+	return stmt, err
+}
+
+// QueryContext span covers the query execution, rows are read after it is finished.
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := c.startSpan(ctx, query)
+	defer span.Finish()
+
+	rows, err := c.conn.QueryContext(ctx, query, args...)
+	span.SetError(err)
+	return rows, err
+}
+
+// QueryRowContext span records query error, sql.ErrNoRows is returned by Scan and isn't an error of the query.
+func (c *tracedConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := c.startSpan(ctx, query)
+	defer span.Finish()
+
+	row := c.conn.QueryRowContext(ctx, query, args...)
+	span.SetError(row.Err())
+	return row
+}
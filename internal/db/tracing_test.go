@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/tracing"
+)
+
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []*tracing.Span
+}
+
+func (e *recordingExporter) Export(s *tracing.Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.spans = append(e.spans, s)
+	return nil
+}
+
+func (e *recordingExporter) Close() error {
+	return nil
+}
+
+func TestQueriesAreTraced(t *testing.T) {
+	s := newTestSQLite(t)
+
+	e := &recordingExporter{}
+	tracing.SetExporter(e)
+	defer tracing.SetExporter(nil)
+
+	ctx, parent := tracing.StartSpan(context.Background(), "rpc")
+
+	// Create runs inside transaction, GetByName and CreateSession don't
+	if err := s.Create(ctx, &User{Name: "alice", Pwd: sql.NullString{String: "secret-hash", Valid: true}}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	user, err := s.GetByName(ctx, "alice")
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+
+	if err := s.CreateSession(ctx, &Session{ID: "session-1", UserID: user.ID}); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	parent.Finish()
+
+	var statements []string
+	for _, span := range e.spans {
+		if span == parent {
+			continue
+		}
+
+		if span.Name != "sql.query" || span.Attributes["db.system"] != "sqlite" {
+			t.Errorf("span %s attributes %v", span.Name, span.Attributes)
+		}
+
+		if span.Context.TraceID != parent.Context.TraceID || span.ParentID != parent.Context.SpanID {
+			t.Errorf("span of %q isn't a child of the rpc span", span.Attributes["db.statement"])
+		}
+
+		statement := span.Attributes["db.statement"]
+		if strings.Contains(statement, "secret-hash") {
+			t.Errorf("statement %q contains query argument", statement)
+		}
+		statements = append(statements, statement)
+	}
+
+	all := strings.Join(statements, "\n")
+	for _, want := range []string{"INSERT INTO Users", "WHERE Users.name", "INSERT INTO sessions"} {
+		if !strings.Contains(all, want) {
+			t.Errorf("no span of %q in %v", want, statements)
+		}
+	}
+}
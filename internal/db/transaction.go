@@ -1,29 +1,163 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	defaultTxRetries = 3
+	defaultTxBackoff = time.Millisecond * 50
 )
 
 type Transaction interface {
-	Exec(query string, args ...interface{}) (sql.Result, error)
-	Prepare(query string) (*sql.Stmt, error)
-	Query(query string, args ...interface{}) (*sql.Rows, error)
-	QueryRow(query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
 type TransactionFunc func(tx Transaction) error
 
-func WithTransaction(database *sql.DB, fn TransactionFunc) error {
-	tx, err := database.Begin()
+type TxOption func(o *txOptions)
+
+type txOptions struct {
+	sql.TxOptions
+	retries int
+	backoff time.Duration
+}
+
+// WithIsolation sets transaction isolation level, database default is used otherwise.
+func WithIsolation(level sql.IsolationLevel) TxOption {
+	return func(o *txOptions) {
+		o.Isolation = level
+	}
+}
+
+// WithReadOnly starts read only transaction.
+func WithReadOnly() TxOption {
+	return func(o *txOptions) {
+		o.ReadOnly = true
+	}
+}
+
+// WithRetries sets how many times transaction is repeated on serialization failure or deadlock
+// and initial back-off between attempts, back-off is doubled after each attempt.
+func WithRetries(count int, backoff time.Duration) TxOption {
+	return func(o *txOptions) {
+		o.retries = count
+		o.backoff = backoff
+	}
+}
+
+var savepointID uint64
+
+// errNestedTxOptions is returned for options of savepoint, it runs with options of the enclosing transaction.
+var errNestedTxOptions = errors.New("transaction options can't be applied to nested transaction")
+
+// WithTransaction runs fn inside transaction.
+// If conn is *sql.DB (traced or not) new transaction is started and retried on serialization failures and deadlocks,
+// otherwise conn is treated as already started transaction and fn runs inside a savepoint,
+// options are rejected then as the savepoint can't change the transaction or repeat it.
+// The transaction (or savepoint) is rolled back if fn returns error or panics.
+func WithTransaction(ctx context.Context, conn Transaction, fn TransactionFunc, opts ...TxOption) error {
+	if traced, ok := conn.(*tracedConn); ok {
+		return WithTransaction(ctx, traced.conn, func(tx Transaction) error {
+			return fn(traceConn(traced.system, tx))
+		}, opts...)
+	}
+
+	database, ok := conn.(*sql.DB)
+	if !ok {
+		if len(opts) > 0 {
+			return errNestedTxOptions
+		}
+		return withSavepoint(ctx, conn, fn)
+	}
+
+	o := txOptions{
+		retries: defaultTxRetries,
+		backoff: defaultTxBackoff,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	backoff := o.backoff
+	for attempt := 0; ; attempt++ {
+		err := runTransaction(ctx, database, &o.TxOptions, fn)
+		if err == nil || attempt >= o.retries || !isRetryableError(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func runTransaction(ctx context.Context, database *sql.DB, opts *sql.TxOptions, fn TransactionFunc) error {
+	tx, err := database.BeginTx(ctx, opts)
 	if err != nil {
 		return err
 	}
 
-	err = fn(tx)
-	if err != nil {
-		tx.Rollback()
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w, rollback error: %v", err, rbErr)
+		}
 		return err
 	}
 
 	return tx.Commit()
 }
+
+func withSavepoint(ctx context.Context, tx Transaction, fn TransactionFunc) error {
+	name := fmt.Sprintf("sp_%d", atomic.AddUint64(&savepointID, 1))
+
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rbErr != nil {
+			return fmt.Errorf("%w, rollback to savepoint error: %v", err, rbErr)
+		}
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
+
+// isRetryableError checks for serialization_failure and deadlock_detected errors.
+func isRetryableError(err error) bool {
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+	return false
+}
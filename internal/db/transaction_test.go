@@ -0,0 +1,230 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// newTxTestDB returns sqlite database with empty tx_test table.
+func newTxTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	s := newTestSQLite(t)
+	if _, err := s.db.Exec("CREATE TABLE tx_test(id integer PRIMARY KEY)"); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	return s.db
+}
+
+func insertTxTest(tx Transaction, id int) error {
+	_, err := tx.ExecContext(context.Background(), "INSERT INTO tx_test(id) VALUES(?)", id)
+	return err
+}
+
+// txTestIDs returns ids stored in tx_test table.
+func txTestIDs(t *testing.T, database *sql.DB) []int {
+	t.Helper()
+
+	rows, err := database.Query("SELECT id FROM tx_test ORDER BY id")
+	if err != nil {
+		t.Fatalf("select ids: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("scan id: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("select ids: %v", err)
+	}
+	return ids
+}
+
+func TestTransactionRollbackOnError(t *testing.T) {
+	database := newTxTestDB(t)
+	errFailed := errors.New("failed")
+
+	err := WithTransaction(context.Background(), database, func(tx Transaction) error {
+		if err := insertTxTest(tx, 1); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("transaction: %v, want %v", err, errFailed)
+	}
+
+	if ids := txTestIDs(t, database); len(ids) != 0 {
+		t.Errorf("ids %v of rolled back transaction are stored", ids)
+	}
+}
+
+func TestTransactionRollbackOnPanic(t *testing.T) {
+	database := newTxTestDB(t)
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("recovered %v, want boom", p)
+			}
+		}()
+
+		WithTransaction(context.Background(), database, func(tx Transaction) error {
+			if err := insertTxTest(tx, 1); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+
+	// the only connection is released, so the database is still usable
+	if ids := txTestIDs(t, database); len(ids) != 0 {
+		t.Errorf("ids %v of panicked transaction are stored", ids)
+	}
+}
+
+func TestTransactionSavepoints(t *testing.T) {
+	database := newTxTestDB(t)
+	ctx := context.Background()
+	errFailed := errors.New("failed")
+
+	err := WithTransaction(ctx, database, func(tx Transaction) error {
+		if err := insertTxTest(tx, 1); err != nil {
+			return err
+		}
+
+		// failed nested transaction rolls back only its own changes
+		if err := WithTransaction(ctx, tx, func(tx Transaction) error {
+			if err := insertTxTest(tx, 2); err != nil {
+				return err
+			}
+			return errFailed
+		}); !errors.Is(err, errFailed) {
+			t.Errorf("failed savepoint: %v, want %v", err, errFailed)
+		}
+
+		func() {
+			defer func() {
+				if p := recover(); p != "boom" {
+					t.Errorf("recovered %v, want boom", p)
+				}
+			}()
+
+			WithTransaction(ctx, tx, func(tx Transaction) error {
+				if err := insertTxTest(tx, 3); err != nil {
+					return err
+				}
+				panic("boom")
+			})
+		}()
+
+		return WithTransaction(ctx, tx, func(tx Transaction) error {
+			if err := insertTxTest(tx, 4); err != nil {
+				return err
+			}
+
+			// savepoints nest
+			return WithTransaction(ctx, tx, func(tx Transaction) error {
+				return insertTxTest(tx, 5)
+			})
+		})
+	})
+	if err != nil {
+		t.Fatalf("transaction: %v", err)
+	}
+
+	if ids := txTestIDs(t, database); len(ids) != 3 || ids[0] != 1 || ids[1] != 4 || ids[2] != 5 {
+		t.Errorf("ids %v, want 1, 4 and 5", ids)
+	}
+}
+
+func TestTransactionRejectsNestedOptions(t *testing.T) {
+	database := newTxTestDB(t)
+	ctx := context.Background()
+
+	err := WithTransaction(ctx, database, func(tx Transaction) error {
+		return WithTransaction(ctx, tx, func(tx Transaction) error {
+			return insertTxTest(tx, 1)
+		}, WithIsolation(sql.LevelSerializable))
+	})
+	if !errors.Is(err, errNestedTxOptions) {
+		t.Errorf("nested transaction with options: %v, want %v", err, errNestedTxOptions)
+	}
+}
+
+func TestTransactionRetries(t *testing.T) {
+	database := newTxTestDB(t)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name  string
+		err   error
+		calls int
+	}{
+		{"serialization failure", &pq.Error{Code: "40001"}, 3},
+		{"deadlock", &pq.Error{Code: "40P01"}, 3},
+		{"unique violation", &pq.Error{Code: "23505"}, 1},
+		{"other error", errors.New("failed"), 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int
+			start := time.Now()
+			err := WithTransaction(ctx, database, func(tx Transaction) error {
+				calls++
+				return tc.err
+			}, WithRetries(2, time.Millisecond*10))
+			if !errors.Is(err, tc.err) {
+				t.Errorf("transaction: %v, want %v", err, tc.err)
+			}
+
+			if calls != tc.calls {
+				t.Errorf("%d calls, want %d", calls, tc.calls)
+			}
+
+			// back-off is doubled: 10ms and 20ms
+			if elapsed := time.Since(start); tc.calls > 1 && elapsed < time.Millisecond*30 {
+				t.Errorf("retried within %v, want back-off", elapsed)
+			}
+		})
+	}
+}
+
+func TestTransactionRetriesStopOnCancel(t *testing.T) {
+	database := newTxTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var calls int
+	err := WithTransaction(ctx, database, func(tx Transaction) error {
+		calls++
+		cancel()
+		return &pq.Error{Code: "40001"}
+	}, WithRetries(5, time.Minute))
+	if err == nil {
+		t.Fatal("transaction: no error")
+	}
+
+	if calls != 1 {
+		t.Errorf("%d calls after cancel, want 1", calls)
+	}
+}
+
+func TestTransactionOptions(t *testing.T) {
+	var o txOptions
+	for _, opt := range []TxOption{WithIsolation(sql.LevelSerializable), WithReadOnly(), WithRetries(7, time.Second)} {
+		opt(&o)
+	}
+
+	if o.Isolation != sql.LevelSerializable || !o.ReadOnly || o.retries != 7 || o.backoff != time.Second {
+		t.Errorf("options %+v", o)
+	}
+}
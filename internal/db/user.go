@@ -2,8 +2,13 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
 )
 
+// MaxUserNameLength is the size of users name column.
+const MaxUserNameLength = 100
+
 type User struct {
 	ID     int64
 	Name   string
@@ -11,3 +16,25 @@ type User struct {
 	Public bool
 	Emails []Email
 }
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser scans row selected with userColumns followed by json array of emails.
+func scanUser(s rowScanner) (*User, error) {
+	var (
+		user   User
+		emails []byte
+	)
+
+	if err := s.Scan(&user.ID, &user.Name, &user.Pwd, &user.Public, &emails); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(emails, &user.Emails); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal emails: %w", err)
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,222 @@
+package directory
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	defaultTimeout        = time.Second * 5
+	defaultUserFilter     = "(uid=%s)"
+	defaultEmailAttribute = "mail"
+)
+
+var (
+	// ErrInvalidCredentials is returned when the user exists in the directory but the password doesn't match.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrUserNotFound is returned when the filter matches no directory entry.
+	ErrUserNotFound = errors.New("user not found")
+)
+
+type Config struct {
+	Enabled bool   `yaml:"enabled"`
+	URL     string `yaml:"url"`
+	// StartTLS upgrades plain ldap:// connection to TLS.
+	StartTLS           bool   `yaml:"start_tls"`
+	CAFile             string `yaml:"ca_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	// BindDN and BindPassword of the service account searching users, anonymous search is used if empty.
+	BindDN       string `yaml:"bind_dn"`
+	BindPassword string `yaml:"bind_password"`
+	BaseDN       string `yaml:"base_dn"`
+	// UserFilter is the search filter with %s replaced by escaped user name.
+	UserFilter     string `yaml:"user_filter"`
+	EmailAttribute string `yaml:"email_attribute"`
+	TimeoutSec     int    `yaml:"timeout"`
+	// AutoProvision creates local user on the first successful bind.
+	AutoProvision bool `yaml:"auto_provision"`
+}
+
+// Entry is the directory entry of authenticated user.
+type Entry struct {
+	DN    string
+	Email string
+}
+
+// LDAP authenticates users by bind to the directory with their password.
+type LDAP struct {
+	url           string
+	tlsConfig     *tls.Config
+	startTLS      bool
+	bindDN        string
+	bindPassword  string
+	baseDN        string
+	userFilter    string
+	emailAttr     string
+	timeout       time.Duration
+	autoProvision bool
+}
+
+func NewLDAP(cfg Config) (*LDAP, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return nil, fmt.Errorf("invalid ldap url: %q", cfg.URL)
+	}
+
+	if u.Scheme == "ldaps" && cfg.StartTLS {
+		return nil, errors.New("start_tls can't be used with ldaps url")
+	}
+
+	if cfg.BaseDN == "" {
+		return nil, errors.New("ldap base_dn is required")
+	}
+
+	userFilter := cfg.UserFilter
+	if userFilter == "" {
+		userFilter = defaultUserFilter
+	}
+
+	if strings.Count(userFilter, "%s") != 1 {
+		return nil, fmt.Errorf("ldap user_filter must contain single %%s: %q", userFilter)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ldap ca_file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates in ldap ca_file")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	timeout := time.Duration(cfg.TimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	emailAttr := cfg.EmailAttribute
+	if emailAttr == "" {
+		emailAttr = defaultEmailAttribute
+	}
+
+	return &LDAP{
+		url:           cfg.URL,
+		tlsConfig:     tlsConfig,
+		startTLS:      cfg.StartTLS,
+		bindDN:        cfg.BindDN,
+		bindPassword:  cfg.BindPassword,
+		baseDN:        cfg.BaseDN,
+		userFilter:    userFilter,
+		emailAttr:     emailAttr,
+		timeout:       timeout,
+		autoProvision: cfg.AutoProvision,
+	}, nil
+}
+
+// AutoProvision reports whether local users are created for authenticated directory users.
+func (l *LDAP) AutoProvision() bool {
+	return l.autoProvision
+}
+
+func (l *LDAP) dial(ctx context.Context) (*ldap.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout: l.timeout,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+
+	conn, err := ldap.DialURL(l.url, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(l.tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(l.timeout)
+
+	if l.startTLS {
+		if err := conn.StartTLS(l.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("start tls: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// Authenticate finds the user entry by name and binds as it with the password.
+func (l *LDAP) Authenticate(ctx context.Context, name string, password string) (*Entry, error) {
+	// empty password makes unauthenticated bind which succeeds on many servers
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := l.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if l.bindDN != "" {
+		if err := conn.Bind(l.bindDN, l.bindPassword); err != nil {
+			return nil, fmt.Errorf("service bind: %w", err)
+		}
+	}
+
+	rsp, err := conn.Search(ldap.NewSearchRequest(
+		l.baseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2,
+		int(l.timeout.Seconds()),
+		false,
+		fmt.Sprintf(l.userFilter, ldap.EscapeFilter(name)),
+		[]string{l.emailAttr},
+		nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, fmt.Errorf("user filter matches multiple entries for %q", name)
+		}
+		return nil, fmt.Errorf("search: %w", err)
+	}
+
+	switch len(rsp.Entries) {
+	case 0:
+		return nil, ErrUserNotFound
+	case 1:
+	default:
+		return nil, fmt.Errorf("user filter matches multiple entries for %q", name)
+	}
+
+	entry := rsp.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("user bind: %w", err)
+	}
+
+	return &Entry{
+		DN:    entry.DN,
+		Email: entry.GetAttributeValue(l.emailAttr),
+	}, nil
+}
@@ -0,0 +1,98 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/directory/ldaptest"
+)
+
+var testUser = ldaptest.User{
+	Name:     "erin",
+	Password: "ldappw",
+	Email:    "erin@example.com",
+}
+
+func newTestLDAP(t *testing.T, cfg Config) (*LDAP, *ldaptest.Server) {
+	t.Helper()
+
+	srv, err := ldaptest.NewServer(testUser)
+	if err != nil {
+		t.Fatalf("start ldap server: %v", err)
+	}
+	t.Cleanup(srv.Close)
+
+	cfg.URL = srv.URL()
+	cfg.BaseDN = ldaptest.BaseDN
+	cfg.TimeoutSec = 1
+
+	l, err := NewLDAP(cfg)
+	if err != nil {
+		t.Fatalf("create ldap: %v", err)
+	}
+	return l, srv
+}
+
+func TestAuthenticate(t *testing.T) {
+	for _, cfg := range []Config{
+		{},
+		{BindDN: ldaptest.ServiceDN, BindPassword: ldaptest.ServicePassword},
+	} {
+		l, _ := newTestLDAP(t, cfg)
+
+		entry, err := l.Authenticate(context.Background(), testUser.Name, testUser.Password)
+		if err != nil {
+			t.Fatalf("authenticate with bind dn %q: %v", cfg.BindDN, err)
+		}
+
+		if entry.DN != testUser.DN() || entry.Email != testUser.Email {
+			t.Errorf("entry %+v, want dn %s and email %s", entry, testUser.DN(), testUser.Email)
+		}
+	}
+}
+
+func TestAuthenticateRejects(t *testing.T) {
+	l, _ := newTestLDAP(t, Config{})
+
+	for _, tc := range []struct {
+		name     string
+		user     string
+		password string
+		want     error
+	}{
+		{"bad password", testUser.Name, "wrong", ErrInvalidCredentials},
+		{"empty password", testUser.Name, "", ErrInvalidCredentials},
+		{"unknown user", "frank", "ldappw", ErrUserNotFound},
+		{"filter injection", "*", "ldappw", ErrUserNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := l.Authenticate(context.Background(), tc.user, tc.password); !errors.Is(err, tc.want) {
+				t.Errorf("authenticate: %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateDirectoryDown(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cfg  Config
+		stop bool
+	}{
+		{"bad service password", Config{BindDN: ldaptest.ServiceDN, BindPassword: "wrong"}, false},
+		{"server is down", Config{}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l, srv := newTestLDAP(t, tc.cfg)
+			if tc.stop {
+				srv.Close()
+			}
+
+			_, err := l.Authenticate(context.Background(), testUser.Name, testUser.Password)
+			if err == nil || errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrUserNotFound) {
+				t.Errorf("authenticate: %v, want directory error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+// Package ldaptest provides in-process ldap server for tests of directory logins.
+package ldaptest
+
+import (
+	"net"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// BaseDN is the base dn entries of the server are under.
+const BaseDN = "ou=people,dc=example,dc=com"
+
+// Service account the server accepts besides users.
+const (
+	ServiceDN       = "cn=auth,dc=example,dc=com"
+	ServicePassword = "service"
+)
+
+// User is the directory entry found by (uid=Name) filter.
+type User struct {
+	Name     string
+	Password string
+	Email    string
+}
+
+// DN returns dn of the user entry.
+func (u User) DN() string {
+	return "uid=" + u.Name + "," + BaseDN
+}
+
+// Server answers simple bind and search requests, other operations close the connection.
+type Server struct {
+	l     net.Listener
+	users map[string]User
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// NewServer starts server with the users on the loopback interface.
+func NewServer(users ...User) (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := Server{
+		l:     l,
+		users: make(map[string]User, len(users)),
+		conns: make(map[net.Conn]struct{}),
+	}
+	for _, u := range users {
+		s.users[u.Name] = u
+	}
+
+	s.wg.Add(1)
+	go s.accept()
+	return &s, nil
+}
+
+// URL returns ldap:// url of the server.
+func (s *Server) URL() string {
+	return "ldap://" + s.l.Addr().String()
+}
+
+// Close stops the server, open connections are closed.
+func (s *Server) Close() {
+	s.l.Close()
+
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+
+	for {
+		c, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serve(c)
+
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Application tags of ldap operations, see RFC 4511 section 4.2.
+const (
+	tagBindRequest   = 0
+	tagBindResponse  = 1
+	tagUnbindRequest = 2
+	tagSearchRequest = 3
+	tagSearchEntry   = 4
+	tagSearchDone    = 5
+)
+
+func (s *Server) serve(c net.Conn) {
+	defer c.Close()
+
+	for {
+		p, err := ber.ReadPacket(c)
+		if err != nil || len(p.Children) < 2 {
+			return
+		}
+
+		id, ok := p.Children[0].Value.(int64)
+		if !ok {
+			return
+		}
+
+		var rsp [][]byte
+		op := p.Children[1]
+		switch op.Tag {
+		case tagBindRequest:
+			rsp = append(rsp, result(id, tagBindResponse, s.bind(op)))
+
+		case tagSearchRequest:
+			rsp = append(rsp, s.search(id, op)...)
+			rsp = append(rsp, result(id, tagSearchDone, ldap.LDAPResultSuccess))
+
+		default:
+			return
+		}
+
+		for _, b := range rsp {
+			if _, err := c.Write(b); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) bind(op *ber.Packet) int64 {
+	if len(op.Children) < 3 {
+		return ldap.LDAPResultProtocolError
+	}
+
+	dn, _ := op.Children[1].Value.(string)
+	password := op.Children[2].Data.String()
+
+	if dn == ServiceDN && password == ServicePassword {
+		return ldap.LDAPResultSuccess
+	}
+
+	for _, u := range s.users {
+		if u.DN() == dn && u.Password == password {
+			return ldap.LDAPResultSuccess
+		}
+	}
+	return ldap.LDAPResultInvalidCredentials
+}
+
+func (s *Server) search(id int64, op *ber.Packet) [][]byte {
+	if len(op.Children) < 7 {
+		return nil
+	}
+
+	filter, err := ldap.DecompileFilter(op.Children[6])
+	if err != nil {
+		return nil
+	}
+
+	var entries [][]byte
+	for _, u := range s.users {
+		if filter != "(uid="+ldap.EscapeFilter(u.Name)+")" {
+			continue
+		}
+
+		entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tagSearchEntry, nil, "")
+		entry.AppendChild(str(u.DN()))
+
+		attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attr.AppendChild(str("mail"))
+		values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		values.AppendChild(str(u.Email))
+		attr.AppendChild(values)
+		attrs.AppendChild(attr)
+		entry.AppendChild(attrs)
+
+		entries = append(entries, message(id, entry))
+	}
+	return entries
+}
+
+func str(s string) *ber.Packet {
+	return ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, s, "")
+}
+
+func message(id int64, op *ber.Packet) []byte {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	p.AppendChild(op)
+	return p.Bytes()
+}
+
+func result(id int64, tag ber.Tag, code int64) []byte {
+	r := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	r.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	r.AppendChild(str(""))
+	r.AppendChild(str(""))
+	return message(id, r)
+}
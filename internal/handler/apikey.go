@@ -0,0 +1,322 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/proto/apikey"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const (
+	// apiKeyPrefix makes keys recognizable by secret scanners.
+	apiKeyPrefix          = "fsk_"
+	apiKeyIDBytes         = 8
+	apiKeySecretBytes     = 32
+	maxAPIKeyNameLength   = 100
+	maxAPIKeysPerUser     = 50
+	defaultAPIKeyTokenTTL = time.Minute * 15
+)
+
+var apiKeyScopes = map[string]bool{
+	token.ScopeStorageRead:  true,
+	token.ScopeStorageWrite: true,
+}
+
+type apiKeyStorager interface {
+	CreateAPIKey(ctx context.Context, k *db.APIKey) error
+	GetAPIKey(ctx context.Context, id string) (*db.APIKey, error)
+	ListAPIKeys(ctx context.Context, userID int64) ([]*db.APIKey, error)
+	TouchAPIKey(ctx context.Context, id string) error
+	RevokeAPIKey(ctx context.Context, userID int64, id string) error
+}
+
+// WithAPIKeyTokenTTL sets lifetime of tokens ExchangeAPIKey issues.
+func WithAPIKeyTokenTTL(ttl time.Duration) Option {
+	return func(h *handler) {
+		h.apiKeyTokenTTL = ttl
+	}
+}
+
+// newAPIKey returns random key id and secret, the secret includes the id so the key can be looked up by it.
+func newAPIKey() (string, string, error) {
+	id := make([]byte, apiKeyIDBytes)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+
+	secret, err := shared.RandomString(apiKeySecretBytes)
+	if err != nil {
+		return "", "", err
+	}
+
+	keyID := hex.EncodeToString(id)
+	return keyID, apiKeyPrefix + keyID + "_" + secret, nil
+}
+
+// parseAPIKey returns id of the key secret.
+func parseAPIKey(secret string) (string, bool) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(secret, apiKeyPrefix), "_", 2)
+	if len(parts) != 2 || len(parts[0]) != apiKeyIDBytes*2 || parts[1] == "" {
+		return "", false
+	}
+
+	return parts[0], true
+}
+
+// parseAPIKeyScopes checks that scopes are supported by api keys and removes duplicates.
+func parseAPIKeyScopes(scopes []string) ([]string, bool) {
+	return parseScopes(apiKeyScopes, scopes)
+}
+
+func parseScopes(supported map[string]bool, scopes []string) ([]string, bool) {
+	seen := make(map[string]bool, len(scopes))
+	parsed := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		if !supported[s] {
+			return nil, false
+		}
+
+		if !seen[s] {
+			seen[s] = true
+			parsed = append(parsed, s)
+		}
+	}
+	return parsed, len(parsed) > 0
+}
+
+// unixOrZero returns unix time of t or zero for zero time.
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func marshalAPIKey(k *db.APIKey) *apikey.APIKey {
+	return &apikey.APIKey{
+		Id:         k.ID,
+		Name:       k.Name,
+		Scopes:     k.Scopes,
+		CreatedAt:  k.CreatedAt.Unix(),
+		ExpiresAt:  unixOrZero(k.ExpiresAt),
+		LastUsedAt: unixOrZero(k.LastUsedAt),
+	}
+}
+
+func (as *handler) CreateAPIKey(ctx context.Context, req *apikey.CreateAPIKeyRequest, rsp *apikey.CreateAPIKeyResponse) error {
+	claims, err := as.authenticateLogin(ctx, req.GetToken())
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSpace(req.GetName())
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		return httperror.NewInvalidParams("invalid name")
+	}
+
+	scopes, ok := parseAPIKeyScopes(req.GetScopes())
+	if !ok {
+		return httperror.NewInvalidParams("invalid scopes")
+	}
+
+	var expiresAt time.Time
+	if req.GetExpiresAt() != 0 {
+		expiresAt = time.Unix(req.GetExpiresAt(), 0).UTC()
+		if !expiresAt.After(time.Now()) {
+			return httperror.NewInvalidParams("expiration time is in the past")
+		}
+	}
+
+	keys, err := as.apiKeyRepo.ListAPIKeys(ctx, claims.User.ID)
+	if err != nil {
+		return httperror.NewInternalError("list api keys error").WithError(err)
+	}
+
+	// expired keys are listed until revoked, but they don't count against the limit
+	active := 0
+	now := time.Now()
+	for _, k := range keys {
+		if !k.IsExpired(now) {
+			active++
+		}
+	}
+
+	if active >= maxAPIKeysPerUser {
+		return httperror.NewInvalidParams("too many api keys")
+	}
+
+	id, secret, err := newAPIKey()
+	if err != nil {
+		return httperror.NewInternalError("generate api key error").WithError(err)
+	}
+
+	key := db.APIKey{
+		ID:         id,
+		UserID:     claims.User.ID,
+		Name:       name,
+		SecretHash: shared.HashSecret(secret),
+		Scopes:     scopes,
+		ExpiresAt:  expiresAt,
+	}
+	if err := as.apiKeyRepo.CreateAPIKey(ctx, &key); err != nil {
+		return httperror.NewInternalError("create api key error").WithError(err)
+	}
+
+	if err := as.audit(ctx, db.AuditEvent{
+		Type:     db.AuditAPIKeyCreate,
+		UserID:   claims.User.ID,
+		UserName: claims.User.Name,
+		Details:  "api key " + key.ID + ": " + strings.Join(scopes, " "),
+	}); err != nil {
+		return httperror.NewInternalError("audit error").WithError(err)
+	}
+
+	rsp.Key = marshalAPIKey(&key)
+	rsp.Secret = secret
+	return nil
+}
+
+func (as *handler) ListAPIKeys(ctx context.Context, req *apikey.ListAPIKeysRequest, rsp *apikey.ListAPIKeysResponse) error {
+	claims, err := as.authenticateLogin(ctx, req.GetToken())
+	if err != nil {
+		return err
+	}
+
+	keys, err := as.apiKeyRepo.ListAPIKeys(ctx, claims.User.ID)
+	if err != nil {
+		return httperror.NewInternalError("list api keys error").WithError(err)
+	}
+
+	rsp.Keys = make([]*apikey.APIKey, 0, len(keys))
+	for _, k := range keys {
+		rsp.Keys = append(rsp.Keys, marshalAPIKey(k))
+	}
+	return nil
+}
+
+func (as *handler) RevokeAPIKey(ctx context.Context, req *apikey.RevokeAPIKeyRequest, rsp *apikey.RevokeAPIKeyResponse) error {
+	claims, err := as.authenticateLogin(ctx, req.GetToken())
+	if err != nil {
+		return err
+	}
+
+	if err := as.apiKeyRepo.RevokeAPIKey(ctx, claims.User.ID, req.GetKeyId()); err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			return httperror.NewNotExistError("api key not exists")
+		}
+		return httperror.NewInternalError("revoke api key error").WithError(err)
+	}
+
+	if err := as.audit(ctx, db.AuditEvent{
+		Type:     db.AuditAPIKeyRevoke,
+		UserID:   claims.User.ID,
+		UserName: claims.User.Name,
+		Details:  "api key " + req.GetKeyId(),
+	}); err != nil {
+		return httperror.NewInternalError("audit error").WithError(err)
+	}
+
+	return nil
+}
+
+// rejectAPIKey records failed exchange of the known key and returns error the caller gets.
+// The reason is not returned, so the caller can't tell revoked key from the wrong secret.
+func (as *handler) rejectAPIKey(ctx context.Context, k *db.APIKey, outcome string) error {
+	apiKeyExchangesCounter.WithLabelValues(outcome).Inc()
+	auditErr := as.audit(ctx, db.AuditEvent{
+		Type:    db.AuditLoginFailure,
+		UserID:  k.UserID,
+		Details: "api key " + k.ID + ": " + strings.ReplaceAll(outcome, "_", " "),
+	})
+	return httperror.NewUnauthorized("invalid api key").WithError(auditErr)
+}
+
+// ExchangeAPIKey returns short-lived token limited to the scopes of the key.
+// Revoking the key doesn't invalidate tokens already issued for it, they expire shortly.
+func (as *handler) ExchangeAPIKey(ctx context.Context, req *apikey.ExchangeAPIKeyRequest, rsp *apikey.ExchangeAPIKeyResponse) error {
+	secret := req.GetSecret()
+	id, ok := parseAPIKey(secret)
+	if !ok {
+		apiKeyExchangesCounter.WithLabelValues(outcomeInvalid).Inc()
+		return httperror.NewUnauthorized("invalid api key")
+	}
+
+	key, err := as.apiKeyRepo.GetAPIKey(ctx, id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			apiKeyExchangesCounter.WithLabelValues(outcomeInvalid).Inc()
+			return httperror.NewUnauthorized("invalid api key")
+		}
+		apiKeyExchangesCounter.WithLabelValues(outcomeError).Inc()
+		return httperror.NewInternalError("get api key error").WithError(err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(shared.HashSecret(secret)), []byte(key.SecretHash)) != 1 {
+		return as.rejectAPIKey(ctx, key, outcomeBadSecret)
+	}
+
+	if key.IsRevoked() {
+		return as.rejectAPIKey(ctx, key, outcomeRevoked)
+	}
+
+	now := time.Now()
+	if key.IsExpired(now) {
+		return as.rejectAPIKey(ctx, key, outcomeExpired)
+	}
+
+	user, err := as.repo.GetByID(ctx, key.UserID)
+	if err != nil {
+		apiKeyExchangesCounter.WithLabelValues(outcomeError).Inc()
+		return httperror.NewInternalError("get user error").WithError(err)
+	}
+
+	if err := as.apiKeyRepo.TouchAPIKey(ctx, key.ID); err != nil {
+		apiKeyExchangesCounter.WithLabelValues(outcomeError).Inc()
+		return httperror.NewInternalError("touch api key error").WithError(err)
+	}
+
+	expiresAt := now.Add(as.apiKeyTokenTTL)
+	if !key.ExpiresAt.IsZero() && key.ExpiresAt.Before(expiresAt) {
+		expiresAt = key.ExpiresAt
+	}
+
+	tokenString, err := as.encoder.Encode(token.User{
+		ID:     user.ID,
+		Name:   user.Name,
+		Public: user.Public,
+	}, token.WithAPIKey(key.ID, strings.Join(key.Scopes, " ")), token.WithExpiresAt(expiresAt))
+	if err != nil {
+		apiKeyExchangesCounter.WithLabelValues(outcomeError).Inc()
+		return httperror.NewInternalError("encode token").WithError(err)
+	}
+
+	if err := as.audit(ctx, db.AuditEvent{
+		Type:     db.AuditAPIKeyExchange,
+		UserID:   user.ID,
+		UserName: user.Name,
+		Details:  "api key " + key.ID,
+	}); err != nil {
+		apiKeyExchangesCounter.WithLabelValues(outcomeError).Inc()
+		return httperror.NewInternalError("audit error").WithError(err)
+	}
+
+	apiKeyExchangesCounter.WithLabelValues(outcomeSuccess).Inc()
+	tokensCounter.WithLabelValues(tokenTypeAPIKey).Inc()
+
+	rsp.Token = tokenString
+	rsp.ExpiresAt = expiresAt.Unix()
+	return nil
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/proto/apikey"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+func createAPIKey(h *handler, loginToken string, expiresAt int64) (*apikey.CreateAPIKeyResponse, error) {
+	var rsp apikey.CreateAPIKeyResponse
+	err := h.CreateAPIKey(context.Background(), &apikey.CreateAPIKeyRequest{
+		Token:     loginToken,
+		Name:      "ci",
+		Scopes:    []string{token.ScopeStorageRead},
+		ExpiresAt: expiresAt,
+	}, &rsp)
+	return &rsp, err
+}
+
+func exchangeAPIKey(h *handler, secret string) (*apikey.ExchangeAPIKeyResponse, error) {
+	var rsp apikey.ExchangeAPIKeyResponse
+	err := h.ExchangeAPIKey(context.Background(), &apikey.ExchangeAPIKeyRequest{Secret: secret}, &rsp)
+	return &rsp, err
+}
+
+// storeAPIKey stores key of the user bypassing CreateAPIKey checks and returns its secret.
+func storeAPIKey(t *testing.T, m *db.Memory, userID int64, expiresAt time.Time) string {
+	t.Helper()
+
+	id, secret, err := newAPIKey()
+	if err != nil {
+		t.Fatalf("new api key: %v", err)
+	}
+
+	if err := m.CreateAPIKey(context.Background(), &db.APIKey{
+		ID:         id,
+		UserID:     userID,
+		Name:       "stored",
+		SecretHash: shared.HashSecret(secret),
+		Scopes:     []string{token.ScopeStorageRead},
+		ExpiresAt:  expiresAt,
+	}); err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+	return secret
+}
+
+func TestCreateAPIKeyShowsSecretOnce(t *testing.T) {
+	h, m := newTestHandler(t)
+	alice := createTestUser(t, m, "alice", "secret")
+	aliceToken := loginToken(t, h, "alice", "secret")
+
+	rsp, err := createAPIKey(h, aliceToken, 0)
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+
+	if !strings.HasPrefix(rsp.GetSecret(), apiKeyPrefix+rsp.GetKey().GetId()+"_") {
+		t.Errorf("secret %q doesn't carry key id %s", rsp.GetSecret(), rsp.GetKey().GetId())
+	}
+
+	stored, err := m.GetAPIKey(context.Background(), rsp.GetKey().GetId())
+	if err != nil {
+		t.Fatalf("get api key: %v", err)
+	}
+
+	if stored.UserID != alice.ID || stored.SecretHash != shared.HashSecret(rsp.GetSecret()) {
+		t.Errorf("stored key %+v, want hash of the secret", stored)
+	}
+
+	var list apikey.ListAPIKeysResponse
+	if err := h.ListAPIKeys(context.Background(), &apikey.ListAPIKeysRequest{Token: aliceToken}, &list); err != nil {
+		t.Fatalf("list api keys: %v", err)
+	}
+
+	if len(list.GetKeys()) != 1 || strings.Contains(list.GetKeys()[0].String(), rsp.GetSecret()) {
+		t.Errorf("listed keys %v, want the key without secret", list.GetKeys())
+	}
+}
+
+func TestExchangeAPIKey(t *testing.T) {
+	h, m := newTestHandler(t)
+	alice := createTestUser(t, m, "alice", "secret")
+	aliceToken := loginToken(t, h, "alice", "secret")
+
+	created, err := createAPIKey(h, aliceToken, 0)
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+
+	rsp, err := exchangeAPIKey(h, created.GetSecret())
+	if err != nil {
+		t.Fatalf("exchange api key: %v", err)
+	}
+
+	claims, err := h.decoder.Decode(rsp.GetToken())
+	if err != nil {
+		t.Fatalf("decode token: %v", err)
+	}
+
+	if claims.User.ID != alice.ID || claims.APIKeyID != created.GetKey().GetId() || claims.Scope != token.ScopeStorageRead || claims.SessionID != "" {
+		t.Errorf("claims %+v, want api key token of alice", claims)
+	}
+
+	wrongSecret := apiKeyPrefix + created.GetKey().GetId() + "_wrong"
+	if _, err := exchangeAPIKey(h, wrongSecret); errorCode(err) != httperror.CodeUnauthorized {
+		t.Errorf("exchange wrong secret: %v, want unauthorized", err)
+	}
+
+	if err := h.RevokeAPIKey(context.Background(), &apikey.RevokeAPIKeyRequest{Token: aliceToken, KeyId: created.GetKey().GetId()}, &apikey.RevokeAPIKeyResponse{}); err != nil {
+		t.Fatalf("revoke api key: %v", err)
+	}
+
+	if _, err := exchangeAPIKey(h, created.GetSecret()); errorCode(err) != httperror.CodeUnauthorized {
+		t.Errorf("exchange revoked key: %v, want unauthorized", err)
+	}
+
+	expired := storeAPIKey(t, m, alice.ID, time.Now().Add(-time.Minute))
+	if _, err := exchangeAPIKey(h, expired); errorCode(err) != httperror.CodeUnauthorized {
+		t.Errorf("exchange expired key: %v, want unauthorized", err)
+	}
+
+	if _, err := exchangeAPIKey(h, "not a key"); errorCode(err) != httperror.CodeUnauthorized {
+		t.Errorf("exchange malformed key: %v, want unauthorized", err)
+	}
+}
+
+func TestCreateAPIKeyLimitIgnoresExpiredKeys(t *testing.T) {
+	h, m := newTestHandler(t)
+	alice := createTestUser(t, m, "alice", "secret")
+	aliceToken := loginToken(t, h, "alice", "secret")
+
+	for i := 0; i < maxAPIKeysPerUser; i++ {
+		storeAPIKey(t, m, alice.ID, time.Now().Add(-time.Minute))
+	}
+
+	if _, err := createAPIKey(h, aliceToken, 0); err != nil {
+		t.Fatalf("create api key with expired keys only: %v", err)
+	}
+
+	for i := 1; i < maxAPIKeysPerUser; i++ {
+		storeAPIKey(t, m, alice.ID, time.Time{})
+	}
+
+	if _, err := createAPIKey(h, aliceToken, 0); errorCode(err) != httperror.CodeInvalidParams {
+		t.Errorf("create api key over the limit: %v, want invalid params", err)
+	}
+}
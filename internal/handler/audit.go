@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/proto/audit"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+type auditStorager interface {
+	AddAuditEvent(ctx context.Context, e *db.AuditEvent) error
+	ListAuditEvents(ctx context.Context, f db.AuditFilter) ([]*db.AuditEvent, error)
+}
+
+// audit records event with client info taken from ctx.
+func (as *handler) audit(ctx context.Context, e db.AuditEvent) error {
+	e.ClientIP, e.UserAgent = shared.ClientInfoFromContext(ctx)
+	return as.auditRepo.AddAuditEvent(ctx, &e)
+}
+
+func marshalAuditEvent(e *db.AuditEvent) *audit.AuditEvent {
+	return &audit.AuditEvent{
+		Id:        e.ID,
+		Type:      e.Type,
+		UserId:    e.UserID,
+		UserName:  e.UserName,
+		ActorId:   e.ActorID,
+		ClientIp:  e.ClientIP,
+		UserAgent: e.UserAgent,
+		Details:   e.Details,
+		CreatedAt: e.CreatedAt.Unix(),
+	}
+}
+
+func (as *handler) ListAuditEvents(ctx context.Context, req *audit.ListAuditEventsRequest, rsp *audit.ListAuditEventsResponse) error {
+	if req.GetLimit() < 0 || req.GetFrom() < 0 || req.GetTo() < 0 {
+		return httperror.NewInvalidParams("invalid filter")
+	}
+
+	claims, err := as.authenticate(ctx, req.GetToken())
+	if err != nil {
+		return err
+	}
+
+	userID := req.GetUserId()
+	switch {
+	case claims.IsService():
+		if !containsScopes(strings.Fields(claims.Scope), []string{token.ScopeAuditRead}) {
+			return httperror.NewUnauthorized(token.ScopeAuditRead + " scope is required")
+		}
+
+	case !isLoginToken(claims):
+		return httperror.NewUnauthorized("login token is required")
+
+	default:
+		if userID != 0 && userID != claims.User.ID {
+			return httperror.NewNotMatchError("events of other users are not allowed")
+		}
+		userID = claims.User.ID
+	}
+
+	f := db.AuditFilter{
+		UserID:   userID,
+		Type:     req.GetType(),
+		BeforeID: req.GetBeforeId(),
+		Limit:    int(req.GetLimit()),
+	}
+
+	if req.GetFrom() > 0 {
+		f.From = time.Unix(req.GetFrom(), 0)
+	}
+
+	if req.GetTo() > 0 {
+		f.To = time.Unix(req.GetTo(), 0)
+	}
+
+	events, err := as.auditRepo.ListAuditEvents(ctx, f)
+	if err != nil {
+		return httperror.NewInternalError("list audit events error").WithError(err)
+	}
+
+	rsp.Events = make([]*audit.AuditEvent, 0, len(events))
+	for _, e := range events {
+		rsp.Events = append(rsp.Events, marshalAuditEvent(e))
+	}
+	return nil
+}
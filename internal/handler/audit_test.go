@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/proto/audit"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+func TestListAuditEventsAuthorization(t *testing.T) {
+	h, m := newTestHandler(t)
+	alice := createTestUser(t, m, "alice", "secret")
+	bob := createTestUser(t, m, "bob", "secret")
+
+	aliceToken := loginToken(t, h, "alice", "secret")
+	loginToken(t, h, "bob", "secret")
+
+	serviceToken := func(scope string) string {
+		s, err := h.encoder.Encode(token.User{}, token.WithService(token.Service{ID: "svc_1", Name: "siem"}, scope))
+		if err != nil {
+			t.Fatalf("encode service token: %v", err)
+		}
+		return s
+	}
+
+	list := func(req *audit.ListAuditEventsRequest) ([]*audit.AuditEvent, error) {
+		var rsp audit.ListAuditEventsResponse
+		err := h.ListAuditEvents(context.Background(), req, &rsp)
+		return rsp.GetEvents(), err
+	}
+
+	events, err := list(&audit.ListAuditEventsRequest{Token: aliceToken})
+	if err != nil {
+		t.Fatalf("list own events: %v", err)
+	}
+
+	if len(events) == 0 {
+		t.Error("no events of alice")
+	}
+
+	for _, e := range events {
+		if e.GetUserId() != alice.ID {
+			t.Errorf("alice gets event of user %d", e.GetUserId())
+		}
+	}
+
+	if _, err := list(&audit.ListAuditEventsRequest{Token: aliceToken, UserId: bob.ID}); errorCode(err) != httperror.CodeNotMatch {
+		t.Errorf("list events of other user: %v, want not match", err)
+	}
+
+	if _, err := list(&audit.ListAuditEventsRequest{}); errorCode(err) != httperror.CodeUnauthorized {
+		t.Errorf("list without token: %v, want unauthorized", err)
+	}
+
+	if _, err := list(&audit.ListAuditEventsRequest{Token: serviceToken(token.ScopeStorageRead)}); errorCode(err) != httperror.CodeUnauthorized {
+		t.Errorf("list by service without audit scope: %v, want unauthorized", err)
+	}
+
+	events, err = list(&audit.ListAuditEventsRequest{Token: serviceToken(token.ScopeAuditRead)})
+	if err != nil {
+		t.Fatalf("list by service: %v", err)
+	}
+
+	users := make(map[int64]bool)
+	for _, e := range events {
+		users[e.GetUserId()] = true
+	}
+
+	if !users[alice.ID] || !users[bob.ID] {
+		t.Errorf("service gets events of users %v, want alice and bob", users)
+	}
+}
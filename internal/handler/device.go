@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/proto/device"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const (
+	defaultDeviceCodeTTL      = time.Minute * 10
+	defaultDevicePollInterval = time.Second * 5
+	// slowDownStep is added to poll interval of the device polling too often, see RFC 8628 section 3.5.
+	slowDownStep            = time.Second * 5
+	maxDeviceClientNameSize = 100
+	userCodeAttempts        = 3
+
+	deviceAuthorizationPending = "authorization_pending"
+	deviceSlowDown             = "slow_down"
+	deviceAccessDenied         = "access_denied"
+	deviceExpiredToken         = "expired_token"
+)
+
+type deviceStorager interface {
+	CreateDeviceCode(ctx context.Context, c *db.DeviceCode) error
+	GetDeviceCode(ctx context.Context, codeHash string) (*db.DeviceCode, error)
+	TouchDeviceCode(ctx context.Context, codeHash string, interval time.Duration) error
+	ConsumeDeviceCode(ctx context.Context, codeHash string) (*db.DeviceCode, error)
+}
+
+type deviceAuth struct {
+	verificationURI string
+	codeTTL         time.Duration
+	interval        time.Duration
+}
+
+// WithDeviceAuth enables device authorization, users approve devices on the verificationURI page.
+// Zero codeTTL and interval are replaced by defaults.
+func WithDeviceAuth(verificationURI string, codeTTL time.Duration, interval time.Duration) Option {
+	return func(h *handler) {
+		if codeTTL <= 0 {
+			codeTTL = defaultDeviceCodeTTL
+		}
+
+		if interval <= 0 {
+			interval = defaultDevicePollInterval
+		}
+
+		h.device = &deviceAuth{
+			verificationURI: verificationURI,
+			codeTTL:         codeTTL,
+			interval:        interval,
+		}
+	}
+}
+
+func (as *handler) StartDeviceAuth(ctx context.Context, req *device.StartDeviceAuthRequest, rsp *device.StartDeviceAuthResponse) error {
+	if as.device == nil {
+		return httperror.NewInvalidParams("device authorization is disabled")
+	}
+
+	clientName := strings.TrimSpace(req.GetClientName())
+	if len(clientName) > maxDeviceClientNameSize {
+		return httperror.NewInvalidParams("client name is too long")
+	}
+
+	deviceCode, err := shared.RandomString(32)
+	if err != nil {
+		return httperror.NewInternalError("generate device code error").WithError(err)
+	}
+
+	code := db.DeviceCode{
+		CodeHash:   shared.HashSecret(deviceCode),
+		ClientName: clientName,
+		Interval:   as.device.interval,
+		ExpiresAt:  time.Now().Add(as.device.codeTTL).UTC(),
+	}
+	code.ClientIP, _ = shared.ClientInfoFromContext(ctx)
+
+	// user codes are short, so they may collide
+	for attempt := 1; ; attempt++ {
+		code.UserCode, err = db.NewUserCode()
+		if err != nil {
+			return httperror.NewInternalError("generate user code error").WithError(err)
+		}
+
+		err = as.deviceRepo.CreateDeviceCode(ctx, &code)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, db.ErrAlreadyExist) || attempt == userCodeAttempts {
+			return httperror.NewInternalError("create device code error").WithError(err)
+		}
+	}
+
+	rsp.DeviceCode = deviceCode
+	rsp.UserCode = code.UserCode
+	rsp.VerificationUri = as.device.verificationURI
+	rsp.VerificationUriComplete = as.device.verificationURI + "?user_code=" + url.QueryEscape(code.UserCode)
+	rsp.ExpiresIn = int32(as.device.codeTTL.Seconds())
+	rsp.Interval = int32(code.Interval.Seconds())
+	return nil
+}
+
+// PollDeviceAuth returns token once the user approved the device, errors of RFC 8628 section 3.5
+// are returned in the response so the client can tell them from failures.
+func (as *handler) PollDeviceAuth(ctx context.Context, req *device.PollDeviceAuthRequest, rsp *device.PollDeviceAuthResponse) error {
+	if as.device == nil {
+		return httperror.NewInvalidParams("device authorization is disabled")
+	}
+
+	codeHash := shared.HashSecret(req.GetDeviceCode())
+	code, err := as.deviceRepo.GetDeviceCode(ctx, codeHash)
+	if err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			return httperror.NewNotExistError("device code not exists")
+		}
+		return httperror.NewInternalError("get device code error").WithError(err)
+	}
+
+	now := time.Now()
+	if now.After(code.ExpiresAt) {
+		rsp.Error = deviceExpiredToken
+		return nil
+	}
+
+	if code.Status == db.DeviceCodePending {
+		rsp.Error = deviceAuthorizationPending
+		interval := code.Interval
+		if !code.PolledAt.IsZero() && now.Sub(code.PolledAt) < code.Interval {
+			rsp.Error = deviceSlowDown
+			interval += slowDownStep
+		}
+
+		if err := as.deviceRepo.TouchDeviceCode(ctx, codeHash, interval); err != nil {
+			return httperror.NewInternalError("touch device code error").WithError(err)
+		}
+
+		rsp.Interval = int32(interval.Seconds())
+		return nil
+	}
+
+	code, err = as.deviceRepo.ConsumeDeviceCode(ctx, codeHash)
+	if err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			return httperror.NewNotExistError("device code not exists")
+		}
+		return httperror.NewInternalError("consume device code error").WithError(err)
+	}
+
+	if code.Status != db.DeviceCodeApproved {
+		rsp.Error = deviceAccessDenied
+		return nil
+	}
+
+	user, err := as.repo.GetByID(ctx, code.UserID)
+	if err != nil {
+		return httperror.NewInternalError("get user error").WithError(err)
+	}
+
+	session := db.Session{
+		UserID:    user.ID,
+		UserAgent: "device: " + code.ClientName,
+	}
+	session.ClientIP, _ = shared.ClientInfoFromContext(ctx)
+
+	if err := as.sessionRepo.CreateSession(ctx, &session); err != nil {
+		return httperror.NewInternalError("create session error").WithError(err)
+	}
+
+	tokenString, err := as.encoder.Encode(token.User{
+		ID:     user.ID,
+		Name:   user.Name,
+		Public: user.Public,
+	}, token.WithSessionID(session.ID))
+	if err != nil {
+		return httperror.NewInternalError("encode token").WithError(err)
+	}
+
+	if err := as.audit(ctx, db.AuditEvent{
+		Type:     db.AuditLoginSuccess,
+		UserID:   user.ID,
+		UserName: user.Name,
+		Details:  "device: session " + session.ID,
+	}); err != nil {
+		return httperror.NewInternalError("audit error").WithError(err)
+	}
+
+	tokensCounter.WithLabelValues(tokenTypeUser).Inc()
+
+	rsp.Token = tokenString
+	return nil
+}
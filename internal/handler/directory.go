@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/directory"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/tracing"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+// errDirectoryUnavailable wraps errors of the directory other than rejected credentials.
+var errDirectoryUnavailable = errors.New("directory is unavailable")
+
+type directoryAuthenticator interface {
+	Authenticate(ctx context.Context, name string, password string) (*directory.Entry, error)
+	AutoProvision() bool
+}
+
+type identityStorager interface {
+	CreateIdentity(ctx context.Context, i *db.Identity) error
+	GetIdentity(ctx context.Context, provider string, subject string) (*db.Identity, error)
+	TouchIdentity(ctx context.Context, provider string, subject string) error
+}
+
+// authenticateDirectory binds to the directory as the user and returns local user provisioned for the directory entry.
+// Nil user without error means the directory doesn't know the user. directory.ErrInvalidCredentials and
+// errDirectoryUnavailable are returned when the directory doesn't authenticate the user, local users still can log in then.
+// Local user with the same name not provisioned from the directory is a conflict, the directory can't take it over.
+// Names and entries that can't be stored are not accepted from the directory.
+func (as *handler) authenticateDirectory(ctx context.Context, name string, password string) (*db.User, error) {
+	if len(name) > db.MaxUserNameLength {
+		return nil, nil
+	}
+
+	spanCtx, span := tracing.StartSpan(ctx, "ldap.bind")
+	entry, err := as.directory.Authenticate(spanCtx, name, password)
+	if !errors.Is(err, directory.ErrInvalidCredentials) && !errors.Is(err, directory.ErrUserNotFound) {
+		span.SetError(err)
+	}
+	span.Finish()
+
+	switch {
+	case errors.Is(err, directory.ErrUserNotFound):
+		return nil, nil
+
+	case errors.Is(err, directory.ErrInvalidCredentials):
+		return nil, err
+
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", errDirectoryUnavailable, err)
+
+	case len(entry.DN) > db.MaxIdentitySubjectLength:
+		return nil, fmt.Errorf("%w: dn of %q is too long", errDirectoryUnavailable, name)
+	}
+
+	if len(entry.Email) > db.MaxEmailLength {
+		entry.Email = ""
+	}
+
+	user, err := as.linkedDirectoryUser(ctx, entry)
+	if err == nil {
+		return user, nil
+	}
+
+	if !errors.Is(err, db.ErrNotExist) {
+		loginsCounter.WithLabelValues(outcomeError).Inc()
+		return nil, httperror.NewInternalError("get directory user error").WithError(err)
+	}
+
+	_, err = as.repo.GetByName(ctx, name)
+	if err == nil {
+		return nil, as.rejectDirectoryConflict(ctx, name, entry)
+	}
+
+	if !errors.Is(err, db.ErrNotExist) {
+		loginsCounter.WithLabelValues(outcomeError).Inc()
+		return nil, httperror.NewInternalError("get user error").WithError(err)
+	}
+
+	if !as.directory.AutoProvision() {
+		loginsCounter.WithLabelValues(outcomeUnknownUser).Inc()
+		auditErr := as.audit(ctx, db.AuditEvent{
+			Type:     db.AuditLoginFailure,
+			UserName: name,
+			Details:  "ldap: no local user for " + entry.DN,
+		})
+		return nil, httperror.NewNotExistError("user not exists").WithError(auditErr)
+	}
+
+	user, err = as.provisionDirectoryUser(ctx, name, entry)
+	if err != nil {
+		if errors.Is(err, db.ErrAlreadyExist) {
+			// concurrent login of the same entry may have provisioned it
+			if user, err := as.linkedDirectoryUser(ctx, entry); err == nil {
+				return user, nil
+			}
+			return nil, as.rejectDirectoryConflict(ctx, name, entry)
+		}
+		loginsCounter.WithLabelValues(outcomeError).Inc()
+		registrationsCounter.WithLabelValues(outcomeError).Inc()
+		return nil, httperror.NewInternalError("provision user error").WithError(err)
+	}
+
+	return user, nil
+}
+
+// linkedDirectoryUser returns user provisioned for the directory entry, db.ErrNotExist is returned if there is none.
+func (as *handler) linkedDirectoryUser(ctx context.Context, entry *directory.Entry) (*db.User, error) {
+	identity, err := as.identityRepo.GetIdentity(ctx, db.IdentityDirectory, entry.DN)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := as.identityRepo.TouchIdentity(ctx, db.IdentityDirectory, entry.DN); err != nil {
+		return nil, err
+	}
+
+	user, err := as.repo.GetByID(ctx, identity.UserID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			return nil, fmt.Errorf("user %d of identity %s is missing", identity.UserID, entry.DN)
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// rejectDirectoryConflict records login of the directory user whose name is taken by the local user not provisioned for the entry.
+func (as *handler) rejectDirectoryConflict(ctx context.Context, name string, entry *directory.Entry) error {
+	loginsCounter.WithLabelValues(outcomeAlreadyExists).Inc()
+	auditErr := as.audit(ctx, db.AuditEvent{
+		Type:     db.AuditLoginFailure,
+		UserName: name,
+		Details:  "ldap: local user is not provisioned for " + entry.DN,
+	})
+	return httperror.NewAlreadyExistError("user exists and is not linked to the directory").WithError(auditErr)
+}
+
+// provisionDirectoryUser creates local user without password for the directory entry and links the entry to it,
+// email is copied unless it belongs to another user. db.ErrAlreadyExist is returned if the name is taken meanwhile.
+func (as *handler) provisionDirectoryUser(ctx context.Context, name string, entry *directory.Entry) (*db.User, error) {
+	user := db.User{
+		Name: name,
+	}
+
+	if entry.Email != "" {
+		_, err := as.repo.GetByEmail(ctx, entry.Email)
+		switch {
+		case errors.Is(err, db.ErrNotExist):
+			user.Emails = append(user.Emails, db.Email{
+				Email:   entry.Email,
+				Primary: true,
+			})
+		case err != nil:
+			return nil, err
+		}
+	}
+
+	if err := as.repo.Create(ctx, &user); err != nil {
+		return nil, err
+	}
+
+	if err := as.identityRepo.CreateIdentity(ctx, &db.Identity{
+		Provider: db.IdentityDirectory,
+		Subject:  entry.DN,
+		UserID:   user.ID,
+		Email:    entry.Email,
+	}); err != nil {
+		return nil, fmt.Errorf("create identity: %w", err)
+	}
+
+	registrationsCounter.WithLabelValues(outcomeSuccess).Inc()
+
+	if err := as.audit(ctx, db.AuditEvent{
+		Type:     db.AuditRegister,
+		UserID:   user.ID,
+		UserName: user.Name,
+		Details:  "ldap: " + entry.DN,
+	}); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
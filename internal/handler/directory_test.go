@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/directory"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/directory/ldaptest"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+var directoryUser = ldaptest.User{
+	Name:     "erin",
+	Password: "ldappw",
+	Email:    "erin@example.com",
+}
+
+// newDirectoryHandler returns handler authenticating by in-process ldap server with directoryUser and other users.
+func newDirectoryHandler(t *testing.T, autoProvision bool, users ...ldaptest.User) (*handler, *db.Memory, *ldaptest.Server) {
+	t.Helper()
+
+	srv, err := ldaptest.NewServer(append([]ldaptest.User{directoryUser}, users...)...)
+	if err != nil {
+		t.Fatalf("start ldap server: %v", err)
+	}
+	t.Cleanup(srv.Close)
+
+	l, err := directory.NewLDAP(directory.Config{
+		URL:           srv.URL(),
+		BindDN:        ldaptest.ServiceDN,
+		BindPassword:  ldaptest.ServicePassword,
+		BaseDN:        ldaptest.BaseDN,
+		TimeoutSec:    1,
+		AutoProvision: autoProvision,
+	})
+	if err != nil {
+		t.Fatalf("create ldap: %v", err)
+	}
+
+	h, m := newTestHandler(t, WithDirectory(l))
+	return h, m, srv
+}
+
+func TestDirectoryLoginProvisionsUser(t *testing.T) {
+	h, m, _ := newDirectoryHandler(t, true)
+	ctx := context.Background()
+
+	loginToken(t, h, directoryUser.Name, directoryUser.Password)
+
+	user, err := m.GetByName(ctx, directoryUser.Name)
+	if err != nil {
+		t.Fatalf("get provisioned user: %v", err)
+	}
+
+	if user.Pwd.Valid || len(user.Emails) != 1 || user.Emails[0].Email != directoryUser.Email {
+		t.Errorf("provisioned user %+v", user)
+	}
+
+	identity, err := m.GetIdentity(ctx, db.IdentityDirectory, directoryUser.DN())
+	if err != nil {
+		t.Fatalf("get identity: %v", err)
+	}
+
+	if identity.UserID != user.ID {
+		t.Errorf("identity is linked to user %d, want %d", identity.UserID, user.ID)
+	}
+
+	// the next login finds the linked user
+	loginToken(t, h, directoryUser.Name, directoryUser.Password)
+
+	if _, err := login(h, directoryUser.Name, "wrong"); errorCode(err) != httperror.CodeNotMatch {
+		t.Errorf("login with wrong password: %v, want not match", err)
+	}
+}
+
+func TestDirectoryLoginWithoutProvisioning(t *testing.T) {
+	h, m, _ := newDirectoryHandler(t, false)
+
+	if _, err := login(h, directoryUser.Name, directoryUser.Password); errorCode(err) != httperror.CodeNotExist {
+		t.Errorf("login without local user: %v, want not exist", err)
+	}
+
+	if _, err := m.GetByName(context.Background(), directoryUser.Name); err == nil {
+		t.Error("user is provisioned")
+	}
+}
+
+func TestDirectoryBadPassword(t *testing.T) {
+	h, m, _ := newDirectoryHandler(t, true)
+
+	badPassword := counterValue(t, loginsCounter, outcomeBadPassword)
+	if _, err := login(h, directoryUser.Name, "wrong"); errorCode(err) != httperror.CodeNotMatch {
+		t.Errorf("login with wrong password: %v, want not match", err)
+	}
+
+	if got := counterValue(t, loginsCounter, outcomeBadPassword); got != badPassword+1 {
+		t.Errorf("bad password logins %v, want %v", got, badPassword+1)
+	}
+
+	if _, err := m.GetByName(context.Background(), directoryUser.Name); err == nil {
+		t.Error("user is provisioned")
+	}
+}
+
+func TestDirectoryKeepsLocalUsers(t *testing.T) {
+	h, m, _ := newDirectoryHandler(t, true)
+	local := createTestUser(t, m, directoryUser.Name, "localpw")
+	createTestUser(t, m, "frank", "frankpw")
+
+	// users the directory doesn't know log in with local passwords
+	loginToken(t, h, "frank", "frankpw")
+
+	// the same name in the directory doesn't prevent login with the local password
+	loginToken(t, h, directoryUser.Name, "localpw")
+
+	// the directory user doesn't take the local user over
+	if _, err := login(h, directoryUser.Name, directoryUser.Password); errorCode(err) != httperror.CodeAlreadyExist {
+		t.Errorf("login of directory user: %v, want already exist", err)
+	}
+
+	if _, err := m.GetIdentity(context.Background(), db.IdentityDirectory, directoryUser.DN()); err == nil {
+		t.Errorf("local user %d is linked to the directory", local.ID)
+	}
+}
+
+func TestDirectoryDown(t *testing.T) {
+	h, m, srv := newDirectoryHandler(t, true)
+	createTestUser(t, m, "frank", "frankpw")
+
+	// provisioned while the directory is up
+	loginToken(t, h, directoryUser.Name, directoryUser.Password)
+	srv.Close()
+
+	loginToken(t, h, "frank", "frankpw")
+
+	if _, err := login(h, directoryUser.Name, directoryUser.Password); errorCode(err) != httperror.CodeInternalError {
+		t.Errorf("login of directory user: %v, want internal error", err)
+	}
+
+	if _, err := login(h, "grace", "gracepw"); errorCode(err) != httperror.CodeInternalError {
+		t.Errorf("login of unknown user: %v, want internal error", err)
+	}
+}
+
+func TestDirectoryValuesAreBounded(t *testing.T) {
+	longEmail := ldaptest.User{Name: "grace", Password: "gracepw", Email: strings.Repeat("g", db.MaxEmailLength) + "@example.com"}
+	longName := ldaptest.User{Name: strings.Repeat("h", db.MaxUserNameLength+1), Password: "heidipw"}
+	h, m, _ := newDirectoryHandler(t, true, longEmail, longName)
+	ctx := context.Background()
+
+	// email that can't be stored isn't copied
+	loginToken(t, h, longEmail.Name, longEmail.Password)
+
+	user, err := m.GetByName(ctx, longEmail.Name)
+	if err != nil {
+		t.Fatalf("get provisioned user: %v", err)
+	}
+
+	if len(user.Emails) != 0 {
+		t.Errorf("provisioned user has emails %+v", user.Emails)
+	}
+
+	identity, err := m.GetIdentity(ctx, db.IdentityDirectory, longEmail.DN())
+	if err != nil {
+		t.Fatalf("get identity: %v", err)
+	}
+
+	if identity.Email != "" {
+		t.Errorf("identity email %q, want none", identity.Email)
+	}
+
+	// name that can't be stored isn't looked up in the directory
+	if _, err := login(h, longName.Name, longName.Password); errorCode(err) != httperror.CodeNotExist {
+		t.Errorf("login with long name: %v, want not exist", err)
+	}
+
+	if _, err := m.GetByName(ctx, longName.Name); err == nil {
+		t.Error("user with long name is provisioned")
+	}
+}
+
+func TestAuthenticateByDirectory(t *testing.T) {
+	h, m, _ := newDirectoryHandler(t, true)
+	local := createTestUser(t, m, "alice", "localpw")
+	ctx := context.Background()
+
+	user, err := h.Authenticate(ctx, directoryUser.Name, directoryUser.Password)
+	if err != nil {
+		t.Fatalf("authenticate directory user: %v", err)
+	}
+
+	if provisioned, err := m.GetByName(ctx, directoryUser.Name); err != nil || provisioned.ID != user.ID {
+		t.Errorf("authenticated user %+v isn't provisioned: %v", user, err)
+	}
+
+	if user, err := h.Authenticate(ctx, local.Name, "localpw"); err != nil || user.ID != local.ID {
+		t.Errorf("authenticate local user: %+v, %v", user, err)
+	}
+
+	if _, err := h.Authenticate(ctx, directoryUser.Name, "wrong"); errorCode(err) != httperror.CodeNotMatch {
+		t.Errorf("authenticate with wrong password: %v, want not match", err)
+	}
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/serviceaccount"
+	serviceaccountpb "github.com/Mikhalevich/filesharing-auth-service/pkg/proto/serviceaccount"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+// intersectScopes returns scopes of a which are in b.
+func intersectScopes(a []string, b []string) []string {
+	set := make(map[string]bool, len(b))
+	for _, s := range b {
+		set[s] = true
+	}
+
+	var scopes []string
+	for _, s := range a {
+		if set[s] {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// ExchangeToken implements token exchange of RFC 8693 for services calling other services on behalf of the user.
+// The issued token keeps the user and the session of the subject token, it is restricted to the audience
+// and to the scopes both the service account and the subject token have, the service is recorded in act claim.
+// Tokens restricted to the audience other than the default one can be exchanged only by the service account with the audience name.
+func (as *handler) ExchangeToken(ctx context.Context, req *serviceaccountpb.ExchangeTokenRequest, rsp *serviceaccountpb.ExchangeTokenResponse) error {
+	audience := strings.TrimSpace(req.GetAudience())
+	if audience == "" || len(audience) > serviceaccount.MaxNameLength {
+		tokenExchangesCounter.WithLabelValues(outcomeInvalid).Inc()
+		return httperror.NewInvalidParams("invalid audience")
+	}
+
+	account, outcome, err := as.authenticateServiceAccount(ctx, req.GetClientId(), req.GetClientSecret(), req.GetClientAssertion())
+	if err != nil {
+		tokenExchangesCounter.WithLabelValues(outcome).Inc()
+		return err
+	}
+
+	subject, err := as.authenticate(ctx, req.GetSubjectToken())
+	if err != nil {
+		tokenExchangesCounter.WithLabelValues(outcomeInvalid).Inc()
+		return err
+	}
+
+	if subject.IsService() {
+		tokenExchangesCounter.WithLabelValues(outcomeInvalid).Inc()
+		return httperror.NewInvalidParams("subject token is not issued to the user")
+	}
+
+	if subject.Audience != "" && subject.Audience != as.defaultAudience && subject.Audience != account.Name {
+		tokenExchangesCounter.WithLabelValues(outcomeInvalid).Inc()
+		return httperror.NewUnauthorized("subject token is intended for other audience")
+	}
+
+	allowed := account.Scopes
+	if subject.Scope != "" {
+		allowed = intersectScopes(allowed, strings.Fields(subject.Scope))
+	}
+
+	scopes := allowed
+	if req.GetScope() != "" {
+		requested, ok := serviceaccount.ParseScopes(strings.Fields(req.GetScope()))
+		if !ok || !containsScopes(allowed, requested) {
+			tokenExchangesCounter.WithLabelValues(outcomeInvalid).Inc()
+			return httperror.NewInvalidParams("invalid scope")
+		}
+		scopes = requested
+	}
+
+	if len(scopes) == 0 {
+		tokenExchangesCounter.WithLabelValues(outcomeInvalid).Inc()
+		return httperror.NewInvalidParams("invalid scope")
+	}
+
+	expiresAt := time.Now().Add(as.serviceTokenTTL)
+	if subject.ExpiresAt != 0 && subject.ExpiresAt < expiresAt.Unix() {
+		expiresAt = time.Unix(subject.ExpiresAt, 0)
+	}
+
+	scope := strings.Join(scopes, " ")
+	tokenString, err := as.encoder.Encode(subject.User,
+		token.WithSessionID(subject.SessionID),
+		token.WithActor(token.Actor{
+			Subject: account.ID,
+			Actor:   subject.Actor,
+		}, scope),
+		token.WithAudience(audience),
+		token.WithExpiresAt(expiresAt),
+	)
+	if err != nil {
+		tokenExchangesCounter.WithLabelValues(outcomeError).Inc()
+		return httperror.NewInternalError("encode token").WithError(err)
+	}
+
+	if err := as.audit(ctx, db.AuditEvent{
+		Type:     db.AuditTokenExchange,
+		UserID:   subject.User.ID,
+		UserName: subject.User.Name,
+		Details:  "service account " + account.ID + " for " + audience + ": " + scope,
+	}); err != nil {
+		tokenExchangesCounter.WithLabelValues(outcomeError).Inc()
+		return httperror.NewInternalError("audit error").WithError(err)
+	}
+
+	tokenExchangesCounter.WithLabelValues(outcomeSuccess).Inc()
+	tokensCounter.WithLabelValues(tokenTypeExchange).Inc()
+
+	rsp.Token = tokenString
+	rsp.ExpiresAt = expiresAt.Unix()
+	rsp.Scope = scope
+	return nil
+}
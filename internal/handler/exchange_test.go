@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/serviceaccount"
+	serviceaccountpb "github.com/Mikhalevich/filesharing-auth-service/pkg/proto/serviceaccount"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+type testAccount struct {
+	id     string
+	secret string
+}
+
+// createSecretAccount stores service account authenticating by secret.
+func createSecretAccount(t *testing.T, m *db.Memory, name string, scopes ...string) testAccount {
+	t.Helper()
+
+	a, secret, err := serviceaccount.New(name, scopes, "")
+	if err != nil {
+		t.Fatalf("new service account: %v", err)
+	}
+
+	if err := m.CreateServiceAccount(context.Background(), a); err != nil {
+		t.Fatalf("create service account: %v", err)
+	}
+	return testAccount{id: a.ID, secret: secret}
+}
+
+func exchange(h *handler, a testAccount, subjectToken string, audience string, scope string) (*serviceaccountpb.ExchangeTokenResponse, error) {
+	var rsp serviceaccountpb.ExchangeTokenResponse
+	err := h.ExchangeToken(context.Background(), &serviceaccountpb.ExchangeTokenRequest{
+		ClientId:     a.id,
+		ClientSecret: a.secret,
+		SubjectToken: subjectToken,
+		Audience:     audience,
+		Scope:        scope,
+	}, &rsp)
+	return &rsp, err
+}
+
+func encodeToken(t *testing.T, h *handler, user token.User, opts ...token.EncodeOption) string {
+	t.Helper()
+
+	s, err := h.encoder.Encode(user, opts...)
+	if err != nil {
+		t.Fatalf("encode token: %v", err)
+	}
+	return s
+}
+
+func TestExchangeTokenScopes(t *testing.T) {
+	h, m := newTestHandler(t)
+	alice := createTestUser(t, m, "alice", "secret")
+	gateway := createSecretAccount(t, m, "gateway", token.ScopeStorageRead, token.ScopeStorageWrite)
+
+	loginRsp, err := exchange(h, gateway, loginToken(t, h, "alice", "secret"), "storage", "")
+	if err != nil {
+		t.Fatalf("exchange login token: %v", err)
+	}
+
+	if loginRsp.GetScope() != token.ScopeStorageRead+" "+token.ScopeStorageWrite {
+		t.Errorf("scope of exchanged login token %q, want scopes of the account", loginRsp.GetScope())
+	}
+
+	// api key token allows reading only, the account can't widen it
+	readToken := encodeToken(t, h, token.User{ID: alice.ID, Name: alice.Name}, token.WithAPIKey("fsk_1", token.ScopeStorageRead))
+
+	rsp, err := exchange(h, gateway, readToken, "storage", "")
+	if err != nil {
+		t.Fatalf("exchange read token: %v", err)
+	}
+
+	if rsp.GetScope() != token.ScopeStorageRead {
+		t.Errorf("scope %q, want intersection %q", rsp.GetScope(), token.ScopeStorageRead)
+	}
+
+	if _, err := exchange(h, gateway, readToken, "storage", token.ScopeStorageWrite); errorCode(err) != httperror.CodeInvalidParams {
+		t.Errorf("exchange for scope subject doesn't have: %v, want invalid params", err)
+	}
+
+	auditor := createSecretAccount(t, m, "auditor", token.ScopeAuditRead)
+	if _, err := exchange(h, auditor, readToken, "storage", ""); errorCode(err) != httperror.CodeInvalidParams {
+		t.Errorf("exchange without common scopes: %v, want invalid params", err)
+	}
+}
+
+func TestExchangeTokenRejectsServiceSubject(t *testing.T) {
+	h, m := newTestHandler(t)
+	gateway := createSecretAccount(t, m, "gateway", token.ScopeStorageRead)
+
+	serviceToken := encodeToken(t, h, token.User{}, token.WithService(token.Service{ID: gateway.id, Name: "gateway"}, token.ScopeStorageRead))
+	if _, err := exchange(h, gateway, serviceToken, "storage", ""); errorCode(err) != httperror.CodeInvalidParams {
+		t.Errorf("exchange service token: %v, want invalid params", err)
+	}
+}
+
+func TestExchangeTokenAudience(t *testing.T) {
+	h, m := newTestHandler(t)
+	alice := createTestUser(t, m, "alice", "secret")
+	gateway := createSecretAccount(t, m, "gateway", token.ScopeStorageRead)
+	billing := createSecretAccount(t, m, "billing", token.ScopeStorageRead)
+
+	billingToken := encodeToken(t, h, token.User{ID: alice.ID, Name: alice.Name},
+		token.WithAPIKey("fsk_1", token.ScopeStorageRead), token.WithAudience("billing"))
+
+	if _, err := exchange(h, gateway, billingToken, "storage", ""); errorCode(err) != httperror.CodeUnauthorized {
+		t.Errorf("exchange token of other audience: %v, want unauthorized", err)
+	}
+
+	if _, err := exchange(h, billing, billingToken, "storage", ""); err != nil {
+		t.Errorf("exchange by the audience of the token: %v", err)
+	}
+}
+
+func TestExchangeTokenExpiry(t *testing.T) {
+	h, m := newTestHandler(t, WithServiceTokenTTL(time.Hour))
+	alice := createTestUser(t, m, "alice", "secret")
+	gateway := createSecretAccount(t, m, "gateway", token.ScopeStorageRead)
+
+	expiresAt := time.Now().Add(time.Minute)
+	subject := encodeToken(t, h, token.User{ID: alice.ID, Name: alice.Name},
+		token.WithAPIKey("fsk_1", token.ScopeStorageRead), token.WithExpiresAt(expiresAt))
+
+	rsp, err := exchange(h, gateway, subject, "storage", "")
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+
+	if rsp.GetExpiresAt() != expiresAt.Unix() {
+		t.Errorf("expires at %d, want expiration of the subject token %d", rsp.GetExpiresAt(), expiresAt.Unix())
+	}
+
+	claims, err := h.decoder.Decode(rsp.GetToken())
+	if err != nil {
+		t.Fatalf("decode exchanged token: %v", err)
+	}
+
+	if claims.ExpiresAt != expiresAt.Unix() {
+		t.Errorf("exp %d, want %d", claims.ExpiresAt, expiresAt.Unix())
+	}
+}
+
+func TestExchangeTokenActorChain(t *testing.T) {
+	h, m := newTestHandler(t)
+	alice := createTestUser(t, m, "alice", "secret")
+	gateway := createSecretAccount(t, m, "gateway", token.ScopeStorageRead)
+	storage := createSecretAccount(t, m, "storage", token.ScopeStorageRead)
+
+	first, err := exchange(h, gateway, loginToken(t, h, "alice", "secret"), "storage", "")
+	if err != nil {
+		t.Fatalf("exchange by gateway: %v", err)
+	}
+
+	// storage calls the next service with the token gateway has exchanged for it
+	second, err := exchange(h, storage, first.GetToken(), "files", "")
+	if err != nil {
+		t.Fatalf("exchange by storage: %v", err)
+	}
+
+	claims, err := h.decoder.Decode(second.GetToken())
+	if err != nil {
+		t.Fatalf("decode exchanged token: %v", err)
+	}
+
+	if claims.User.ID != alice.ID || claims.Audience != "files" {
+		t.Errorf("claims %+v, want user alice and audience files", claims)
+	}
+
+	if claims.Actor == nil || claims.Actor.Subject != storage.id ||
+		claims.Actor.Actor == nil || claims.Actor.Actor.Subject != gateway.id || claims.Actor.Actor.Actor != nil {
+		t.Errorf("actor %+v, want storage acting for gateway", claims.Actor)
+	}
+}
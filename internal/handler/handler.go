@@ -3,34 +3,112 @@ package handler
 import (
 	"context"
 	"errors"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/directory"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/throttle"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/tracing"
 	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
 	"github.com/Mikhalevich/filesharing/pkg/httperror"
 	"github.com/Mikhalevich/filesharing/pkg/proto/auth"
 )
 
 type storager interface {
-	GetByName(name string) (*db.User, error)
-	GetByEmail(email string) (*db.User, error)
-	Create(u *db.User) error
-	GetPublicUsers() ([]*db.User, error)
+	GetByID(ctx context.Context, id int64) (*db.User, error)
+	GetByName(ctx context.Context, name string) (*db.User, error)
+	GetByEmail(ctx context.Context, email string) (*db.User, error)
+	Create(ctx context.Context, u *db.User) error
+	GetPublicUsers(ctx context.Context) ([]*db.User, error)
+}
+
+// dataStorager keeps everything besides users, which are served by storager.
+type dataStorager interface {
+	auditStorager
+	sessionStorager
+	apiKeyStorager
+	deviceStorager
+	magicLinkStorager
+	serviceAccountStorager
+	identityStorager
 }
 
 type handler struct {
-	repo    storager
-	encoder token.Encoder
+	repo               storager
+	auditRepo          auditStorager
+	sessionRepo        sessionStorager
+	apiKeyRepo         apiKeyStorager
+	deviceRepo         deviceStorager
+	magicLinkRepo      magicLinkStorager
+	serviceAccountRepo serviceAccountStorager
+	identityRepo       identityStorager
+	encoder            token.Encoder
+	decoder            token.Decoder
+	directory          directoryAuthenticator
+	device             *deviceAuth
+	magicLink          *magicLinkAuth
+	loginThrottle      *throttle.Limiter
+
+	apiKeyTokenTTL  time.Duration
+	serviceTokenTTL time.Duration
+	defaultAudience string
+}
+
+type Option func(h *handler)
+
+// WithDirectory makes Auth verify credentials by the directory first,
+// local passwords are checked when the directory doesn't authenticate the user.
+func WithDirectory(d directoryAuthenticator) Option {
+	return func(h *handler) {
+		h.directory = d
+	}
+}
+
+// WithLoginThrottle sets limiter locking user names out for the client address after failed logins,
+// it can be shared with other login pages so failures are counted together. Logins aren't limited without it.
+func WithLoginThrottle(l *throttle.Limiter) Option {
+	return func(h *handler) {
+		h.loginThrottle = l
+	}
 }
 
-func New(s storager, te token.Encoder) *handler {
-	return &handler{
-		repo:    s,
-		encoder: te,
+// WithDefaultAudience sets audience the encoder gives to tokens by default,
+// any service account can exchange tokens with it.
+func WithDefaultAudience(audience string) Option {
+	return func(h *handler) {
+		h.defaultAudience = audience
 	}
 }
 
+func New(s storager, ds dataStorager, te token.Encoder, td token.Decoder, opts ...Option) *handler {
+	h := handler{
+		repo:               s,
+		auditRepo:          ds,
+		sessionRepo:        ds,
+		apiKeyRepo:         ds,
+		deviceRepo:         ds,
+		magicLinkRepo:      ds,
+		serviceAccountRepo: ds,
+		identityRepo:       ds,
+		encoder:            te,
+		decoder:            td,
+
+		loginThrottle: throttle.NewLimiter(0, throttle.DefaultWindow),
+
+		apiKeyTokenTTL:  defaultAPIKeyTokenTTL,
+		serviceTokenTTL: defaultServiceTokenTTL,
+	}
+
+	for _, opt := range opts {
+		opt(&h)
+	}
+
+	return &h
+}
+
 func unmarshalUser(u *auth.User) *db.User {
 	user := db.User{
 		ID:     u.GetId(),
@@ -52,64 +130,213 @@ func unmarshalUser(u *auth.User) *db.User {
 // }
 
 func (as *handler) Create(ctx context.Context, req *auth.CreateUserRequest, rsp *auth.CreateUserResponse) error {
+	_, span := tracing.StartSpan(ctx, "password.hash")
+	start := time.Now()
 	hashedPass, err := bcrypt.GenerateFromPassword([]byte(req.GetUser().GetPassword()), bcrypt.DefaultCost)
+	observeHash(hashGenerate, start)
+	span.SetError(err)
+	span.Finish()
 	if err != nil {
+		registrationsCounter.WithLabelValues(outcomeError).Inc()
 		return httperror.NewInternalError("hash password error").WithError(err)
 	}
 
 	ru := req.GetUser()
 	if ru == nil {
+		registrationsCounter.WithLabelValues(outcomeInvalid).Inc()
 		return httperror.NewInvalidParams("invalid user")
 	}
 
 	ru.Password = string(hashedPass)
 	user := unmarshalUser(ru)
-	if err := as.repo.Create(user); err != nil {
+	if err := as.repo.Create(ctx, user); err != nil {
 		if errors.Is(err, db.ErrAlreadyExist) {
+			registrationsCounter.WithLabelValues(outcomeAlreadyExists).Inc()
 			return httperror.NewAlreadyExistError("user already exists")
 		}
+		registrationsCounter.WithLabelValues(outcomeError).Inc()
 		return httperror.NewInternalError("create user error").WithError(err)
 	}
 
+	registrationsCounter.WithLabelValues(outcomeSuccess).Inc()
+
+	if err := as.audit(ctx, db.AuditEvent{
+		Type:     db.AuditRegister,
+		UserID:   user.ID,
+		UserName: user.Name,
+	}); err != nil {
+		return httperror.NewInternalError("audit error").WithError(err)
+	}
+
+	session, err := as.newSession(ctx, user.ID)
+	if err != nil {
+		return httperror.NewInternalError("create session error").WithError(err)
+	}
+
 	token, err := as.encoder.Encode(token.User{
 		ID:     user.ID,
 		Name:   user.Name,
 		Public: user.Public,
-	})
+	}, token.WithSessionID(session.ID))
 
 	if err != nil {
 		return httperror.NewInternalError("encode token").WithError(err)
 	}
 
+	tokensCounter.WithLabelValues(tokenTypeUser).Inc()
+
 	rsp.Token = &auth.Token{
 		Value: token,
 	}
 	return nil
 }
 
-func (as *handler) Auth(ctx context.Context, req *auth.AuthUserRequest, rsp *auth.AuthUserResponse) error {
-	user, err := as.repo.GetByName(req.GetUser().GetName())
+// loginKey returns login throttle key of the name tried by the client of ctx.
+func loginKey(ctx context.Context, name string) string {
+	clientIP, _ := shared.ClientInfoFromContext(ctx)
+	return throttle.Key(clientIP, name)
+}
+
+// authenticateLocal checks password of the user against the stored bcrypt hash.
+// dirErr is why the directory hasn't authenticated the user: password it rejected is reported for users without local account,
+// unavailable directory is reported if the user can't log in without it.
+func (as *handler) authenticateLocal(ctx context.Context, name string, password string, dirErr error) (*db.User, error) {
+	user, err := as.repo.GetByName(ctx, name)
 	if err != nil {
 		if errors.Is(err, db.ErrNotExist) {
-			return httperror.NewNotExistError("user not exists")
+			if errors.Is(dirErr, directory.ErrInvalidCredentials) {
+				loginsCounter.WithLabelValues(outcomeBadPassword).Inc()
+				as.loginThrottle.Fail(loginKey(ctx, name))
+				auditErr := as.audit(ctx, db.AuditEvent{
+					Type:     db.AuditLoginFailure,
+					UserName: name,
+					Details:  "ldap: bad password",
+				})
+				return nil, httperror.NewNotMatchError("pwd not match").WithError(auditErr)
+			}
+
+			if dirErr != nil {
+				loginsCounter.WithLabelValues(outcomeError).Inc()
+				return nil, httperror.NewInternalError("directory error").WithError(dirErr)
+			}
+			loginsCounter.WithLabelValues(outcomeUnknownUser).Inc()
+			as.loginThrottle.Fail(loginKey(ctx, name))
+			auditErr := as.audit(ctx, db.AuditEvent{
+				Type:     db.AuditLoginFailure,
+				UserName: name,
+				Details:  "unknown user",
+			})
+			return nil, httperror.NewNotExistError("user not exists").WithError(auditErr)
+		}
+		loginsCounter.WithLabelValues(outcomeError).Inc()
+		return nil, httperror.NewInternalError("get user error").WithError(err)
+	}
+
+	if !user.Pwd.Valid && errors.Is(dirErr, errDirectoryUnavailable) {
+		loginsCounter.WithLabelValues(outcomeError).Inc()
+		return nil, httperror.NewInternalError("directory error").WithError(dirErr)
+	}
+
+	_, span := tracing.StartSpan(ctx, "password.compare")
+	start := time.Now()
+	err = bcrypt.CompareHashAndPassword([]byte(user.Pwd.String), []byte(password))
+	observeHash(hashCompare, start)
+	span.Finish()
+	if err != nil {
+		loginsCounter.WithLabelValues(outcomeBadPassword).Inc()
+		as.loginThrottle.Fail(loginKey(ctx, name))
+		auditErr := as.audit(ctx, db.AuditEvent{
+			Type:     db.AuditLoginFailure,
+			UserID:   user.ID,
+			UserName: user.Name,
+			Details:  "bad password",
+		})
+		return nil, httperror.NewNotMatchError("pwd not match").WithError(auditErr)
+	}
+
+	return user, nil
+}
+
+// authenticateUser checks password of the user by the directory first and then against the local password,
+// details prefix login event of the user authenticated by the directory.
+func (as *handler) authenticateUser(ctx context.Context, name string, password string) (*db.User, string, error) {
+	var dirErr error
+	if as.directory != nil {
+		user, err := as.authenticateDirectory(ctx, name, password)
+		switch {
+		case errors.Is(err, directory.ErrInvalidCredentials), errors.Is(err, errDirectoryUnavailable):
+			// local password of the user is checked then
+			dirErr = err
+		case err != nil:
+			return nil, "", err
+		case user != nil:
+			return user, "ldap: ", nil
 		}
-		return httperror.NewInternalError("get user error").WithError(err)
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Pwd.String), []byte(req.GetUser().GetPassword())); err != nil {
-		return httperror.NewNotMatchError("pwd not match")
+	user, err := as.authenticateLocal(ctx, name, password, dirErr)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, "", nil
+}
+
+// Authenticate returns user by name and password the same way Auth does, it is used by the oauth server pages.
+// Failures are audited and counted by the login throttle, checking the lockout is up to the caller.
+func (as *handler) Authenticate(ctx context.Context, name string, password string) (*db.User, error) {
+	user, _, err := as.authenticateUser(ctx, name, password)
+	return user, err
+}
+
+func (as *handler) Auth(ctx context.Context, req *auth.AuthUserRequest, rsp *auth.AuthUserResponse) error {
+	name, password := req.GetUser().GetName(), req.GetUser().GetPassword()
+
+	if as.loginThrottle.Locked(loginKey(ctx, name)) {
+		loginsCounter.WithLabelValues(outcomeLocked).Inc()
+		auditErr := as.audit(ctx, db.AuditEvent{
+			Type:     db.AuditLoginFailure,
+			UserName: name,
+			Details:  "locked: too many failed logins",
+		})
+		return httperror.NewUnauthorized("too many failed logins, try later").WithError(auditErr)
+	}
+
+	user, details, err := as.authenticateUser(ctx, name, password)
+	if err != nil {
+		return err
+	}
+
+	session, err := as.newSession(ctx, user.ID)
+	if err != nil {
+		loginsCounter.WithLabelValues(outcomeError).Inc()
+		return httperror.NewInternalError("create session error").WithError(err)
 	}
 
 	token, err := as.encoder.Encode(token.User{
 		ID:     user.ID,
 		Name:   user.Name,
 		Public: user.Public,
-	})
+	}, token.WithSessionID(session.ID))
 
 	if err != nil {
+		loginsCounter.WithLabelValues(outcomeError).Inc()
 		return httperror.NewInternalError("encode token").WithError(err)
 	}
 
+	if err := as.audit(ctx, db.AuditEvent{
+		Type:     db.AuditLoginSuccess,
+		UserID:   user.ID,
+		UserName: user.Name,
+		Details:  details + "session " + session.ID,
+	}); err != nil {
+		loginsCounter.WithLabelValues(outcomeError).Inc()
+		return httperror.NewInternalError("audit error").WithError(err)
+	}
+
+	as.loginThrottle.Reset(loginKey(ctx, name))
+	loginsCounter.WithLabelValues(outcomeSuccess).Inc()
+	tokensCounter.WithLabelValues(tokenTypeUser).Inc()
+
 	rsp.Token = &auth.Token{
 		Value: token,
 	}
@@ -117,15 +344,32 @@ func (as *handler) Auth(ctx context.Context, req *auth.AuthUserRequest, rsp *aut
 }
 
 func (as *handler) AuthPublicUser(ctx context.Context, req *auth.AuthPublicUserRequest, rsp *auth.AuthPublicUserResponse) error {
-	user, err := as.repo.GetByName(req.GetName())
+	user, err := as.repo.GetByName(ctx, req.GetName())
 	if err != nil {
 		if errors.Is(err, db.ErrNotExist) {
-			return httperror.NewNotExistError("user not exist")
+			publicLoginsCounter.WithLabelValues("", outcomeUnknownUser).Inc()
+			auditErr := as.audit(ctx, db.AuditEvent{
+				Type:     db.AuditLoginFailure,
+				UserName: req.GetName(),
+				Details:  "public login: unknown user",
+			})
+			return httperror.NewNotExistError("user not exist").WithError(auditErr)
 		}
+		publicLoginsCounter.WithLabelValues("", outcomeError).Inc()
 		return httperror.NewInternalError("unable to get user").WithError(err)
 	}
 
 	if !user.Public {
+		// name of the private user must not leak into labels
+		publicLoginsCounter.WithLabelValues("", outcomeNotPublic).Inc()
+		if err := as.audit(ctx, db.AuditEvent{
+			Type:     db.AuditLoginFailure,
+			UserID:   user.ID,
+			UserName: user.Name,
+			Details:  "public login: user is not public",
+		}); err != nil {
+			return httperror.NewInternalError("audit error").WithError(err)
+		}
 		return httperror.NewInvalidParams("user is not public")
 	}
 
@@ -136,9 +380,22 @@ func (as *handler) AuthPublicUser(ctx context.Context, req *auth.AuthPublicUserR
 	})
 
 	if err != nil {
+		publicLoginsCounter.WithLabelValues(user.Name, outcomeError).Inc()
 		return httperror.NewInternalError("unable to encode token").WithError(err)
 	}
 
+	if err := as.audit(ctx, db.AuditEvent{
+		Type:     db.AuditPublicLogin,
+		UserID:   user.ID,
+		UserName: user.Name,
+	}); err != nil {
+		publicLoginsCounter.WithLabelValues(user.Name, outcomeError).Inc()
+		return httperror.NewInternalError("audit error").WithError(err)
+	}
+
+	publicLoginsCounter.WithLabelValues(user.Name, outcomeSuccess).Inc()
+	tokensCounter.WithLabelValues(tokenTypePublic).Inc()
+
 	rsp.Token = &auth.Token{
 		Value: token,
 	}
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/asim/go-micro/v3/metadata"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/throttle"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+	"github.com/Mikhalevich/filesharing/pkg/proto/auth"
+)
+
+func newTestHandler(t *testing.T, opts ...Option) (*handler, *db.Memory) {
+	t.Helper()
+
+	encoder, err := token.NewRSAEncoder(time.Minute)
+	if err != nil {
+		t.Fatalf("create encoder: %v", err)
+	}
+
+	decoder, err := token.NewRSADecoder()
+	if err != nil {
+		t.Fatalf("create decoder: %v", err)
+	}
+
+	m := db.NewMemory()
+	return New(m, m, encoder, decoder, opts...), m
+}
+
+func createTestUser(t *testing.T, m *db.Memory, name string, password string) *db.User {
+	t.Helper()
+
+	u := db.User{Name: name}
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatalf("hash password: %v", err)
+		}
+		u.Pwd = sql.NullString{String: string(hash), Valid: true}
+	}
+
+	if err := m.Create(context.Background(), &u); err != nil {
+		t.Fatalf("create user %s: %v", name, err)
+	}
+	return &u
+}
+
+func login(h *handler, name string, password string) (*auth.AuthUserResponse, error) {
+	return loginFrom(h, "", name, password)
+}
+
+// loginFrom logs in from the client address, empty address is the address of the test.
+func loginFrom(h *handler, clientIP string, name string, password string) (*auth.AuthUserResponse, error) {
+	ctx := context.Background()
+	if clientIP != "" {
+		ctx = metadata.NewContext(ctx, metadata.Metadata{"X-Forwarded-For": clientIP})
+	}
+
+	var rsp auth.AuthUserResponse
+	err := h.Auth(ctx, &auth.AuthUserRequest{
+		User: &auth.User{
+			Name:     name,
+			Password: password,
+		},
+	}, &rsp)
+	return &rsp, err
+}
+
+func loginToken(t *testing.T, h *handler, name string, password string) string {
+	t.Helper()
+
+	rsp, err := login(h, name, password)
+	if err != nil {
+		t.Fatalf("login %s: %v", name, err)
+	}
+	return rsp.GetToken().GetValue()
+}
+
+func errorCode(err error) httperror.Code {
+	var httpErr *httperror.Error
+	if !errors.As(err, &httpErr) {
+		return -1
+	}
+	return httpErr.Code
+}
+
+func counterValue(t *testing.T, c *prometheus.CounterVec, labels ...string) float64 {
+	t.Helper()
+
+	var m dto.Metric
+	if err := c.WithLabelValues(labels...).Write(&m); err != nil {
+		t.Fatalf("read counter: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestAuthLocksOutAfterFailures(t *testing.T) {
+	h, m := newTestHandler(t, WithLoginThrottle(throttle.NewLimiter(2, time.Minute)))
+	createTestUser(t, m, "alice", "secret")
+
+	for i := 0; i < 2; i++ {
+		if _, err := login(h, "alice", "wrong"); errorCode(err) != httperror.CodeNotMatch {
+			t.Fatalf("login with wrong password: %v", err)
+		}
+	}
+
+	locked := counterValue(t, loginsCounter, outcomeLocked)
+	if _, err := login(h, "alice", "secret"); errorCode(err) != httperror.CodeUnauthorized {
+		t.Fatalf("login of locked user: %v, want unauthorized", err)
+	}
+
+	if got := counterValue(t, loginsCounter, outcomeLocked); got != locked+1 {
+		t.Errorf("locked logins %v, want %v", got, locked+1)
+	}
+
+	if _, err := login(h, "bob", "secret"); errorCode(err) != httperror.CodeNotExist {
+		t.Errorf("login of unknown user: %v", err)
+	}
+}
+
+func TestAuthSuccessResetsFailures(t *testing.T) {
+	h, m := newTestHandler(t, WithLoginThrottle(throttle.NewLimiter(2, time.Minute)))
+	createTestUser(t, m, "alice", "secret")
+
+	for i := 0; i < 3; i++ {
+		if _, err := login(h, "alice", "wrong"); err == nil {
+			t.Fatal("login with wrong password succeeded")
+		}
+
+		rsp, err := login(h, "alice", "secret")
+		if err != nil {
+			t.Fatalf("login: %v", err)
+		}
+
+		if rsp.GetToken().GetValue() == "" {
+			t.Fatal("login: no token")
+		}
+	}
+}
+
+func TestAuthLockoutIsPerClientAddress(t *testing.T) {
+	h, m := newTestHandler(t, WithLoginThrottle(throttle.NewLimiter(2, time.Minute)))
+	createTestUser(t, m, "alice", "secret")
+
+	for i := 0; i < 2; i++ {
+		if _, err := loginFrom(h, "203.0.113.1", "alice", "wrong"); errorCode(err) != httperror.CodeNotMatch {
+			t.Fatalf("login with wrong password: %v", err)
+		}
+	}
+
+	if _, err := loginFrom(h, "203.0.113.1", "alice", "secret"); errorCode(err) != httperror.CodeUnauthorized {
+		t.Errorf("login from locked address: %v, want unauthorized", err)
+	}
+
+	if _, err := loginFrom(h, "198.51.100.1", "alice", "secret"); err != nil {
+		t.Errorf("login from other address: %v", err)
+	}
+}
+
+func TestAuthLockoutDisabledByDefault(t *testing.T) {
+	h, m := newTestHandler(t)
+	createTestUser(t, m, "alice", "secret")
+
+	for i := 0; i < 10; i++ {
+		if _, err := login(h, "alice", "wrong"); errorCode(err) != httperror.CodeNotMatch {
+			t.Fatalf("login with wrong password: %v", err)
+		}
+	}
+
+	if _, err := login(h, "alice", "secret"); err != nil {
+		t.Errorf("login after failures: %v", err)
+	}
+}
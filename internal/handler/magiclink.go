@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/proto/magiclink"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const (
+	defaultMagicLinkTTL = time.Minute * 15
+	// at most magicLinkRateLimit links are sent to the address within magicLinkRateWindow.
+	magicLinkRateLimit  = 3
+	magicLinkRateWindow = time.Hour
+)
+
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// Mailer sends plain text emails.
+type Mailer interface {
+	Send(ctx context.Context, to string, subject string, body string) error
+}
+
+type magicLinkStorager interface {
+	CreateMagicLink(ctx context.Context, l *db.MagicLink, limit int, window time.Duration) error
+	ConsumeMagicLink(ctx context.Context, tokenHash string) (*db.MagicLink, error)
+}
+
+type magicLinkAuth struct {
+	l        Logger
+	mailer   Mailer
+	url      string
+	ttl      time.Duration
+	signer   token.Signer
+	verifier token.Verifier
+}
+
+// WithMagicLink enables passwordless login by links sent to verified emails,
+// the link is linkURL with token query parameter the frontend exchanges by ExchangeMagicLink.
+// Zero ttl is replaced by default. Failures to send links are logged, the caller isn't told about them.
+func WithMagicLink(l Logger, m Mailer, linkURL string, ttl time.Duration, signer token.Signer, verifier token.Verifier) Option {
+	return func(h *handler) {
+		if ttl <= 0 {
+			ttl = defaultMagicLinkTTL
+		}
+
+		h.magicLink = &magicLinkAuth{
+			l:        l,
+			mailer:   m,
+			url:      linkURL,
+			ttl:      ttl,
+			signer:   signer,
+			verifier: verifier,
+		}
+	}
+}
+
+// newLinkToken returns random link token signed with the token signing key and its random part.
+func (ml *magicLinkAuth) newLinkToken() (string, string, error) {
+	random, err := shared.RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	sig, err := ml.signer.Sign([]byte(random))
+	if err != nil {
+		return "", "", err
+	}
+
+	return random + "." + sig, random, nil
+}
+
+// verifyLinkToken checks signature of the link token and returns its random part.
+func (ml *magicLinkAuth) verifyLinkToken(linkToken string) (string, bool) {
+	idx := strings.LastIndex(linkToken, ".")
+	if idx <= 0 {
+		return "", false
+	}
+
+	random := linkToken[:idx]
+	if err := ml.verifier.Verify([]byte(random), linkToken[idx+1:]); err != nil {
+		return "", false
+	}
+
+	return random, true
+}
+
+func (ml *magicLinkAuth) linkURL(linkToken string) string {
+	separator := "?"
+	if strings.Contains(ml.url, "?") {
+		separator = "&"
+	}
+	return ml.url + separator + "token=" + url.QueryEscape(linkToken)
+}
+
+// RequestMagicLink emails login link to the verified address, the response doesn't tell
+// whether the link is sent, so registered emails can't be enumerated.
+func (as *handler) RequestMagicLink(ctx context.Context, req *magiclink.RequestMagicLinkRequest, rsp *magiclink.RequestMagicLinkResponse) error {
+	if as.magicLink == nil {
+		return httperror.NewInvalidParams("magic link login is disabled")
+	}
+
+	email := strings.TrimSpace(req.GetEmail())
+	if email == "" {
+		return httperror.NewInvalidParams("email is required")
+	}
+
+	user, err := as.repo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			magicLinksCounter.WithLabelValues(outcomeUnknownUser).Inc()
+			return nil
+		}
+		magicLinksCounter.WithLabelValues(outcomeError).Inc()
+		return httperror.NewInternalError("get user error").WithError(err)
+	}
+
+	if !user.HasVerifiedEmail(email) {
+		magicLinksCounter.WithLabelValues(outcomeNotVerified).Inc()
+		return nil
+	}
+
+	linkToken, random, err := as.magicLink.newLinkToken()
+	if err != nil {
+		magicLinksCounter.WithLabelValues(outcomeError).Inc()
+		return httperror.NewInternalError("generate magic link error").WithError(err)
+	}
+
+	if err := as.magicLinkRepo.CreateMagicLink(ctx, &db.MagicLink{
+		TokenHash: shared.HashSecret(random),
+		UserID:    user.ID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(as.magicLink.ttl).UTC(),
+	}, magicLinkRateLimit, magicLinkRateWindow); err != nil {
+		if errors.Is(err, db.ErrLimitExceeded) {
+			magicLinksCounter.WithLabelValues(outcomeRateLimited).Inc()
+			return nil
+		}
+		magicLinksCounter.WithLabelValues(outcomeError).Inc()
+		return httperror.NewInternalError("create magic link error").WithError(err)
+	}
+
+	body := fmt.Sprintf("Hello %s,\n\nfollow the link to log in, it works once and expires in %d minutes:\n\n%s\n\nIf you didn't request it, ignore this email.\n",
+		user.Name, int(as.magicLink.ttl.Minutes()), as.magicLink.linkURL(linkToken))
+	if err := as.magicLink.mailer.Send(ctx, email, "Your login link", body); err != nil {
+		// unknown addresses get no error either, so the failure isn't returned
+		magicLinksCounter.WithLabelValues(outcomeError).Inc()
+		as.magicLink.l.Errorf("send magic link to user %d error: %v", user.ID, err)
+		return nil
+	}
+
+	if err := as.audit(ctx, db.AuditEvent{
+		Type:     db.AuditMagicLinkRequest,
+		UserID:   user.ID,
+		UserName: user.Name,
+		Details:  "email " + email,
+	}); err != nil {
+		magicLinksCounter.WithLabelValues(outcomeError).Inc()
+		return httperror.NewInternalError("audit error").WithError(err)
+	}
+
+	magicLinksCounter.WithLabelValues(outcomeSuccess).Inc()
+	return nil
+}
+
+// ExchangeMagicLink returns session token for the link, the link can be exchanged once.
+func (as *handler) ExchangeMagicLink(ctx context.Context, req *magiclink.ExchangeMagicLinkRequest, rsp *magiclink.ExchangeMagicLinkResponse) error {
+	if as.magicLink == nil {
+		return httperror.NewInvalidParams("magic link login is disabled")
+	}
+
+	random, ok := as.magicLink.verifyLinkToken(req.GetLinkToken())
+	if !ok {
+		return httperror.NewUnauthorized("invalid link")
+	}
+
+	link, err := as.magicLinkRepo.ConsumeMagicLink(ctx, shared.HashSecret(random))
+	if err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			return httperror.NewUnauthorized("invalid link")
+		}
+		return httperror.NewInternalError("consume magic link error").WithError(err)
+	}
+
+	user, err := as.repo.GetByID(ctx, link.UserID)
+	if err != nil {
+		return httperror.NewInternalError("get user error").WithError(err)
+	}
+
+	// the email could be removed or moved to another user after the link was sent
+	if time.Now().After(link.ExpiresAt) || !user.HasVerifiedEmail(link.Email) {
+		auditErr := as.audit(ctx, db.AuditEvent{
+			Type:     db.AuditLoginFailure,
+			UserID:   user.ID,
+			UserName: user.Name,
+			Details:  "magic link: expired or email is not verified",
+		})
+		return httperror.NewUnauthorized("invalid link").WithError(auditErr)
+	}
+
+	session, err := as.newSession(ctx, user.ID)
+	if err != nil {
+		return httperror.NewInternalError("create session error").WithError(err)
+	}
+
+	tokenString, err := as.encoder.Encode(token.User{
+		ID:     user.ID,
+		Name:   user.Name,
+		Public: user.Public,
+	}, token.WithSessionID(session.ID))
+	if err != nil {
+		return httperror.NewInternalError("encode token").WithError(err)
+	}
+
+	if err := as.audit(ctx, db.AuditEvent{
+		Type:     db.AuditLoginSuccess,
+		UserID:   user.ID,
+		UserName: user.Name,
+		Details:  "magic link: session " + session.ID,
+	}); err != nil {
+		return httperror.NewInternalError("audit error").WithError(err)
+	}
+
+	tokensCounter.WithLabelValues(tokenTypeUser).Inc()
+
+	rsp.Token = tokenString
+	return nil
+}
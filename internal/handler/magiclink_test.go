@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/proto/magiclink"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const testMagicLinkURL = "https://files.example.com/login/magic"
+
+var linkPattern = regexp.MustCompile(regexp.QuoteMeta(testMagicLinkURL) + `\?token=\S+`)
+
+type testLogger struct{}
+
+func (testLogger) Infof(format string, args ...interface{})  {}
+func (testLogger) Errorf(format string, args ...interface{}) {}
+
+// testMailer keeps bodies of sent emails, it fails if err is set.
+type testMailer struct {
+	mu     sync.Mutex
+	bodies []string
+	err    error
+}
+
+func (m *testMailer) Send(ctx context.Context, to string, subject string, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+	m.bodies = append(m.bodies, body)
+	return nil
+}
+
+func (m *testMailer) sent() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.bodies)
+}
+
+// lastLinkToken returns token of the link in the last email.
+func (m *testMailer) lastLinkToken(t *testing.T) string {
+	t.Helper()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.bodies) == 0 {
+		t.Fatal("no email is sent")
+	}
+
+	link, err := url.Parse(linkPattern.FindString(m.bodies[len(m.bodies)-1]))
+	if err != nil {
+		t.Fatalf("parse link: %v", err)
+	}
+	return link.Query().Get("token")
+}
+
+// newMagicLinkHandler returns handler sending links to alice@example.com verified by alice.
+func newMagicLinkHandler(t *testing.T, ttl time.Duration) (*handler, *db.Memory, *testMailer) {
+	t.Helper()
+
+	signer, err := token.NewRSAEncoder(time.Minute)
+	if err != nil {
+		t.Fatalf("create signer: %v", err)
+	}
+
+	verifier, err := token.NewRSADecoder()
+	if err != nil {
+		t.Fatalf("create verifier: %v", err)
+	}
+
+	mailer := &testMailer{}
+	h, m := newTestHandler(t, WithMagicLink(testLogger{}, mailer, testMagicLinkURL, ttl, signer, verifier))
+
+	alice := createTestUser(t, m, "alice", "secret")
+	if err := m.AddEmail(context.Background(), alice.ID, db.Email{Email: "alice@example.com", Primary: true, Verified: true}); err != nil {
+		t.Fatalf("add email: %v", err)
+	}
+	return h, m, mailer
+}
+
+func requestMagicLink(h *handler, email string) error {
+	return h.RequestMagicLink(context.Background(), &magiclink.RequestMagicLinkRequest{Email: email}, &magiclink.RequestMagicLinkResponse{})
+}
+
+func exchangeMagicLink(h *handler, linkToken string) (string, error) {
+	var rsp magiclink.ExchangeMagicLinkResponse
+	err := h.ExchangeMagicLink(context.Background(), &magiclink.ExchangeMagicLinkRequest{LinkToken: linkToken}, &rsp)
+	return rsp.GetToken(), err
+}
+
+func TestMagicLinkSingleUse(t *testing.T) {
+	h, _, mailer := newMagicLinkHandler(t, time.Minute)
+
+	if err := requestMagicLink(h, "alice@example.com"); err != nil {
+		t.Fatalf("request magic link: %v", err)
+	}
+
+	linkToken := mailer.lastLinkToken(t)
+	tokenString, err := exchangeMagicLink(h, linkToken)
+	if err != nil {
+		t.Fatalf("exchange magic link: %v", err)
+	}
+
+	claims, err := h.decoder.Decode(tokenString)
+	if err != nil {
+		t.Fatalf("decode token: %v", err)
+	}
+
+	if claims.User.Name != "alice" || claims.SessionID == "" {
+		t.Errorf("claims %+v, want login token of alice", claims)
+	}
+
+	if _, err := exchangeMagicLink(h, linkToken); errorCode(err) != httperror.CodeUnauthorized {
+		t.Errorf("exchange used link: %v, want unauthorized", err)
+	}
+}
+
+func TestMagicLinkExpired(t *testing.T) {
+	h, _, mailer := newMagicLinkHandler(t, time.Millisecond)
+
+	if err := requestMagicLink(h, "alice@example.com"); err != nil {
+		t.Fatalf("request magic link: %v", err)
+	}
+
+	time.Sleep(time.Millisecond * 10)
+	if _, err := exchangeMagicLink(h, mailer.lastLinkToken(t)); errorCode(err) != httperror.CodeUnauthorized {
+		t.Errorf("exchange expired link: %v, want unauthorized", err)
+	}
+}
+
+func TestMagicLinkRateLimit(t *testing.T) {
+	h, _, mailer := newMagicLinkHandler(t, time.Minute)
+
+	const requests = magicLinkRateLimit * 3
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := requestMagicLink(h, "alice@example.com"); err != nil {
+				t.Errorf("request magic link: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if mailer.sent() != magicLinkRateLimit {
+		t.Errorf("%d links are sent, want %d", mailer.sent(), magicLinkRateLimit)
+	}
+}
+
+func TestMagicLinkSendFailureIsNotReported(t *testing.T) {
+	h, _, mailer := newMagicLinkHandler(t, time.Minute)
+	mailer.err = errors.New("smtp is down")
+
+	// the response is the same as for unknown addresses
+	if err := requestMagicLink(h, "alice@example.com"); err != nil {
+		t.Errorf("request magic link: %v", err)
+	}
+
+	if err := requestMagicLink(h, "nobody@example.com"); err != nil {
+		t.Errorf("request magic link of unknown address: %v", err)
+	}
+}
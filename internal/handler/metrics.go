@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	outcomeSuccess       = "success"
+	outcomeBadPassword   = "bad_password"
+	outcomeUnknownUser   = "unknown_user"
+	outcomeNotPublic     = "not_public"
+	outcomeAlreadyExists = "already_exists"
+	outcomeInvalid       = "invalid"
+	outcomeError         = "error"
+	outcomeBadSecret     = "bad_secret"
+	outcomeRevoked       = "revoked"
+	outcomeExpired       = "expired"
+	outcomeNotVerified   = "not_verified"
+	outcomeRateLimited   = "rate_limited"
+	outcomeBadAssertion  = "bad_assertion"
+	outcomeReplayed      = "replayed"
+	outcomeLocked        = "locked"
+
+	tokenTypeUser     = "user"
+	tokenTypePublic   = "public"
+	tokenTypeAPIKey   = "api_key"
+	tokenTypeService  = "service"
+	tokenTypeExchange = "exchange"
+
+	hashGenerate = "generate"
+	hashCompare  = "compare"
+)
+
+var (
+	loginsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_logins_total",
+			Help: "Number of password logins partitioned by outcome.",
+		},
+		[]string{"outcome"},
+	)
+
+	publicLoginsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_public_logins_total",
+			Help: "Number of public user logins partitioned by public user name and outcome.",
+		},
+		[]string{"name", "outcome"},
+	)
+
+	registrationsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_registrations_total",
+			Help: "Number of user registrations partitioned by outcome.",
+		},
+		[]string{"outcome"},
+	)
+
+	tokensCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_tokens_issued_total",
+			Help: "Number of issued tokens partitioned by token type.",
+		},
+		[]string{"type"},
+	)
+
+	apiKeyExchangesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_api_key_exchanges_total",
+			Help: "Number of api key exchanges partitioned by outcome.",
+		},
+		[]string{"outcome"},
+	)
+
+	magicLinksCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_magic_links_total",
+			Help: "Number of magic link requests partitioned by outcome.",
+		},
+		[]string{"outcome"},
+	)
+
+	serviceTokensCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_service_tokens_total",
+			Help: "Number of service account token requests partitioned by outcome.",
+		},
+		[]string{"outcome"},
+	)
+
+	tokenExchangesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_token_exchanges_total",
+			Help: "Number of token exchanges partitioned by outcome.",
+		},
+		[]string{"outcome"},
+	)
+
+	hashDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "auth_password_hash_duration_seconds",
+			Help:    "Duration of password hash operations partitioned by operation (generate or compare).",
+			Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		},
+		[]string{"operation"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(loginsCounter, publicLoginsCounter, registrationsCounter, tokensCounter, apiKeyExchangesCounter, magicLinksCounter, serviceTokensCounter, tokenExchangesCounter, hashDuration)
+}
+
+func observeHash(operation string, start time.Time) {
+	hashDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/serviceaccount"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+	serviceaccountpb "github.com/Mikhalevich/filesharing-auth-service/pkg/proto/serviceaccount"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const (
+	defaultServiceTokenTTL = time.Minute * 15
+	// maxServiceAssertionLifetime limits expiration of assertions, so used assertion ids are kept shortly.
+	maxServiceAssertionLifetime = time.Minute * 5
+	// maxServiceAssertionIDLength is the size of the column used assertion ids are stored in.
+	maxServiceAssertionIDLength = 256
+)
+
+type serviceAccountStorager interface {
+	GetServiceAccount(ctx context.Context, id string) (*db.ServiceAccount, error)
+	UseServiceAssertion(ctx context.Context, accountID string, jti string, expiresAt time.Time) error
+}
+
+// WithServiceTokenTTL sets lifetime of tokens IssueServiceToken issues.
+func WithServiceTokenTTL(ttl time.Duration) Option {
+	return func(h *handler) {
+		h.serviceTokenTTL = ttl
+	}
+}
+
+// verifyServiceAssertion checks signature and claims of the assertion signed by the account,
+// it returns id and expiration time of the assertion to reject its replay.
+func verifyServiceAssertion(a *db.ServiceAccount, assertion string) (string, time.Time, error) {
+	key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(a.PublicKey))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid public key: %w", err)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(assertion, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return key, nil
+	}); err != nil {
+		return "", time.Time{}, err
+	}
+
+	if !claims.VerifyIssuer(a.ID, true) {
+		return "", time.Time{}, errors.New("issuer mismatch")
+	}
+
+	if sub, _ := claims["sub"].(string); sub != a.ID {
+		return "", time.Time{}, errors.New("subject mismatch")
+	}
+
+	if !claims.VerifyAudience(token.Issuer, true) {
+		return "", time.Time{}, errors.New("audience mismatch")
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return "", time.Time{}, errors.New("no expiration")
+	}
+
+	expiresAt := time.Unix(int64(exp), 0)
+	if expiresAt.After(time.Now().Add(maxServiceAssertionLifetime)) {
+		return "", time.Time{}, errors.New("expiration is too far")
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return "", time.Time{}, errors.New("no jti")
+	}
+
+	if len(jti) > maxServiceAssertionIDLength {
+		return "", time.Time{}, errors.New("jti is too long")
+	}
+
+	return jti, expiresAt, nil
+}
+
+// containsScopes reports whether every scope of requested is in allowed.
+func containsScopes(allowed []string, requested []string) bool {
+	set := make(map[string]bool, len(allowed))
+	for _, s := range allowed {
+		set[s] = true
+	}
+
+	for _, s := range requested {
+		if !set[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// rejectServiceAccount records failed authentication of the known account and returns error the caller gets.
+func (as *handler) rejectServiceAccount(ctx context.Context, a *db.ServiceAccount, outcome string) (*db.ServiceAccount, string, error) {
+	auditErr := as.audit(ctx, db.AuditEvent{
+		Type:    db.AuditLoginFailure,
+		Details: "service account " + a.ID + ": " + strings.ReplaceAll(outcome, "_", " "),
+	})
+	return nil, outcome, httperror.NewUnauthorized("invalid client").WithError(auditErr)
+}
+
+// authenticateServiceAccount checks secret or assertion against the account,
+// the account can use only the credential it is created with.
+// Outcome of failed authentication is returned for metrics.
+func (as *handler) authenticateServiceAccount(ctx context.Context, clientID string, secret string, assertion string) (*db.ServiceAccount, string, error) {
+	if secret != "" && assertion != "" {
+		return nil, outcomeInvalid, httperror.NewInvalidParams("either client secret or client assertion is required")
+	}
+
+	a, err := as.serviceAccountRepo.GetServiceAccount(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			return nil, outcomeInvalid, httperror.NewUnauthorized("invalid client")
+		}
+		return nil, outcomeError, httperror.NewInternalError("get service account error").WithError(err)
+	}
+
+	switch {
+	case a.SecretHash != "" && secret != "":
+		if subtle.ConstantTimeCompare([]byte(shared.HashSecret(secret)), []byte(a.SecretHash)) != 1 {
+			return as.rejectServiceAccount(ctx, a, outcomeBadSecret)
+		}
+
+	case a.PublicKey != "" && assertion != "":
+		jti, expiresAt, err := verifyServiceAssertion(a, assertion)
+		if err != nil {
+			return as.rejectServiceAccount(ctx, a, outcomeBadAssertion)
+		}
+
+		if err := as.serviceAccountRepo.UseServiceAssertion(ctx, a.ID, jti, expiresAt.UTC()); err != nil {
+			if errors.Is(err, db.ErrAlreadyExist) {
+				return as.rejectServiceAccount(ctx, a, outcomeReplayed)
+			}
+			return nil, outcomeError, httperror.NewInternalError("use service assertion error").WithError(err)
+		}
+
+	default:
+		return as.rejectServiceAccount(ctx, a, outcomeInvalid)
+	}
+
+	return a, "", nil
+}
+
+// IssueServiceToken implements client credentials grant of service accounts,
+// the token has service claim instead of the user and is limited to the requested scopes.
+func (as *handler) IssueServiceToken(ctx context.Context, req *serviceaccountpb.IssueServiceTokenRequest, rsp *serviceaccountpb.IssueServiceTokenResponse) error {
+	account, outcome, err := as.authenticateServiceAccount(ctx, req.GetClientId(), req.GetClientSecret(), req.GetClientAssertion())
+	if err != nil {
+		serviceTokensCounter.WithLabelValues(outcome).Inc()
+		return err
+	}
+
+	scopes := account.Scopes
+	if req.GetScope() != "" {
+		requested, ok := serviceaccount.ParseScopes(strings.Fields(req.GetScope()))
+		if !ok || !containsScopes(account.Scopes, requested) {
+			serviceTokensCounter.WithLabelValues(outcomeInvalid).Inc()
+			return httperror.NewInvalidParams("invalid scope")
+		}
+		scopes = requested
+	}
+
+	scope := strings.Join(scopes, " ")
+	expiresAt := time.Now().Add(as.serviceTokenTTL)
+	opts := []token.EncodeOption{
+		token.WithService(token.Service{
+			ID:   account.ID,
+			Name: account.Name,
+		}, scope),
+		token.WithExpiresAt(expiresAt),
+	}
+	if audience := strings.TrimSpace(req.GetAudience()); audience != "" {
+		if len(audience) > serviceaccount.MaxNameLength {
+			serviceTokensCounter.WithLabelValues(outcomeInvalid).Inc()
+			return httperror.NewInvalidParams("invalid audience")
+		}
+		opts = append(opts, token.WithAudience(audience))
+	}
+
+	tokenString, err := as.encoder.Encode(token.User{}, opts...)
+	if err != nil {
+		serviceTokensCounter.WithLabelValues(outcomeError).Inc()
+		return httperror.NewInternalError("encode token").WithError(err)
+	}
+
+	if err := as.audit(ctx, db.AuditEvent{
+		Type:    db.AuditServiceToken,
+		Details: "service account " + account.ID + ": " + scope,
+	}); err != nil {
+		serviceTokensCounter.WithLabelValues(outcomeError).Inc()
+		return httperror.NewInternalError("audit error").WithError(err)
+	}
+
+	serviceTokensCounter.WithLabelValues(outcomeSuccess).Inc()
+	tokensCounter.WithLabelValues(tokenTypeService).Inc()
+
+	rsp.Token = tokenString
+	rsp.ExpiresAt = expiresAt.Unix()
+	rsp.Scope = scope
+	return nil
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/serviceaccount"
+	serviceaccountpb "github.com/Mikhalevich/filesharing-auth-service/pkg/proto/serviceaccount"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+// createAssertionAccount stores service account authenticating by assertions and returns its id and signing key.
+func createAssertionAccount(t *testing.T, m *db.Memory) (string, *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+
+	a, _, err := serviceaccount.New("storage", []string{token.ScopeStorageRead}, string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: der,
+	})))
+	if err != nil {
+		t.Fatalf("new service account: %v", err)
+	}
+
+	if err := m.CreateServiceAccount(context.Background(), a); err != nil {
+		t.Fatalf("create service account: %v", err)
+	}
+	return a.ID, key
+}
+
+func signAssertion(t *testing.T, key *rsa.PrivateKey, accountID string, jti string) string {
+	t.Helper()
+
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": accountID,
+		"sub": accountID,
+		"aud": token.Issuer,
+		"exp": time.Now().Add(time.Minute).Unix(),
+		"jti": jti,
+	}).SignedString(key)
+	if err != nil {
+		t.Fatalf("sign assertion: %v", err)
+	}
+	return assertion
+}
+
+func issueServiceToken(h *handler, accountID string, assertion string) error {
+	return h.IssueServiceToken(context.Background(), &serviceaccountpb.IssueServiceTokenRequest{
+		ClientId:        accountID,
+		ClientAssertion: assertion,
+	}, &serviceaccountpb.IssueServiceTokenResponse{})
+}
+
+func TestServiceAssertionReplay(t *testing.T) {
+	h, m := newTestHandler(t)
+	id, key := createAssertionAccount(t, m)
+
+	assertion := signAssertion(t, key, id, "once")
+	if err := issueServiceToken(h, id, assertion); err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+
+	if err := issueServiceToken(h, id, assertion); errorCode(err) != httperror.CodeUnauthorized {
+		t.Errorf("replayed assertion: %v, want unauthorized", err)
+	}
+}
+
+func TestServiceAssertionLongID(t *testing.T) {
+	h, m := newTestHandler(t)
+	id, key := createAssertionAccount(t, m)
+
+	before := counterValue(t, serviceTokensCounter, outcomeBadAssertion)
+
+	assertion := signAssertion(t, key, id, strings.Repeat("j", maxServiceAssertionIDLength+1))
+	if err := issueServiceToken(h, id, assertion); errorCode(err) != httperror.CodeUnauthorized {
+		t.Errorf("assertion with long jti: %v, want unauthorized", err)
+	}
+
+	if got := counterValue(t, serviceTokensCounter, outcomeBadAssertion) - before; got != 1 {
+		t.Errorf("bad assertion outcomes %v, want 1", got)
+	}
+}
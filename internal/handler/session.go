@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/proto/session"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+type sessionStorager interface {
+	CreateSession(ctx context.Context, s *db.Session) error
+	GetSession(ctx context.Context, id string) (*db.Session, error)
+	ListSessions(ctx context.Context, userID int64) ([]*db.Session, error)
+	TouchSession(ctx context.Context, id string) error
+	RevokeSession(ctx context.Context, userID int64, id string) error
+	RevokeOtherSessions(ctx context.Context, userID int64, exceptID string) ([]string, error)
+}
+
+// newSession creates login session of the user from the client of ctx.
+func (as *handler) newSession(ctx context.Context, userID int64) (*db.Session, error) {
+	s := db.Session{
+		UserID: userID,
+	}
+	s.ClientIP, s.UserAgent = shared.ClientInfoFromContext(ctx)
+
+	if err := as.sessionRepo.CreateSession(ctx, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// authenticate decodes token and checks that its session is not revoked.
+func (as *handler) authenticate(ctx context.Context, tokenString string) (*token.CustomClaims, error) {
+	claims, err := as.decoder.Decode(tokenString)
+	if err != nil {
+		return nil, httperror.NewUnauthorized("invalid token")
+	}
+
+	if claims.SessionID == "" {
+		return claims, nil
+	}
+
+	s, err := as.sessionRepo.GetSession(ctx, claims.SessionID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			return nil, httperror.NewUnauthorized("session not exists")
+		}
+		return nil, httperror.NewInternalError("get session error").WithError(err)
+	}
+
+	if s.IsRevoked() || s.UserID != claims.User.ID {
+		return nil, httperror.NewUnauthorized("session is revoked")
+	}
+
+	if err := as.sessionRepo.TouchSession(ctx, s.ID); err != nil {
+		return nil, httperror.NewInternalError("touch session error").WithError(err)
+	}
+
+	return claims, nil
+}
+
+// isLoginToken reports whether token is issued by user login rather than to oauth client, api key, service or actor.
+func isLoginToken(claims *token.CustomClaims) bool {
+	return claims.SessionID != "" && claims.Scope == "" && claims.ClientID == "" && claims.APIKeyID == "" &&
+		!claims.IsService() && claims.Actor == nil
+}
+
+// authenticateLogin authenticates token issued by user login,
+// sessions and keys can't be managed with tokens of oauth clients, api keys, services or public users.
+func (as *handler) authenticateLogin(ctx context.Context, tokenString string) (*token.CustomClaims, error) {
+	claims, err := as.authenticate(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isLoginToken(claims) {
+		return nil, httperror.NewUnauthorized("login token is required")
+	}
+
+	return claims, nil
+}
+
+func (as *handler) ListSessions(ctx context.Context, req *session.ListSessionsRequest, rsp *session.ListSessionsResponse) error {
+	claims, err := as.authenticateLogin(ctx, req.GetToken())
+	if err != nil {
+		return err
+	}
+
+	sessions, err := as.sessionRepo.ListSessions(ctx, claims.User.ID)
+	if err != nil {
+		return httperror.NewInternalError("list sessions error").WithError(err)
+	}
+
+	rsp.Sessions = make([]*session.Session, 0, len(sessions))
+	for _, s := range sessions {
+		rsp.Sessions = append(rsp.Sessions, &session.Session{
+			Id:         s.ID,
+			UserAgent:  s.UserAgent,
+			ClientIp:   s.ClientIP,
+			CreatedAt:  s.CreatedAt.Unix(),
+			LastSeenAt: s.LastSeenAt.Unix(),
+			Current:    s.ID == claims.SessionID,
+		})
+	}
+	return nil
+}
+
+func (as *handler) RevokeSession(ctx context.Context, req *session.RevokeSessionRequest, rsp *session.RevokeSessionResponse) error {
+	claims, err := as.authenticateLogin(ctx, req.GetToken())
+	if err != nil {
+		return err
+	}
+
+	if err := as.sessionRepo.RevokeSession(ctx, claims.User.ID, req.GetSessionId()); err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			return httperror.NewNotExistError("session not exists")
+		}
+		return httperror.NewInternalError("revoke session error").WithError(err)
+	}
+
+	if err := as.audit(ctx, db.AuditEvent{
+		Type:     db.AuditSessionRevoke,
+		UserID:   claims.User.ID,
+		UserName: claims.User.Name,
+		Details:  "session " + req.GetSessionId(),
+	}); err != nil {
+		return httperror.NewInternalError("audit error").WithError(err)
+	}
+
+	return nil
+}
+
+func (as *handler) RevokeAllOtherSessions(ctx context.Context, req *session.RevokeAllOtherSessionsRequest, rsp *session.RevokeAllOtherSessionsResponse) error {
+	claims, err := as.authenticateLogin(ctx, req.GetToken())
+	if err != nil {
+		return err
+	}
+
+	ids, err := as.sessionRepo.RevokeOtherSessions(ctx, claims.User.ID, claims.SessionID)
+	if err != nil {
+		return httperror.NewInternalError("revoke sessions error").WithError(err)
+	}
+
+	for _, id := range ids {
+		if err := as.audit(ctx, db.AuditEvent{
+			Type:     db.AuditSessionRevoke,
+			UserID:   claims.User.ID,
+			UserName: claims.User.Name,
+			Details:  "session " + id,
+		}); err != nil {
+			return httperror.NewInternalError("audit error").WithError(err)
+		}
+	}
+
+	rsp.Revoked = int32(len(ids))
+	return nil
+}
+
+// ValidateToken lets other services check that token is valid and its session is not revoked.
+// The token must be intended for the audience of the request if it is set.
+func (as *handler) ValidateToken(ctx context.Context, req *session.ValidateTokenRequest, rsp *session.ValidateTokenResponse) error {
+	claims, err := as.authenticate(ctx, req.GetToken())
+	if err != nil {
+		return err
+	}
+
+	if req.GetAudience() != "" && !claims.VerifyAudience(req.GetAudience(), true) {
+		return httperror.NewUnauthorized("token is intended for other audience")
+	}
+
+	rsp.UserId = claims.User.ID
+	rsp.UserName = claims.User.Name
+	rsp.Public = claims.User.Public
+	rsp.SessionId = claims.SessionID
+	rsp.Scope = claims.Scope
+	rsp.Audience = claims.Audience
+	if claims.Actor != nil {
+		rsp.Actor = claims.Actor.Subject
+	}
+	if claims.IsService() {
+		rsp.ServiceId = claims.Service.ID
+		rsp.ServiceName = claims.Service.Name
+	}
+	return nil
+}
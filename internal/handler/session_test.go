@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/proto/audit"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/proto/session"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+// derivedTokens returns tokens of the user of the login token which are not login tokens themselves.
+func derivedTokens(t *testing.T, h *handler, loginToken string) map[string]string {
+	t.Helper()
+
+	claims, err := h.decoder.Decode(loginToken)
+	if err != nil {
+		t.Fatalf("decode login token: %v", err)
+	}
+
+	encode := func(opts ...token.EncodeOption) string {
+		s, err := h.encoder.Encode(claims.User, opts...)
+		if err != nil {
+			t.Fatalf("encode token: %v", err)
+		}
+		return s
+	}
+
+	return map[string]string{
+		"oauth client": encode(token.WithSessionID(claims.SessionID), token.WithScope("client", token.ScopeStorageRead)),
+		"api key":      encode(token.WithAPIKey("fsk_1", token.ScopeStorageRead)),
+		"exchanged": encode(
+			token.WithSessionID(claims.SessionID),
+			token.WithActor(token.Actor{Subject: "svc_1"}, token.ScopeStorageRead),
+			token.WithAudience("storage"),
+		),
+	}
+}
+
+func TestSessionsRequireLoginToken(t *testing.T) {
+	h, m := newTestHandler(t)
+	createTestUser(t, m, "alice", "secret")
+	loginToken(t, h, "alice", "secret")
+	aliceToken := loginToken(t, h, "alice", "secret")
+	ctx := context.Background()
+
+	for name, tok := range derivedTokens(t, h, aliceToken) {
+		if err := h.ListSessions(ctx, &session.ListSessionsRequest{Token: tok}, &session.ListSessionsResponse{}); errorCode(err) != httperror.CodeUnauthorized {
+			t.Errorf("list sessions with %s token: %v, want unauthorized", name, err)
+		}
+
+		if err := h.RevokeSession(ctx, &session.RevokeSessionRequest{Token: tok, SessionId: "any"}, &session.RevokeSessionResponse{}); errorCode(err) != httperror.CodeUnauthorized {
+			t.Errorf("revoke session with %s token: %v, want unauthorized", name, err)
+		}
+
+		if err := h.RevokeAllOtherSessions(ctx, &session.RevokeAllOtherSessionsRequest{Token: tok}, &session.RevokeAllOtherSessionsResponse{}); errorCode(err) != httperror.CodeUnauthorized {
+			t.Errorf("revoke other sessions with %s token: %v, want unauthorized", name, err)
+		}
+
+		if err := h.ListAuditEvents(ctx, &audit.ListAuditEventsRequest{Token: tok}, &audit.ListAuditEventsResponse{}); errorCode(err) != httperror.CodeUnauthorized {
+			t.Errorf("list audit events with %s token: %v, want unauthorized", name, err)
+		}
+	}
+
+	var list session.ListSessionsResponse
+	if err := h.ListSessions(ctx, &session.ListSessionsRequest{Token: aliceToken}, &list); err != nil {
+		t.Fatalf("list sessions: %v", err)
+	}
+
+	if len(list.GetSessions()) != 2 {
+		t.Fatalf("sessions %v, want both logins", list.GetSessions())
+	}
+
+	var revoke session.RevokeAllOtherSessionsResponse
+	if err := h.RevokeAllOtherSessions(ctx, &session.RevokeAllOtherSessionsRequest{Token: aliceToken}, &revoke); err != nil {
+		t.Fatalf("revoke other sessions: %v", err)
+	}
+
+	if revoke.GetRevoked() != 1 {
+		t.Errorf("revoked %d sessions, want 1", revoke.GetRevoked())
+	}
+}
@@ -0,0 +1,148 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const checkTimeout = time.Second * 5
+
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name string
+	fn   CheckFunc
+	err  error
+}
+
+var readyGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "auth_ready",
+	Help: "Whether the service is ready to serve requests (1) or not (0).",
+})
+
+func init() {
+	prometheus.MustRegister(readyGauge)
+}
+
+// Checker periodically runs registered checks, service is ready when all of them pass.
+type Checker struct {
+	l        Logger
+	interval time.Duration
+	timeout  time.Duration
+
+	mu     sync.RWMutex
+	checks []*check
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewChecker(l Logger, interval time.Duration) *Checker {
+	return &Checker{
+		l:        l,
+		interval: interval,
+		timeout:  checkTimeout,
+		done:     make(chan struct{}),
+	}
+}
+
+// Add registers check, should be called before Start.
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks = append(c.checks, &check{
+		name: name,
+		fn:   fn,
+	})
+}
+
+// Start runs checks once synchronously and then periodically in background until Stop.
+func (c *Checker) Start() {
+	c.runChecks()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-ticker.C:
+				c.runChecks()
+			}
+		}
+	}()
+}
+
+func (c *Checker) Stop() {
+	close(c.done)
+	c.wg.Wait()
+}
+
+func (c *Checker) runChecks() {
+	c.mu.RLock()
+	checks := make([]*check, len(c.checks))
+	copy(checks, c.checks)
+	c.mu.RUnlock()
+
+	for _, ch := range checks {
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		err := ch.fn(ctx)
+		cancel()
+
+		c.mu.Lock()
+		prevErr := ch.err
+		ch.err = err
+		c.mu.Unlock()
+
+		if err != nil && prevErr == nil {
+			c.l.Errorf("health check %s failed: %v", ch.name, err)
+		} else if err == nil && prevErr != nil {
+			c.l.Infof("health check %s recovered", ch.name)
+		}
+	}
+
+	if c.Ready() {
+		readyGauge.Set(1)
+	} else {
+		readyGauge.Set(0)
+	}
+}
+
+// Ready reports whether all checks passed on the last run.
+func (c *Checker) Ready() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, ch := range c.checks {
+		if ch.err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Results returns last error of each check by name, nil error means check passed.
+func (c *Checker) Results() map[string]error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	results := make(map[string]error, len(c.checks))
+	for _, ch := range c.checks {
+		results[ch.name] = ch.err
+	}
+	return results
+}
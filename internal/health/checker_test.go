@@ -0,0 +1,92 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testLogger struct{}
+
+func (testLogger) Infof(format string, args ...interface{})  {}
+func (testLogger) Errorf(format string, args ...interface{}) {}
+
+func newTestChecker(checks map[string]CheckFunc) *Checker {
+	c := NewChecker(testLogger{}, time.Hour)
+	c.timeout = time.Millisecond * 50
+	for name, fn := range checks {
+		c.Add(name, fn)
+	}
+	return c
+}
+
+func ok(ctx context.Context) error {
+	return nil
+}
+
+func failing(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+// hanging waits for the check timeout.
+func hanging(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestChecker(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		checks map[string]CheckFunc
+		ready  bool
+		failed map[string]bool
+	}{
+		{"healthy", map[string]CheckFunc{"db": ok, "cache": ok}, true, nil},
+		{"failing", map[string]CheckFunc{"db": failing, "cache": ok}, false, map[string]bool{"db": true}},
+		{"timeout", map[string]CheckFunc{"db": hanging, "cache": ok}, false, map[string]bool{"db": true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestChecker(tc.checks)
+			c.Start()
+			defer c.Stop()
+
+			if c.Ready() != tc.ready {
+				t.Errorf("ready %v, want %v", c.Ready(), tc.ready)
+			}
+
+			for name, err := range c.Results() {
+				if (err != nil) != tc.failed[name] {
+					t.Errorf("check %s: %v, want failed %v", name, err, tc.failed[name])
+				}
+			}
+
+			if tc.name == "timeout" && !errors.Is(c.Results()["db"], context.DeadlineExceeded) {
+				t.Errorf("check db: %v, want %v", c.Results()["db"], context.DeadlineExceeded)
+			}
+		})
+	}
+}
+
+func TestCheckerRecovers(t *testing.T) {
+	fail := true
+	c := newTestChecker(map[string]CheckFunc{
+		"db": func(ctx context.Context) error {
+			if fail {
+				return errors.New("down")
+			}
+			return nil
+		},
+	})
+
+	c.runChecks()
+	if c.Ready() {
+		t.Fatal("ready with failing check")
+	}
+
+	fail = false
+	c.runChecks()
+	if !c.Ready() {
+		t.Error("not ready after check recovered")
+	}
+}
@@ -0,0 +1,65 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	statusOK   = "ok"
+	statusFail = "fail"
+)
+
+type checkResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type response struct {
+	Status string                   `json:"status"`
+	Checks map[string]checkResponse `json:"checks,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, rsp response) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(rsp)
+}
+
+// LiveHandler reports that the process is alive.
+func LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, response{
+			Status: statusOK,
+		})
+	})
+}
+
+// ReadyHandler reports results of the last checks run, responds with 503 if any check failed.
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rsp := response{
+			Status: statusOK,
+			Checks: make(map[string]checkResponse),
+		}
+		code := http.StatusOK
+
+		for name, err := range c.Results() {
+			if err != nil {
+				rsp.Status = statusFail
+				code = http.StatusServiceUnavailable
+				rsp.Checks[name] = checkResponse{
+					Status: statusFail,
+					Error:  err.Error(),
+				}
+				continue
+			}
+
+			rsp.Checks[name] = checkResponse{
+				Status: statusOK,
+			}
+		}
+
+		writeJSON(w, code, rsp)
+	})
+}
@@ -0,0 +1,61 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadyHandler(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		checks map[string]CheckFunc
+		code   int
+		status string
+	}{
+		{"healthy", map[string]CheckFunc{"db": ok}, http.StatusOK, statusOK},
+		{"failing", map[string]CheckFunc{"db": failing, "cache": ok}, http.StatusServiceUnavailable, statusFail},
+		{"timeout", map[string]CheckFunc{"db": hanging}, http.StatusServiceUnavailable, statusFail},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestChecker(tc.checks)
+			c.runChecks()
+
+			w := httptest.NewRecorder()
+			c.ReadyHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if w.Code != tc.code {
+				t.Errorf("code %d, want %d", w.Code, tc.code)
+			}
+
+			var rsp response
+			if err := json.NewDecoder(w.Body).Decode(&rsp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+
+			if rsp.Status != tc.status || len(rsp.Checks) != len(tc.checks) {
+				t.Errorf("response %+v, want status %s and %d checks", rsp, tc.status, len(tc.checks))
+			}
+
+			for name, ch := range rsp.Checks {
+				if failed := ch.Status == statusFail; failed != (ch.Error != "") {
+					t.Errorf("check %s: status %s with error %q", name, ch.Status, ch.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestLiveHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	LiveHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("code %d, want %d", w.Code, http.StatusOK)
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("content type %q", ct)
+	}
+}
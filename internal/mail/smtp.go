@@ -0,0 +1,151 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+const defaultTimeout = time.Second * 10
+
+type Config struct {
+	// Addr is host:port of the smtp server.
+	Addr string `yaml:"addr"`
+	From string `yaml:"from"`
+	// Username and Password are used for PLAIN auth if set, it requires TLS.
+	Username   string `yaml:"username"`
+	Password   string `yaml:"password"`
+	TimeoutSec int    `yaml:"timeout"`
+}
+
+// SMTP sends plain text emails by the smtp server, the connection is upgraded by STARTTLS when the server supports it.
+type SMTP struct {
+	addr    string
+	host    string
+	from    string
+	auth    smtp.Auth
+	timeout time.Duration
+}
+
+func NewSMTP(cfg Config) (*SMTP, error) {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp addr: %q", cfg.Addr)
+	}
+
+	if cfg.From == "" || strings.ContainsAny(cfg.From, "\r\n") {
+		return nil, fmt.Errorf("invalid smtp from: %q", cfg.From)
+	}
+
+	timeout := time.Duration(cfg.TimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	s := SMTP{
+		addr:    cfg.Addr,
+		host:    host,
+		from:    cfg.From,
+		timeout: timeout,
+	}
+
+	if cfg.Username != "" {
+		s.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+
+	return &s, nil
+}
+
+// Send sends email with plain text body to the single recipient.
+func (s *SMTP) Send(ctx context.Context, to string, subject string, body string) error {
+	if strings.ContainsAny(to, "\r\n<>") {
+		return fmt.Errorf("invalid recipient: %q", to)
+	}
+
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	dialer := net.Dialer{
+		Deadline: deadline,
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{
+			ServerName: s.host,
+			MinVersion: tls.VersionTLS12,
+		}); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+
+	if s.auth != nil {
+		if err := c.Auth(s.auth); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	if err := c.Mail(s.from); err != nil {
+		return err
+	}
+
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(message(s.from, to, subject, body)); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	if err := c.Quit(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func message(from string, to string, subject string, body string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return b.Bytes()
+}
@@ -0,0 +1,425 @@
+package oauth
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/throttle"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+const codeChallengeMethodS256 = "S256"
+
+var (
+	//go:embed templates/*.html
+	templateFS embed.FS
+
+	templates = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+)
+
+// authorizeRequest holds parameters of the authorization request, they are passed through the consent form.
+type authorizeRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+// csrfForm returns form data the csrf token of the consent page is bound to.
+func (req authorizeRequest) csrfForm() string {
+	data, _ := json.Marshal(req)
+	return "authorize:" + string(data)
+}
+
+func parseAuthorizeRequest(r *http.Request) authorizeRequest {
+	return authorizeRequest{
+		ClientID:            r.Form.Get("client_id"),
+		RedirectURI:         r.Form.Get("redirect_uri"),
+		ResponseType:        r.Form.Get("response_type"),
+		Scope:               r.Form.Get("scope"),
+		State:               r.Form.Get("state"),
+		CodeChallenge:       r.Form.Get("code_challenge"),
+		CodeChallengeMethod: r.Form.Get("code_challenge_method"),
+		Nonce:               r.Form.Get("nonce"),
+	}
+}
+
+type consentPage struct {
+	Request    authorizeRequest
+	CSRFToken  string
+	ClientName string
+	Scopes     []string
+	Providers  []providerButton
+	Name       string
+	Error      string
+}
+
+type providerButton struct {
+	Action      string
+	DisplayName string
+}
+
+// providerButtons returns upstream providers to log in with, ordered as configured.
+func (s *Server) providerButtons() []providerButton {
+	buttons := make([]providerButton, 0, len(s.providerOrder))
+	for _, name := range s.providerOrder {
+		buttons = append(buttons, providerButton{
+			Action:      federateActionPrefix + name,
+			DisplayName: s.providers[name].cfg.DisplayName,
+		})
+	}
+	return buttons
+}
+
+type errorPage struct {
+	Error string
+}
+
+func (s *Server) renderPage(w http.ResponseWriter, code int, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	w.WriteHeader(code)
+	if err := templates.ExecuteTemplate(w, name, data); err != nil {
+		s.l.Errorf("render %s error: %v", name, err)
+	}
+}
+
+// renderConsent shows consent page with new csrf token.
+func (s *Server) renderConsent(w http.ResponseWriter, r *http.Request, code int, page consentPage) {
+	token, err := s.csrfToken(w, r, page.Request.csrfForm())
+	if err != nil {
+		s.l.Errorf("csrf token error: %v", err)
+		s.renderError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	page.CSRFToken = token
+	s.renderPage(w, code, "authorize.html", page)
+}
+
+// renderError shows error to the user, used when the client can't be trusted with redirect.
+func (s *Server) renderError(w http.ResponseWriter, code int, message string) {
+	s.renderPage(w, code, "error.html", errorPage{
+		Error: message,
+	})
+}
+
+// redirectError returns error to the client by redirect, see RFC 6749 section 4.1.2.1.
+func redirectError(w http.ResponseWriter, r *http.Request, req authorizeRequest, errCode string, description string) {
+	params := url.Values{}
+	params.Set("error", errCode)
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	redirect(w, r, req, params)
+}
+
+func redirect(w http.ResponseWriter, r *http.Request, req authorizeRequest, params url.Values) {
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	u, _ := url.Parse(req.RedirectURI)
+	query := u.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	u.RawQuery = query.Encode()
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// resolveRedirectURI returns redirect uri of the request, it must exactly match one of the registered,
+// the only registered uri is used when the request has none.
+func resolveRedirectURI(client *db.OAuthClient, uri string) (string, bool) {
+	if uri == "" {
+		if len(client.RedirectURIs) == 1 {
+			return client.RedirectURIs[0], true
+		}
+		return "", false
+	}
+
+	for _, registered := range client.RedirectURIs {
+		if registered == uri {
+			return uri, true
+		}
+	}
+	return "", false
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		s.renderError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	req := parseAuthorizeRequest(r)
+
+	client, err := s.repo.GetOAuthClient(r.Context(), req.ClientID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			s.renderError(w, http.StatusBadRequest, "unknown client")
+			return
+		}
+		s.l.Errorf("get oauth client error: %v", err)
+		s.renderError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	redirectURI, ok := resolveRedirectURI(client, req.RedirectURI)
+	if !ok {
+		s.renderError(w, http.StatusBadRequest, "invalid redirect uri")
+		return
+	}
+	req.RedirectURI = redirectURI
+
+	// from now on errors are reported to the client
+	if req.ResponseType != "code" {
+		redirectError(w, r, req, "unsupported_response_type", "only code response type is supported")
+		return
+	}
+
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != codeChallengeMethodS256 {
+		redirectError(w, r, req, "invalid_request", "code challenge with S256 method is required")
+		return
+	}
+
+	if len(req.CodeChallenge) > db.MaxCodeChallengeLength {
+		redirectError(w, r, req, "invalid_request", "code challenge is too long")
+		return
+	}
+
+	if len(req.Nonce) > db.MaxNonceLength {
+		redirectError(w, r, req, "invalid_request", "nonce is too long")
+		return
+	}
+
+	scopes, ok := parseScope(req.Scope)
+	if !ok || !containsAll(client.Scopes, scopes) {
+		redirectError(w, r, req, "invalid_scope", "")
+		return
+	}
+
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+		req.Scope = strings.Join(scopes, " ")
+	}
+
+	page := consentPage{
+		Request:    req,
+		ClientName: client.Name,
+		Scopes:     scopes,
+		Providers:  s.providerButtons(),
+	}
+
+	if r.Method == http.MethodGet {
+		s.renderConsent(w, r, http.StatusOK, page)
+		return
+	}
+
+	if err := s.checkCSRF(r, req.csrfForm()); err != nil {
+		s.renderError(w, http.StatusForbidden, "the form has expired, reload the page and try again")
+		return
+	}
+
+	action := r.PostForm.Get("action")
+	if strings.HasPrefix(action, federateActionPrefix) {
+		s.startFederation(w, r, strings.TrimPrefix(action, federateActionPrefix), req)
+		return
+	}
+
+	if action != "approve" {
+		redirectError(w, r, req, "access_denied", "")
+		return
+	}
+
+	page.Name = r.PostForm.Get("name")
+	user, err := s.checkCredentials(r, page.Name, r.PostForm.Get("password"))
+	if err != nil {
+		switch {
+		case errors.Is(err, errBadCredentials):
+			page.Error = "invalid name or password"
+			s.renderConsent(w, r, http.StatusUnauthorized, page)
+			return
+		case errors.Is(err, errLocked):
+			page.Error = "too many failed logins, try later"
+			s.renderConsent(w, r, http.StatusTooManyRequests, page)
+			return
+		}
+		s.l.Errorf("check credentials error: %v", err)
+		s.renderError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	code, err := s.issueCode(r, client, user, req)
+	if err != nil {
+		s.l.Errorf("issue authorization code error: %v", err)
+		redirectError(w, r, req, "server_error", "")
+		return
+	}
+
+	redirect(w, r, req, url.Values{
+		"code": []string{code},
+	})
+}
+
+var (
+	errBadCredentials = errors.New("bad credentials")
+	errLocked         = errors.New("too many failed logins")
+)
+
+// loginKey returns login throttle key of the name tried by the client of r.
+func loginKey(r *http.Request, name string) string {
+	clientIP, _ := shared.ClientInfo(r)
+	return throttle.Key(clientIP, name)
+}
+
+// checkCredentials returns user by name and password entered on the consent page, failures are audited.
+// Failures are counted by the login throttle shared with Auth, names locked for the client get errLocked.
+func (s *Server) checkCredentials(r *http.Request, name string, password string) (*db.User, error) {
+	if s.loginThrottle.Locked(loginKey(r, name)) {
+		if err := s.audit(r, db.AuditEvent{
+			Type:     db.AuditLoginFailure,
+			UserName: name,
+			Details:  "oauth: locked: too many failed logins",
+		}); err != nil {
+			return nil, err
+		}
+		return nil, errLocked
+	}
+
+	var (
+		user *db.User
+		err  error
+	)
+	if s.authenticator != nil {
+		user, err = s.authenticator.Authenticate(r.Context(), name, password)
+		if err != nil {
+			if isRejected(err) {
+				return nil, errBadCredentials
+			}
+			return nil, err
+		}
+	} else {
+		user, err = s.checkLocalCredentials(r, name, password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.loginThrottle.Reset(loginKey(r, name))
+	return user, nil
+}
+
+// isRejected reports whether the authenticator rejected credentials and recorded it,
+// failed audit of the rejection is an error of the server.
+func isRejected(err error) bool {
+	var httpErr *httperror.Error
+	if !errors.As(err, &httpErr) || errors.Unwrap(httpErr) != nil {
+		return false
+	}
+
+	switch httpErr.Code {
+	case httperror.CodeNotExist, httperror.CodeNotMatch, httperror.CodeAlreadyExist:
+		return true
+	}
+	return false
+}
+
+// checkLocalCredentials checks password of the user against the stored bcrypt hash, failures are audited and counted.
+func (s *Server) checkLocalCredentials(r *http.Request, name string, password string) (*db.User, error) {
+	user, err := s.users.GetByName(r.Context(), name)
+	if err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			s.loginThrottle.Fail(loginKey(r, name))
+			if err := s.audit(r, db.AuditEvent{
+				Type:     db.AuditLoginFailure,
+				UserName: name,
+				Details:  "oauth: unknown user",
+			}); err != nil {
+				return nil, err
+			}
+			return nil, errBadCredentials
+		}
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Pwd.String), []byte(password)); err != nil {
+		s.loginThrottle.Fail(loginKey(r, name))
+		if err := s.audit(r, db.AuditEvent{
+			Type:     db.AuditLoginFailure,
+			UserID:   user.ID,
+			UserName: user.Name,
+			Details:  "oauth: bad password",
+		}); err != nil {
+			return nil, err
+		}
+		return nil, errBadCredentials
+	}
+
+	return user, nil
+}
+
+// issueCode records the user approval and returns new authorization code, only its hash is stored.
+func (s *Server) issueCode(r *http.Request, client *db.OAuthClient, user *db.User, req authorizeRequest) (string, error) {
+	if err := s.repo.SaveOAuthGrant(r.Context(), &db.OAuthGrant{
+		UserID:   user.ID,
+		ClientID: client.ID,
+		Scope:    req.Scope,
+	}); err != nil {
+		return "", fmt.Errorf("save grant: %w", err)
+	}
+
+	code, err := shared.RandomString(32)
+	if err != nil {
+		return "", fmt.Errorf("generate code: %w", err)
+	}
+
+	if err := s.repo.CreateOAuthCode(r.Context(), &db.OAuthCode{
+		CodeHash:      shared.HashSecret(code),
+		ClientID:      client.ID,
+		UserID:        user.ID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         req.Scope,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(s.codeTTL).UTC(),
+		Nonce:         req.Nonce,
+	}); err != nil {
+		return "", fmt.Errorf("create code: %w", err)
+	}
+
+	if err := s.audit(r, db.AuditEvent{
+		Type:     db.AuditOAuthAuthorize,
+		UserID:   user.ID,
+		UserName: user.Name,
+		Details:  fmt.Sprintf("client %s scope %q", client.ID, req.Scope),
+	}); err != nil {
+		return "", fmt.Errorf("audit: %w", err)
+	}
+
+	return code, nil
+}
@@ -0,0 +1,193 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/throttle"
+	"github.com/Mikhalevich/filesharing/pkg/httperror"
+)
+
+func TestAuthorizeIssuesCode(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	ts.createUser(t, "alice", "secret")
+	client := ts.createClient(t, ScopeStorageRead)
+
+	params := authorizeParams(client, ScopeStorageRead, "xyz")
+	authorizeURL := ts.URL + "/oauth/authorize"
+
+	b := ts.browser(t)
+	csrf := openPage(t, b, authorizeURL+"?"+params.Encode())
+
+	rsp := postForm(t, b, authorizeURL, withValues(params, "csrf_token", csrf, "action", "approve", "name", "alice", "password", "secret"))
+	if rsp.StatusCode != http.StatusFound {
+		t.Fatalf("approve: status %d, want redirect", rsp.StatusCode)
+	}
+
+	location, err := url.Parse(rsp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("parse redirect: %v", err)
+	}
+
+	if location.Query().Get("code") == "" || location.Query().Get("state") != "xyz" {
+		t.Errorf("redirect %s, want code and state", location)
+	}
+}
+
+func TestAuthorizeRequiresCSRFToken(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	ts.createUser(t, "alice", "secret")
+	client := ts.createClient(t, ScopeStorageRead)
+
+	params := authorizeParams(client, ScopeStorageRead, "xyz")
+	authorizeURL := ts.URL + "/oauth/authorize"
+
+	b := ts.browser(t)
+	csrf := openPage(t, b, authorizeURL+"?"+params.Encode())
+	approve := func(params url.Values, csrf string) url.Values {
+		return withValues(params, "csrf_token", csrf, "action", "approve", "name", "alice", "password", "secret")
+	}
+
+	for _, tc := range []struct {
+		name    string
+		browser *http.Client
+		form    url.Values
+	}{
+		{"no token", b, approve(params, "")},
+		{"invalid token", b, approve(params, "1."+csrf)},
+		{"token of other request", b, approve(authorizeParams(client, ScopeStorageRead, "other"), csrf)},
+		{"other browser", ts.browser(t), approve(params, csrf)},
+		{"deny without token", b, withValues(params, "action", "deny")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if rsp := postForm(t, tc.browser, authorizeURL, tc.form); rsp.StatusCode != http.StatusForbidden {
+				t.Errorf("status %d, want %d", rsp.StatusCode, http.StatusForbidden)
+			}
+		})
+	}
+}
+
+func TestAuthorizeLocksOut(t *testing.T) {
+	ts := newTestServer(t, Config{}, WithLoginThrottle(throttle.NewLimiter(2, time.Minute)))
+	ts.createUser(t, "alice", "secret")
+	client := ts.createClient(t, ScopeStorageRead)
+
+	params := authorizeParams(client, ScopeStorageRead, "xyz")
+	authorizeURL := ts.URL + "/oauth/authorize"
+
+	b := ts.browser(t)
+	csrf := openPage(t, b, authorizeURL+"?"+params.Encode())
+
+	for _, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		rsp := postForm(t, b, authorizeURL, withValues(params, "csrf_token", csrf, "action", "approve", "name", "alice", "password", "wrong"))
+		if rsp.StatusCode != want {
+			t.Fatalf("login with wrong password: status %d, want %d", rsp.StatusCode, want)
+		}
+	}
+
+	rsp := postForm(t, b, authorizeURL, withValues(params, "csrf_token", csrf, "action", "approve", "name", "alice", "password", "secret"))
+	if rsp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("login of locked user: status %d, want %d", rsp.StatusCode, http.StatusTooManyRequests)
+	}
+}
+
+func TestAuthorizeRejectsLongParameters(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	client := ts.createClient(t, ScopeStorageRead)
+	b := ts.browser(t)
+
+	for _, tc := range []struct {
+		name  string
+		key   string
+		value string
+	}{
+		{"nonce", "nonce", strings.Repeat("n", db.MaxNonceLength+1)},
+		{"code challenge", "code_challenge", strings.Repeat("c", db.MaxCodeChallengeLength+1)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rsp, err := b.Get(ts.URL + "/oauth/authorize?" + withValues(authorizeParams(client, ScopeStorageRead, "xyz"), tc.key, tc.value).Encode())
+			if err != nil {
+				t.Fatalf("authorize: %v", err)
+			}
+			rsp.Body.Close()
+
+			location, err := url.Parse(rsp.Header.Get("Location"))
+			if err != nil {
+				t.Fatalf("parse redirect: %v", err)
+			}
+
+			if rsp.StatusCode != http.StatusFound || location.Query().Get("error") != "invalid_request" {
+				t.Errorf("status %d redirect %s, want invalid_request", rsp.StatusCode, location)
+			}
+		})
+	}
+}
+
+// testAuthenticator accepts the password of the user and rejects others the way the handler does, err fails all logins.
+type testAuthenticator struct {
+	user     *db.User
+	password string
+	err      error
+}
+
+func (a *testAuthenticator) Authenticate(ctx context.Context, name string, password string) (*db.User, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+
+	if name != a.user.Name {
+		return nil, httperror.NewNotExistError("user not exists").WithError(nil)
+	}
+
+	if password != a.password {
+		return nil, httperror.NewNotMatchError("pwd not match").WithError(nil)
+	}
+	return a.user, nil
+}
+
+func TestAuthorizeUsesAuthenticator(t *testing.T) {
+	a := &testAuthenticator{password: "ldappw"}
+	ts := newTestServer(t, Config{}, WithAuthenticator(a))
+	// directory users have no local password
+	a.user = ts.createUser(t, "erin", "")
+	client := ts.createClient(t, ScopeStorageRead)
+
+	params := authorizeParams(client, ScopeStorageRead, "xyz")
+	authorizeURL := ts.URL + "/oauth/authorize"
+
+	b := ts.browser(t)
+	csrf := openPage(t, b, authorizeURL+"?"+params.Encode())
+	approve := func(name string, password string) *http.Response {
+		return postForm(t, b, authorizeURL, withValues(params, "csrf_token", csrf, "action", "approve", "name", name, "password", password))
+	}
+
+	for _, tc := range []struct {
+		name     string
+		password string
+		want     int
+	}{
+		{"erin", "wrong", http.StatusUnauthorized},
+		{"unknown", "ldappw", http.StatusUnauthorized},
+		{"erin", "ldappw", http.StatusFound},
+	} {
+		if rsp := approve(tc.name, tc.password); rsp.StatusCode != tc.want {
+			t.Errorf("approve as %s: status %d, want %d", tc.name, rsp.StatusCode, tc.want)
+		}
+	}
+
+	for _, err := range []error{
+		httperror.NewInternalError("directory error").WithError(errors.New("connection refused")),
+		httperror.NewNotMatchError("pwd not match").WithError(errors.New("audit failed")),
+	} {
+		a.err = err
+		if rsp := approve("erin", "ldappw"); rsp.StatusCode != http.StatusInternalServerError {
+			t.Errorf("approve with authenticator error %v: status %d, want %d", err, rsp.StatusCode, http.StatusInternalServerError)
+		}
+	}
+}
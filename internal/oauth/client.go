@@ -0,0 +1,186 @@
+package oauth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+)
+
+const (
+	authMethodBasic = "client_secret_basic"
+	authMethodPost  = "client_secret_post"
+	authMethodNone  = "none"
+
+	maxClientNameLength   = 100
+	maxRedirectURIs       = 10
+	maxRegistrationLength = 1 << 16
+)
+
+// registrationRequest is the subset of client metadata of RFC 7591.
+type registrationRequest struct {
+	ClientName              string   `json:"client_name"`
+	RedirectURIs            []string `json:"redirect_uris"`
+	Scope                   string   `json:"scope"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+}
+
+type registrationResponse struct {
+	ClientID                string   `json:"client_id"`
+	ClientSecret            string   `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64    `json:"client_id_issued_at"`
+	ClientName              string   `json:"client_name"`
+	RedirectURIs            []string `json:"redirect_uris"`
+	Scope                   string   `json:"scope"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+}
+
+// validateRedirectURI accepts absolute https uris and http uris of loopback interface for native apps.
+func validateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return fmt.Errorf("invalid redirect uri %q", uri)
+	}
+
+	if u.Fragment != "" || strings.Contains(uri, "#") {
+		return fmt.Errorf("redirect uri %q must not contain fragment", uri)
+	}
+
+	switch u.Scheme {
+	case "https":
+		if u.Host == "" {
+			return fmt.Errorf("redirect uri %q has no host", uri)
+		}
+		return nil
+
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+		return fmt.Errorf("redirect uri %q must use https", uri)
+
+	default:
+		return fmt.Errorf("redirect uri %q must be absolute http(s) uri", uri)
+	}
+}
+
+// authorizeRegistration checks the registration bearer token in constant time.
+func (s *Server) authorizeRegistration(r *http.Request) bool {
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, prefix) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, prefix)), []byte(s.registrationToken)) == 1
+}
+
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request", "method not allowed")
+		return
+	}
+
+	if !s.authorizeRegistration(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeError(w, http.StatusUnauthorized, "invalid_token", "invalid registration token")
+		return
+	}
+
+	var req registrationRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRegistrationLength)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_client_metadata", "invalid json")
+		return
+	}
+
+	if req.ClientName == "" || len(req.ClientName) > maxClientNameLength {
+		writeError(w, http.StatusBadRequest, "invalid_client_metadata", "invalid client_name")
+		return
+	}
+
+	if len(req.RedirectURIs) == 0 || len(req.RedirectURIs) > maxRedirectURIs {
+		writeError(w, http.StatusBadRequest, "invalid_redirect_uri", "invalid number of redirect_uris")
+		return
+	}
+
+	for _, uri := range req.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_redirect_uri", err.Error())
+			return
+		}
+	}
+
+	scopes, ok := parseScope(req.Scope)
+	if !ok || len(scopes) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid_client_metadata", "invalid scope")
+		return
+	}
+
+	if req.TokenEndpointAuthMethod == "" {
+		req.TokenEndpointAuthMethod = authMethodBasic
+	}
+
+	if req.TokenEndpointAuthMethod != authMethodBasic && req.TokenEndpointAuthMethod != authMethodPost && req.TokenEndpointAuthMethod != authMethodNone {
+		writeError(w, http.StatusBadRequest, "invalid_client_metadata", "unsupported token_endpoint_auth_method")
+		return
+	}
+
+	clientID, err := shared.RandomString(16)
+	if err != nil {
+		s.l.Errorf("generate client id error: %v", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	client := db.OAuthClient{
+		ID:           clientID,
+		AuthMethod:   req.TokenEndpointAuthMethod,
+		Name:         req.ClientName,
+		RedirectURIs: req.RedirectURIs,
+		Scopes:       scopes,
+	}
+
+	var secret string
+	if req.TokenEndpointAuthMethod != authMethodNone {
+		secret, err = shared.RandomString(32)
+		if err != nil {
+			s.l.Errorf("generate client secret error: %v", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+		client.SecretHash = shared.HashSecret(secret)
+	}
+
+	if err := s.repo.CreateOAuthClient(r.Context(), &client); err != nil {
+		s.l.Errorf("create oauth client error: %v", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	if err := s.audit(r, db.AuditEvent{
+		Type:    db.AuditOAuthClientRegister,
+		Details: fmt.Sprintf("client %s (%s)", client.ID, client.Name),
+	}); err != nil {
+		s.l.Errorf("audit error: %v", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, registrationResponse{
+		ClientID:                client.ID,
+		ClientSecret:            secret,
+		ClientIDIssuedAt:        client.CreatedAt.Unix(),
+		ClientName:              client.Name,
+		RedirectURIs:            client.RedirectURIs,
+		Scope:                   strings.Join(client.Scopes, " "),
+		TokenEndpointAuthMethod: req.TokenEndpointAuthMethod,
+	})
+}
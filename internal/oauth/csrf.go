@@ -0,0 +1,80 @@
+package oauth
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+)
+
+const (
+	csrfCookie = "oauth_csrf"
+	csrfField  = "csrf_token"
+	csrfTTL    = time.Hour
+)
+
+var errInvalidCSRF = errors.New("invalid csrf token")
+
+// csrfData returns data signed by the csrf token of the form.
+func csrfData(cookie string, expiresAt int64, form string) []byte {
+	return []byte("csrf:" + cookie + ":" + strconv.FormatInt(expiresAt, 10) + ":" + form)
+}
+
+// csrfToken returns token of the form rendered to the browser. The token is bound to the browser by the cookie
+// and to the form data, so it can't submit other request or be used from other browser.
+func (s *Server) csrfToken(w http.ResponseWriter, r *http.Request, form string) (string, error) {
+	var value string
+	if c, err := r.Cookie(csrfCookie); err == nil && c.Value != "" {
+		value = c.Value
+	} else {
+		value, err = shared.RandomString(32)
+		if err != nil {
+			return "", err
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     csrfCookie,
+			Value:    value,
+			Path:     "/oauth/",
+			Secure:   strings.HasPrefix(s.issuer, "https://"),
+			HttpOnly: true,
+			// pages are opened by top-level navigation from clients, cross-site posts don't get lax cookies
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	expiresAt := time.Now().Add(csrfTTL).Unix()
+	sig, err := s.encoder.Sign(csrfData(value, expiresAt, form))
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatInt(expiresAt, 10) + "." + sig, nil
+}
+
+// checkCSRF verifies the token of the submitted form.
+func (s *Server) checkCSRF(r *http.Request, form string) error {
+	c, err := r.Cookie(csrfCookie)
+	if err != nil {
+		return errInvalidCSRF
+	}
+
+	parts := strings.SplitN(r.PostForm.Get(csrfField), ".", 2)
+	if len(parts) != 2 {
+		return errInvalidCSRF
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return errInvalidCSRF
+	}
+
+	if err := s.decoder.Verify(csrfData(c.Value, expiresAt, form), parts[1]); err != nil {
+		return errInvalidCSRF
+	}
+
+	return nil
+}
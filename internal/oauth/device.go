@@ -0,0 +1,179 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+)
+
+// devicePath is the verification uri of device authorization, see RFC 8628 section 3.3.
+const devicePath = "/oauth/device"
+
+// defaultUserCodeMaxFailures limits invalid user codes entered from the same address, see RFC 8628 section 5.1.
+const defaultUserCodeMaxFailures = 10
+
+type devicePage struct {
+	Code      *db.DeviceCode
+	Name      string
+	Error     string
+	Done      string
+	CSRFToken string
+}
+
+// deviceCSRFForm returns form data csrf token of the device page is bound to.
+func deviceCSRFForm(code *db.DeviceCode) string {
+	return "device:" + code.UserCode
+}
+
+// DeviceVerificationURI returns url of the page users approve devices on, the page is served by the server of the config.
+func (c Config) DeviceVerificationURI() string {
+	return strings.TrimSuffix(c.Issuer, "/") + devicePath
+}
+
+// renderDevice shows device page, the form of the code gets new csrf token.
+func (s *Server) renderDevice(w http.ResponseWriter, r *http.Request, code int, page devicePage) {
+	if page.Code != nil && page.Done == "" {
+		token, err := s.csrfToken(w, r, deviceCSRFForm(page.Code))
+		if err != nil {
+			s.l.Errorf("csrf token error: %v", err)
+			s.renderError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		page.CSRFToken = token
+	}
+
+	s.renderPage(w, code, "device.html", page)
+}
+
+// pendingDeviceCode returns pending not expired code by the user code entered by the user.
+func (s *Server) pendingDeviceCode(r *http.Request, userCode string) (*db.DeviceCode, error) {
+	code, err := s.repo.GetDeviceCodeByUserCode(r.Context(), db.NormalizeUserCode(userCode))
+	if err != nil {
+		return nil, err
+	}
+
+	if code.Status != db.DeviceCodePending || time.Now().After(code.ExpiresAt) {
+		return nil, db.ErrNotExist
+	}
+
+	return code, nil
+}
+
+func (s *Server) device(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		s.renderError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	var page devicePage
+	userCode := r.Form.Get("user_code")
+	if userCode == "" {
+		s.renderDevice(w, r, http.StatusOK, page)
+		return
+	}
+
+	// user codes are short, guessing them is limited per client address
+	clientIP, _ := shared.ClientInfo(r)
+	if s.userCodeThrottle.Locked(clientIP) {
+		page.Error = "too many invalid codes, try later"
+		s.renderDevice(w, r, http.StatusTooManyRequests, page)
+		return
+	}
+
+	code, err := s.pendingDeviceCode(r, userCode)
+	if err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			s.userCodeThrottle.Fail(clientIP)
+			page.Error = "invalid or expired code"
+			s.renderDevice(w, r, http.StatusBadRequest, page)
+			return
+		}
+		s.l.Errorf("get device code error: %v", err)
+		s.renderError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	page.Code = code
+
+	if r.Method == http.MethodGet {
+		s.renderDevice(w, r, http.StatusOK, page)
+		return
+	}
+
+	if err := s.checkCSRF(r, deviceCSRFForm(code)); err != nil {
+		s.renderError(w, http.StatusForbidden, "the form has expired, reload the page and try again")
+		return
+	}
+
+	var status string
+	switch r.PostForm.Get("action") {
+	case "approve":
+		status = db.DeviceCodeApproved
+	case "deny":
+		status = db.DeviceCodeDenied
+	default:
+		s.renderError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	// the device is denied by its user only, otherwise anyone knowing the code could deny it
+	page.Name = r.PostForm.Get("name")
+	user, err := s.checkCredentials(r, page.Name, r.PostForm.Get("password"))
+	if err != nil {
+		switch {
+		case errors.Is(err, errBadCredentials):
+			page.Error = "invalid name or password"
+			s.renderDevice(w, r, http.StatusUnauthorized, page)
+			return
+		case errors.Is(err, errLocked):
+			page.Error = "too many failed logins, try later"
+			s.renderDevice(w, r, http.StatusTooManyRequests, page)
+			return
+		}
+		s.l.Errorf("check credentials error: %v", err)
+		s.renderError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	if err := s.decideDeviceCode(r, code, user, status); err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			s.renderDevice(w, r, http.StatusBadRequest, devicePage{
+				Error: "invalid or expired code",
+			})
+			return
+		}
+		s.l.Errorf("decide device code error: %v", err)
+		s.renderError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	page.Done = "Access denied"
+	if status == db.DeviceCodeApproved {
+		page.Done = "Device is authorized"
+	}
+	s.renderDevice(w, r, http.StatusOK, page)
+}
+
+// decideDeviceCode records decision of the user on the device code.
+func (s *Server) decideDeviceCode(r *http.Request, code *db.DeviceCode, user *db.User, status string) error {
+	if err := s.repo.DecideDeviceCode(r.Context(), code.UserCode, user.ID, status); err != nil {
+		return err
+	}
+
+	return s.audit(r, db.AuditEvent{
+		Type:     db.AuditDeviceAuthorize,
+		UserID:   user.ID,
+		UserName: user.Name,
+		Details:  fmt.Sprintf("%s code %s client %q from %s", status, code.UserCode, code.ClientName, code.ClientIP),
+	})
+}
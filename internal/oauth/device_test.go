@@ -0,0 +1,183 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/throttle"
+)
+
+func (ts *testServer) createDeviceCode(t *testing.T) *db.DeviceCode {
+	t.Helper()
+
+	userCode, err := db.NewUserCode()
+	if err != nil {
+		t.Fatalf("generate user code: %v", err)
+	}
+
+	c := db.DeviceCode{
+		CodeHash:   "hash-" + userCode,
+		UserCode:   userCode,
+		ClientName: "cli",
+		ClientIP:   "192.0.2.1",
+		Interval:   time.Second * 5,
+		ExpiresAt:  time.Now().Add(time.Minute),
+	}
+	if err := ts.m.CreateDeviceCode(context.Background(), &c); err != nil {
+		t.Fatalf("create device code: %v", err)
+	}
+	return &c
+}
+
+func (ts *testServer) deviceCodeStatus(t *testing.T, code *db.DeviceCode) (string, int64) {
+	t.Helper()
+
+	c, err := ts.m.GetDeviceCode(context.Background(), code.CodeHash)
+	if err != nil {
+		t.Fatalf("get device code: %v", err)
+	}
+	return c.Status, c.UserID
+}
+
+func TestDeviceDecision(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	alice := ts.createUser(t, "alice", "secret")
+	deviceURL := ts.URL + devicePath
+
+	for _, tc := range []struct {
+		action string
+		want   string
+	}{
+		{"approve", db.DeviceCodeApproved},
+		{"deny", db.DeviceCodeDenied},
+	} {
+		t.Run(tc.action, func(t *testing.T) {
+			code := ts.createDeviceCode(t)
+			b := ts.browser(t)
+			csrf := openPage(t, b, deviceURL+"?user_code="+code.UserCode)
+			form := url.Values{
+				"user_code":  {code.UserCode},
+				"csrf_token": {csrf},
+				"action":     {tc.action},
+			}
+
+			if rsp := postForm(t, b, deviceURL, form); rsp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("%s without login: status %d, want %d", tc.action, rsp.StatusCode, http.StatusUnauthorized)
+			}
+
+			if status, _ := ts.deviceCodeStatus(t, code); status != db.DeviceCodePending {
+				t.Fatalf("%s without login: status %s", tc.action, status)
+			}
+
+			if rsp := postForm(t, b, deviceURL, withValues(form, "name", "alice", "password", "secret")); rsp.StatusCode != http.StatusOK {
+				t.Fatalf("%s: status %d", tc.action, rsp.StatusCode)
+			}
+
+			if status, userID := ts.deviceCodeStatus(t, code); status != tc.want || userID != alice.ID {
+				t.Errorf("%s: status %s by user %d, want %s by %d", tc.action, status, userID, tc.want, alice.ID)
+			}
+		})
+	}
+}
+
+func TestDeviceRequiresCSRFToken(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	ts.createUser(t, "alice", "secret")
+	code := ts.createDeviceCode(t)
+	other := ts.createDeviceCode(t)
+	deviceURL := ts.URL + devicePath
+
+	b := ts.browser(t)
+	csrf := openPage(t, b, deviceURL+"?user_code="+code.UserCode)
+	form := func(userCode string, csrf string) url.Values {
+		return url.Values{
+			"user_code":  {userCode},
+			"csrf_token": {csrf},
+			"action":     {"approve"},
+			"name":       {"alice"},
+			"password":   {"secret"},
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		browser *http.Client
+		form    url.Values
+	}{
+		{"no token", b, form(code.UserCode, "")},
+		{"token of other code", b, form(other.UserCode, csrf)},
+		{"other browser", ts.browser(t), form(code.UserCode, csrf)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if rsp := postForm(t, tc.browser, deviceURL, tc.form); rsp.StatusCode != http.StatusForbidden {
+				t.Errorf("status %d, want %d", rsp.StatusCode, http.StatusForbidden)
+			}
+		})
+	}
+
+	for _, c := range []*db.DeviceCode{code, other} {
+		if status, _ := ts.deviceCodeStatus(t, c); status != db.DeviceCodePending {
+			t.Errorf("code %s is %s", c.UserCode, status)
+		}
+	}
+}
+
+func TestDeviceThrottlesFailures(t *testing.T) {
+	ts := newTestServer(t, Config{},
+		WithLoginThrottle(throttle.NewLimiter(2, time.Minute)),
+		WithUserCodeThrottle(throttle.NewLimiter(2, time.Minute)),
+	)
+	ts.createUser(t, "alice", "secret")
+	code := ts.createDeviceCode(t)
+	deviceURL := ts.URL + devicePath
+
+	t.Run("login", func(t *testing.T) {
+		b := ts.browser(t)
+		csrf := openPage(t, b, deviceURL+"?user_code="+code.UserCode)
+		form := url.Values{
+			"user_code":  {code.UserCode},
+			"csrf_token": {csrf},
+			"action":     {"approve"},
+			"name":       {"alice"},
+		}
+
+		for _, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+			if rsp := postForm(t, b, deviceURL, withValues(form, "password", "wrong")); rsp.StatusCode != want {
+				t.Fatalf("wrong password: status %d, want %d", rsp.StatusCode, want)
+			}
+		}
+
+		if rsp := postForm(t, b, deviceURL, withValues(form, "password", "secret")); rsp.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("locked user: status %d, want %d", rsp.StatusCode, http.StatusTooManyRequests)
+		}
+	})
+
+	t.Run("user code", func(t *testing.T) {
+		b := ts.browser(t)
+		for _, want := range []int{http.StatusBadRequest, http.StatusBadRequest, http.StatusTooManyRequests} {
+			rsp, err := b.Get(deviceURL + "?user_code=BBBB-BBBB")
+			if err != nil {
+				t.Fatalf("get device page: %v", err)
+			}
+			rsp.Body.Close()
+
+			if rsp.StatusCode != want {
+				t.Fatalf("invalid code: status %d, want %d", rsp.StatusCode, want)
+			}
+		}
+
+		rsp, err := b.Get(deviceURL + "?user_code=" + code.UserCode)
+		if err != nil {
+			t.Fatalf("get device page: %v", err)
+		}
+		rsp.Body.Close()
+
+		if rsp.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("valid code from locked address: status %d, want %d", rsp.StatusCode, http.StatusTooManyRequests)
+		}
+	})
+}
@@ -0,0 +1,395 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+)
+
+const (
+	federationCookie       = "oauth_federation"
+	federationCallbackPath = "/oauth/federation/callback"
+	federationTTL          = time.Minute * 10
+	federateActionPrefix   = "federate:"
+
+	maxUsernameLength   = 64
+	maxUsernameAttempts = 20
+)
+
+var errNotLinked = errors.New("identity is not linked to any user")
+
+// federationState is kept in the signed cookie between redirect to the provider and callback.
+type federationState struct {
+	Provider     string           `json:"provider"`
+	State        string           `json:"state"`
+	Nonce        string           `json:"nonce"`
+	CodeVerifier string           `json:"code_verifier"`
+	Request      authorizeRequest `json:"request"`
+	ExpiresAt    int64            `json:"expires_at"`
+}
+
+func (s *Server) setFederationCookie(w http.ResponseWriter, fs federationState) error {
+	payload, err := json.Marshal(fs)
+	if err != nil {
+		return err
+	}
+
+	sig, err := s.encoder.Sign(payload)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     federationCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(payload) + "." + sig,
+		Path:     federationCallbackPath,
+		MaxAge:   int(federationTTL.Seconds()),
+		Secure:   strings.HasPrefix(s.issuer, "https://"),
+		HttpOnly: true,
+		// callback is top-level navigation from the provider, so lax cookies are sent
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// federationCookieState returns verified state of the federated login and removes the cookie.
+func (s *Server) federationCookieState(w http.ResponseWriter, r *http.Request) (*federationState, error) {
+	c, err := r.Cookie(federationCookie)
+	if err != nil {
+		return nil, err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:   federationCookie,
+		Path:   federationCallbackPath,
+		MaxAge: -1,
+	})
+
+	parts := strings.SplitN(c.Value, ".", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("invalid cookie format")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.decoder.Verify(payload, parts[1]); err != nil {
+		return nil, err
+	}
+
+	var fs federationState
+	if err := json.Unmarshal(payload, &fs); err != nil {
+		return nil, err
+	}
+
+	if time.Now().Unix() > fs.ExpiresAt {
+		return nil, errors.New("federated login expired")
+	}
+
+	return &fs, nil
+}
+
+// startFederation redirects the user to the upstream provider to log in instead of entering password.
+func (s *Server) startFederation(w http.ResponseWriter, r *http.Request, providerName string, req authorizeRequest) {
+	p, ok := s.providers[providerName]
+	if !ok {
+		s.renderError(w, http.StatusBadRequest, "unknown identity provider")
+		return
+	}
+
+	var values [3]string
+	for i := range values {
+		v, err := shared.RandomString(32)
+		if err != nil {
+			s.l.Errorf("generate federation state error: %v", err)
+			s.renderError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		values[i] = v
+	}
+
+	fs := federationState{
+		Provider:     p.cfg.Name,
+		State:        values[0],
+		Nonce:        values[1],
+		CodeVerifier: values[2],
+		Request:      req,
+		ExpiresAt:    time.Now().Add(federationTTL).Unix(),
+	}
+
+	challenge := sha256.Sum256([]byte(fs.CodeVerifier))
+	authURL, err := p.authURL(r.Context(), s.issuer+federationCallbackPath, fs.State, fs.Nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		s.l.Errorf("identity provider %s error: %v", p.cfg.Name, err)
+		s.renderError(w, http.StatusBadGateway, "identity provider is unavailable")
+		return
+	}
+
+	if err := s.setFederationCookie(w, fs); err != nil {
+		s.l.Errorf("set federation cookie error: %v", err)
+		s.renderError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// federationCallback completes federated login and continues the authorization request it was started from.
+func (s *Server) federationCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		s.renderError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	fs, err := s.federationCookieState(w, r)
+	if err != nil {
+		s.renderError(w, http.StatusBadRequest, "invalid or expired login, start again")
+		return
+	}
+
+	query := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(fs.State)) != 1 {
+		s.renderError(w, http.StatusBadRequest, "invalid state")
+		return
+	}
+
+	p, ok := s.providers[fs.Provider]
+	if !ok {
+		s.renderError(w, http.StatusBadRequest, "unknown identity provider")
+		return
+	}
+
+	// the client may have been removed meanwhile, redirect uri is checked again as well
+	client, err := s.repo.GetOAuthClient(r.Context(), fs.Request.ClientID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			s.renderError(w, http.StatusBadRequest, "unknown client")
+			return
+		}
+		s.l.Errorf("get oauth client error: %v", err)
+		s.renderError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	if _, ok := resolveRedirectURI(client, fs.Request.RedirectURI); !ok {
+		s.renderError(w, http.StatusBadRequest, "invalid redirect uri")
+		return
+	}
+
+	if query.Get("error") != "" {
+		redirectError(w, r, fs.Request, "access_denied", "")
+		return
+	}
+
+	claims, err := p.exchange(r.Context(), s.issuer+federationCallbackPath, query.Get("code"), fs.CodeVerifier, fs.Nonce)
+	if err != nil {
+		s.l.Errorf("identity provider %s error: %v", p.cfg.Name, err)
+		s.renderError(w, http.StatusBadGateway, "login with "+p.cfg.DisplayName+" failed")
+		return
+	}
+
+	user, err := s.federatedUser(r, p, claims)
+	if err != nil {
+		if errors.Is(err, errNotLinked) {
+			if err := s.audit(r, db.AuditEvent{
+				Type:    db.AuditLoginFailure,
+				Details: fmt.Sprintf("federated: provider %s subject %s is not linked", p.cfg.Name, claims.Subject),
+			}); err != nil {
+				s.l.Errorf("audit error: %v", err)
+			}
+			s.renderError(w, http.StatusForbidden, "your "+p.cfg.DisplayName+" account is not linked to any user")
+			return
+		}
+		s.l.Errorf("federated user error: %v", err)
+		s.renderError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	if err := s.audit(r, db.AuditEvent{
+		Type:     db.AuditFederatedLogin,
+		UserID:   user.ID,
+		UserName: user.Name,
+		Details:  fmt.Sprintf("provider %s subject %s", p.cfg.Name, claims.Subject),
+	}); err != nil {
+		s.l.Errorf("audit error: %v", err)
+		s.renderError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	code, err := s.issueCode(r, client, user, fs.Request)
+	if err != nil {
+		s.l.Errorf("issue authorization code error: %v", err)
+		redirectError(w, r, fs.Request, "server_error", "")
+		return
+	}
+
+	redirect(w, r, fs.Request, url.Values{
+		"code": []string{code},
+	})
+}
+
+// federatedUser returns local user of the upstream identity, linking or provisioning it as configured.
+func (s *Server) federatedUser(r *http.Request, p *provider, claims *upstreamClaims) (*db.User, error) {
+	ctx := r.Context()
+
+	identity, err := s.repo.GetIdentity(ctx, p.cfg.Name, claims.Subject)
+	if err == nil {
+		if err := s.repo.TouchIdentity(ctx, p.cfg.Name, claims.Subject); err != nil {
+			return nil, err
+		}
+		return s.users.GetByID(ctx, identity.UserID)
+	}
+
+	if !errors.Is(err, db.ErrNotExist) {
+		return nil, err
+	}
+
+	if p.cfg.LinkByEmail && claims.Email != "" && claims.EmailVerified {
+		user, err := s.users.GetByEmail(ctx, claims.Email)
+		if err != nil && !errors.Is(err, db.ErrNotExist) {
+			return nil, err
+		}
+
+		if user != nil && user.HasVerifiedEmail(claims.Email) {
+			if err := s.link(r, p, claims, user, db.AuditIdentityLink); err != nil {
+				return nil, err
+			}
+			return user, nil
+		}
+	}
+
+	if !p.cfg.AutoProvision {
+		return nil, errNotLinked
+	}
+
+	user, err := s.provisionUser(ctx, p, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.link(r, p, claims, user, db.AuditRegister); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// link creates identity of the user and audits it with the event type.
+func (s *Server) link(r *http.Request, p *provider, claims *upstreamClaims, user *db.User, eventType string) error {
+	if err := s.repo.CreateIdentity(r.Context(), &db.Identity{
+		Provider: p.cfg.Name,
+		Subject:  claims.Subject,
+		UserID:   user.ID,
+		Email:    claims.Email,
+	}); err != nil {
+		return fmt.Errorf("create identity: %w", err)
+	}
+
+	return s.audit(r, db.AuditEvent{
+		Type:     eventType,
+		UserID:   user.ID,
+		UserName: user.Name,
+		Details:  fmt.Sprintf("federated: provider %s subject %s", p.cfg.Name, claims.Subject),
+	})
+}
+
+// provisionUser creates user without password for the upstream identity,
+// numeric suffix is added to the derived name until it is unique.
+func (s *Server) provisionUser(ctx context.Context, p *provider, claims *upstreamClaims) (*db.User, error) {
+	var emails []db.Email
+	if claims.Email != "" {
+		_, err := s.users.GetByEmail(ctx, claims.Email)
+		switch {
+		case errors.Is(err, db.ErrNotExist):
+			emails = append(emails, db.Email{
+				Email:    claims.Email,
+				Primary:  true,
+				Verified: claims.EmailVerified,
+			})
+		case err != nil:
+			return nil, err
+		}
+		// email of another user is not copied, the user is provisioned without email
+	}
+
+	base := deriveUsername(p.cfg, claims)
+	for i := 0; i < maxUsernameAttempts; i++ {
+		name := base
+		if i > 0 {
+			name = fmt.Sprintf("%s-%d", base, i+1)
+		}
+
+		user := db.User{
+			Name:   name,
+			Emails: emails,
+		}
+		err := s.users.Create(ctx, &user)
+		if errors.Is(err, db.ErrAlreadyExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("create user: %w", err)
+		}
+		return &user, nil
+	}
+
+	return nil, fmt.Errorf("unable to find free name for %q", base)
+}
+
+// deriveUsername returns name of the provisioned user by the username policy of the provider,
+// other claims are used when the preferred one is empty.
+func deriveUsername(cfg ProviderConfig, claims *upstreamClaims) string {
+	var emailLocal string
+	if idx := strings.Index(claims.Email, "@"); idx > 0 {
+		emailLocal = claims.Email[:idx]
+	}
+	subject := cfg.Name + "-" + claims.Subject
+
+	var candidates []string
+	switch cfg.UsernamePolicy {
+	case UsernameEmail:
+		candidates = []string{emailLocal, claims.PreferredUsername, subject}
+	case UsernameSubject:
+		candidates = []string{subject}
+	default:
+		candidates = []string{claims.PreferredUsername, emailLocal, subject}
+	}
+
+	for _, c := range candidates {
+		if name := sanitizeUsername(c); name != "" {
+			return name
+		}
+	}
+	return cfg.Name + "-user"
+}
+
+// sanitizeUsername lowercases name and keeps only letters, digits, dots, dashes and underscores.
+func sanitizeUsername(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			b.WriteRune(r)
+		}
+	}
+
+	sanitized := strings.Trim(b.String(), ".-_")
+	if len(sanitized) > maxUsernameLength {
+		sanitized = strings.Trim(sanitized[:maxUsernameLength], ".-_")
+	}
+	return sanitized
+}
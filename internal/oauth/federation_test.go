@@ -0,0 +1,414 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+)
+
+const testProvider = "idp"
+
+// fakeIdP is upstream openid connect provider logging in the user with the claims set by the test.
+type fakeIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	claims jwt.MapClaims
+	// nonce overrides the nonce of the authorization request in id token if set
+	nonce  string
+	codes  map[string]string
+	issued int
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	idp := fakeIdP{
+		key:   key,
+		codes: make(map[string]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(DiscoveryPath, idp.discovery)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	return &idp
+}
+
+func (idp *fakeIdP) config(cfg ProviderConfig) ProviderConfig {
+	cfg.Name = testProvider
+	cfg.Issuer = idp.URL
+	cfg.ClientID = "upstream-client"
+	return cfg
+}
+
+// login sets claims of the user logging in next.
+func (idp *fakeIdP) login(claims jwt.MapClaims) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.claims = claims
+}
+
+func (idp *fakeIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, providerMetadata{
+		Issuer:                idp.URL,
+		AuthorizationEndpoint: idp.URL + "/authorize",
+		TokenEndpoint:         idp.URL + "/token",
+		JWKSURI:               idp.URL + "/jwks",
+	})
+}
+
+func (idp *fakeIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize logs the user in at once and redirects back with the code.
+func (idp *fakeIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	idp.issued++
+	code := "code-" + strconv.Itoa(idp.issued)
+	idp.codes[code] = r.URL.Query().Get("nonce")
+	idp.mu.Unlock()
+
+	u, _ := url.Parse(r.URL.Query().Get("redirect_uri"))
+	u.RawQuery = url.Values{
+		"code":  {code},
+		"state": {r.URL.Query().Get("state")},
+	}.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func (idp *fakeIdP) token(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	nonce, ok := idp.codes[r.FormValue("code")]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_grant", "")
+		return
+	}
+	delete(idp.codes, r.FormValue("code"))
+
+	if idp.nonce != "" {
+		nonce = idp.nonce
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   idp.URL,
+		"aud":   "upstream-client",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": nonce,
+	}
+	for k, v := range idp.claims {
+		claims[k] = v
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = "test"
+	idToken, err := t.SignedString(idp.key)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"id_token": idToken,
+	})
+}
+
+// federatedLogin starts authorization request logging in with the fake provider and returns response of the callback.
+func federatedLogin(t *testing.T, ts *testServer, client *db.OAuthClient) *http.Response {
+	t.Helper()
+
+	params := authorizeParams(client, ScopeStorageRead, "xyz")
+	authorizeURL := ts.URL + "/oauth/authorize"
+
+	b := ts.browser(t)
+	csrf := openPage(t, b, authorizeURL+"?"+params.Encode())
+
+	rsp := postForm(t, b, authorizeURL, withValues(params, "csrf_token", csrf, "action", federateActionPrefix+testProvider))
+	if rsp.StatusCode != http.StatusFound {
+		t.Fatalf("federate: status %d, want redirect", rsp.StatusCode)
+	}
+
+	// redirect to the provider and back to the callback
+	next := rsp.Header.Get("Location")
+	for i := 0; i < 2; i++ {
+		rsp, err := b.Get(next)
+		if err != nil {
+			t.Fatalf("get %s: %v", next, err)
+		}
+		rsp.Body.Close()
+
+		if i == 1 {
+			return rsp
+		}
+
+		if rsp.StatusCode != http.StatusFound {
+			t.Fatalf("get %s: status %d, want redirect", next, rsp.StatusCode)
+		}
+		next = rsp.Header.Get("Location")
+	}
+	return nil
+}
+
+// federatedUserID returns id of the user the subject of the fake provider is linked to.
+func federatedUserID(t *testing.T, ts *testServer, subject string) int64 {
+	t.Helper()
+
+	identity, err := ts.m.GetIdentity(context.Background(), testProvider, subject)
+	if err != nil {
+		t.Fatalf("get identity %s: %v", subject, err)
+	}
+	return identity.UserID
+}
+
+func checkRedirectWithCode(t *testing.T, rsp *http.Response) {
+	t.Helper()
+
+	if rsp.StatusCode != http.StatusFound {
+		t.Fatalf("callback: status %d, want redirect", rsp.StatusCode)
+	}
+
+	location, err := url.Parse(rsp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("parse redirect: %v", err)
+	}
+
+	if location.Query().Get("code") == "" || location.Query().Get("state") != "xyz" {
+		t.Errorf("redirect %s, want code and state", location)
+	}
+}
+
+func TestFederationProvisionsUser(t *testing.T) {
+	idp := newFakeIdP(t)
+	ts := newTestServer(t, Config{Providers: []ProviderConfig{idp.config(ProviderConfig{AutoProvision: true})}})
+	client := ts.createClient(t, ScopeStorageRead)
+
+	idp.login(jwt.MapClaims{
+		"sub":                "1",
+		"preferred_username": "Alice",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+	})
+	checkRedirectWithCode(t, federatedLogin(t, ts, client))
+
+	user, err := ts.m.GetByName(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("get provisioned user: %v", err)
+	}
+
+	if user.Pwd.Valid || len(user.Emails) != 1 || user.Emails[0] != (db.Email{Email: "alice@example.com", Primary: true, Verified: true}) {
+		t.Errorf("provisioned user %+v", user)
+	}
+
+	if id := federatedUserID(t, ts, "1"); id != user.ID {
+		t.Errorf("identity is linked to user %d, want %d", id, user.ID)
+	}
+
+	// the next login finds the identity
+	idp.login(jwt.MapClaims{
+		"sub":                "1",
+		"preferred_username": "alice-renamed",
+	})
+	checkRedirectWithCode(t, federatedLogin(t, ts, client))
+
+	if _, err := ts.m.GetByName(context.Background(), "alice-renamed"); err == nil {
+		t.Error("user is provisioned again")
+	}
+}
+
+func TestFederationUsernameCollision(t *testing.T) {
+	idp := newFakeIdP(t)
+	ts := newTestServer(t, Config{Providers: []ProviderConfig{idp.config(ProviderConfig{AutoProvision: true})}})
+	client := ts.createClient(t, ScopeStorageRead)
+	ts.createUser(t, "alice", "secret", db.Email{Email: "alice@example.com", Primary: true, Verified: true})
+	ts.createUser(t, "alice-2", "secret")
+
+	idp.login(jwt.MapClaims{
+		"sub":                "1",
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+	})
+	checkRedirectWithCode(t, federatedLogin(t, ts, client))
+
+	user, err := ts.m.GetByName(context.Background(), "alice-3")
+	if err != nil {
+		t.Fatalf("get provisioned user: %v", err)
+	}
+
+	// the email belongs to the local user, linking by email is disabled
+	if len(user.Emails) != 0 {
+		t.Errorf("provisioned user has emails %+v", user.Emails)
+	}
+
+	if id := federatedUserID(t, ts, "1"); id != user.ID {
+		t.Errorf("identity is linked to user %d, want %d", id, user.ID)
+	}
+}
+
+func TestFederationLinksByEmail(t *testing.T) {
+	idp := newFakeIdP(t)
+	ts := newTestServer(t, Config{Providers: []ProviderConfig{idp.config(ProviderConfig{LinkByEmail: true})}})
+	client := ts.createClient(t, ScopeStorageRead)
+	bob := ts.createUser(t, "bob", "secret", db.Email{Email: "bob@example.com", Primary: true, Verified: true})
+	ts.createUser(t, "carol", "secret", db.Email{Email: "carol@example.com", Primary: true})
+
+	t.Run("verified email", func(t *testing.T) {
+		idp.login(jwt.MapClaims{
+			"sub":            "1",
+			"email":          "bob@example.com",
+			"email_verified": true,
+		})
+		checkRedirectWithCode(t, federatedLogin(t, ts, client))
+
+		if id := federatedUserID(t, ts, "1"); id != bob.ID {
+			t.Errorf("identity is linked to user %d, want %d", id, bob.ID)
+		}
+	})
+
+	for _, tc := range []struct {
+		name   string
+		claims jwt.MapClaims
+	}{
+		{"unverified upstream email", jwt.MapClaims{"sub": "2", "email": "bob@example.com"}},
+		{"unverified local email", jwt.MapClaims{"sub": "3", "email": "carol@example.com", "email_verified": true}},
+		{"unknown email", jwt.MapClaims{"sub": "4", "email": "dave@example.com", "email_verified": true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			idp.login(tc.claims)
+			if rsp := federatedLogin(t, ts, client); rsp.StatusCode != http.StatusForbidden {
+				t.Errorf("callback: status %d, want %d", rsp.StatusCode, http.StatusForbidden)
+			}
+		})
+	}
+}
+
+func TestFederationRejectsNonceMismatch(t *testing.T) {
+	idp := newFakeIdP(t)
+	ts := newTestServer(t, Config{Providers: []ProviderConfig{idp.config(ProviderConfig{AutoProvision: true})}})
+	client := ts.createClient(t, ScopeStorageRead)
+
+	idp.login(jwt.MapClaims{"sub": "1", "preferred_username": "alice"})
+	idp.nonce = "replayed"
+
+	if rsp := federatedLogin(t, ts, client); rsp.StatusCode != http.StatusBadGateway {
+		t.Errorf("callback: status %d, want %d", rsp.StatusCode, http.StatusBadGateway)
+	}
+
+	if _, err := ts.m.GetByName(context.Background(), "alice"); err == nil {
+		t.Error("user is provisioned")
+	}
+}
+
+func TestFederationRejectsLongSubject(t *testing.T) {
+	idp := newFakeIdP(t)
+	ts := newTestServer(t, Config{Providers: []ProviderConfig{idp.config(ProviderConfig{AutoProvision: true})}})
+	client := ts.createClient(t, ScopeStorageRead)
+
+	idp.login(jwt.MapClaims{"sub": strings.Repeat("1", db.MaxIdentitySubjectLength+1), "preferred_username": "alice"})
+
+	if rsp := federatedLogin(t, ts, client); rsp.StatusCode != http.StatusBadGateway {
+		t.Errorf("callback: status %d, want %d", rsp.StatusCode, http.StatusBadGateway)
+	}
+
+	if _, err := ts.m.GetByName(context.Background(), "alice"); err == nil {
+		t.Error("user is provisioned")
+	}
+}
+
+func TestFederationIgnoresLongEmail(t *testing.T) {
+	idp := newFakeIdP(t)
+	ts := newTestServer(t, Config{Providers: []ProviderConfig{idp.config(ProviderConfig{AutoProvision: true})}})
+	client := ts.createClient(t, ScopeStorageRead)
+
+	idp.login(jwt.MapClaims{
+		"sub":                "1",
+		"preferred_username": "alice",
+		"email":              strings.Repeat("a", db.MaxEmailLength) + "@example.com",
+		"email_verified":     true,
+	})
+	checkRedirectWithCode(t, federatedLogin(t, ts, client))
+
+	user, err := ts.m.GetByName(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("get provisioned user: %v", err)
+	}
+
+	if len(user.Emails) != 0 {
+		t.Errorf("provisioned user has emails %+v", user.Emails)
+	}
+}
+
+func TestFederationCallbackRequiresState(t *testing.T) {
+	idp := newFakeIdP(t)
+	ts := newTestServer(t, Config{Providers: []ProviderConfig{idp.config(ProviderConfig{AutoProvision: true})}})
+	client := ts.createClient(t, ScopeStorageRead)
+	idp.login(jwt.MapClaims{"sub": "1", "preferred_username": "alice"})
+
+	params := authorizeParams(client, ScopeStorageRead, "xyz")
+	authorizeURL := ts.URL + "/oauth/authorize"
+	callbackURL := ts.URL + federationCallbackPath
+
+	b := ts.browser(t)
+	csrf := openPage(t, b, authorizeURL+"?"+params.Encode())
+	if rsp := postForm(t, b, authorizeURL, withValues(params, "csrf_token", csrf, "action", federateActionPrefix+testProvider)); rsp.StatusCode != http.StatusFound {
+		t.Fatalf("federate: status %d, want redirect", rsp.StatusCode)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		browser *http.Client
+	}{
+		{"other browser", ts.browser(t)},
+		{"forged state", b},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rsp, err := tc.browser.Get(callbackURL + "?code=code-1&state=forged")
+			if err != nil {
+				t.Fatalf("callback: %v", err)
+			}
+			rsp.Body.Close()
+
+			if rsp.StatusCode != http.StatusBadRequest {
+				t.Errorf("callback: status %d, want %d", rsp.StatusCode, http.StatusBadRequest)
+			}
+		})
+	}
+
+	if _, err := ts.m.GetByName(context.Background(), "alice"); err == nil {
+		t.Error("user is provisioned")
+	}
+}
@@ -0,0 +1,208 @@
+package oauth
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+)
+
+type discoveryResponse struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	RegistrationEndpoint              string   `json:"registration_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+type jwksResponse struct {
+	Keys []token.JWK `json:"keys"`
+}
+
+// userinfoResponse holds standard claims of the user, see OpenID Connect Core section 5.1.
+type userinfoResponse struct {
+	Subject       string `json:"sub"`
+	Name          string `json:"name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	scopes := make([]string, 0, len(supportedScopes))
+	for scope := range supportedScopes {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+
+	writeJSON(w, http.StatusOK, discoveryResponse{
+		Issuer:                            s.issuer,
+		AuthorizationEndpoint:             s.issuer + "/oauth/authorize",
+		TokenEndpoint:                     s.issuer + "/oauth/token",
+		UserinfoEndpoint:                  s.issuer + "/oauth/userinfo",
+		JWKSURI:                           s.issuer + "/oauth/jwks",
+		RegistrationEndpoint:              s.issuer + "/oauth/clients",
+		ScopesSupported:                   scopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{s.encoder.JWK().Alg},
+		TokenEndpointAuthMethodsSupported: []string{authMethodBasic, authMethodPost, authMethodNone},
+		CodeChallengeMethodsSupported:     []string{codeChallengeMethodS256},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "nonce", "name", "email", "email_verified"},
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, jwksResponse{
+		Keys: []token.JWK{s.encoder.JWK()},
+	})
+}
+
+// primaryEmail returns primary email of the user, or the first one if none is marked primary.
+func primaryEmail(user *db.User) (db.Email, bool) {
+	for _, e := range user.Emails {
+		if e.Primary {
+			return e, true
+		}
+	}
+
+	if len(user.Emails) > 0 {
+		return user.Emails[0], true
+	}
+	return db.Email{}, false
+}
+
+// userClaims returns claims of the user released for the granted scopes.
+func userClaims(user *db.User, scopes []string) userinfoResponse {
+	claims := userinfoResponse{
+		Subject: strconv.FormatInt(user.ID, 10),
+	}
+
+	for _, scope := range scopes {
+		switch scope {
+		case ScopeProfile:
+			claims.Name = user.Name
+
+		case ScopeEmail:
+			if e, ok := primaryEmail(user); ok {
+				verified := e.Verified
+				claims.Email = e.Email
+				claims.EmailVerified = &verified
+			}
+		}
+	}
+
+	return claims
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// issueIDToken returns id token of the user for the client.
+func (s *Server) issueIDToken(user *db.User, client *db.OAuthClient, code *db.OAuthCode) (string, error) {
+	claims := userClaims(user, strings.Fields(code.Scope))
+
+	idClaims := token.IDTokenClaims{
+		Nonce:         code.Nonce,
+		Name:          claims.Name,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+	}
+	idClaims.Issuer = s.issuer
+	idClaims.Subject = claims.Subject
+	idClaims.Audience = client.ID
+
+	return s.encoder.EncodeIDToken(idClaims)
+}
+
+func writeBearerError(w http.ResponseWriter, code int, errCode string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="`+errCode+`"`)
+	writeError(w, code, errCode, "")
+}
+
+var errInvalidToken = errors.New("invalid token")
+
+// authenticateToken returns claims of the bearer access token issued to oauth client, session of the token must be active.
+func (s *Server) authenticateToken(r *http.Request) (*token.CustomClaims, error) {
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, prefix) {
+		return nil, errInvalidToken
+	}
+
+	claims, err := s.decoder.Decode(strings.TrimPrefix(header, prefix))
+	if err != nil || claims.ClientID == "" || claims.SessionID == "" {
+		return nil, errInvalidToken
+	}
+
+	session, err := s.repo.GetSession(r.Context(), claims.SessionID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			return nil, errInvalidToken
+		}
+		return nil, err
+	}
+
+	if session.IsRevoked() || session.UserID != claims.User.ID {
+		return nil, errInvalidToken
+	}
+
+	return claims, nil
+}
+
+func (s *Server) userinfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request", "method not allowed")
+		return
+	}
+
+	claims, err := s.authenticateToken(r)
+	if err != nil {
+		if errors.Is(err, errInvalidToken) {
+			writeBearerError(w, http.StatusUnauthorized, "invalid_token")
+			return
+		}
+		s.l.Errorf("authenticate token error: %v", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	scopes := strings.Fields(claims.Scope)
+	if !hasScope(scopes, ScopeOpenID) {
+		writeBearerError(w, http.StatusForbidden, "insufficient_scope")
+		return
+	}
+
+	user, err := s.users.GetByID(r.Context(), claims.User.ID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			writeBearerError(w, http.StatusUnauthorized, "invalid_token")
+			return
+		}
+		s.l.Errorf("get user error: %v", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, userClaims(user, scopes))
+}
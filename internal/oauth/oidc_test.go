@@ -0,0 +1,137 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+)
+
+// TestOpenIDConnectFlow runs the relying party the server uses for upstream providers against the server itself.
+func TestOpenIDConnectFlow(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	user := ts.createUser(t, "alice", "secret", db.Email{Email: "alice@example.com", Primary: true, Verified: true})
+	client := ts.createClient(t, ScopeOpenID, ScopeProfile, ScopeEmail)
+
+	ctx := context.Background()
+	rp := newProvider(ProviderConfig{
+		Name:     "self",
+		Issuer:   ts.URL,
+		ClientID: client.ID,
+	})
+
+	m, err := rp.discover(ctx)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	var discovery discoveryResponse
+	if err := rp.getJSON(ctx, ts.URL+DiscoveryPath, &discovery); err != nil {
+		t.Fatalf("discovery: %v", err)
+	}
+
+	authURL, err := rp.authURL(ctx, testRedirectURI, "xyz", "n-0S6_WzA2Mj", codeChallenge(testCodeVerifier))
+	if err != nil {
+		t.Fatalf("auth url: %v", err)
+	}
+
+	b := ts.browser(t)
+	csrf := openPage(t, b, authURL)
+
+	u, _ := url.Parse(authURL)
+	rsp := postForm(t, b, m.AuthorizationEndpoint, withValues(u.Query(), "csrf_token", csrf, "action", "approve", "name", "alice", "password", "secret"))
+	if rsp.StatusCode != http.StatusFound {
+		t.Fatalf("approve: status %d, want redirect", rsp.StatusCode)
+	}
+
+	location, err := url.Parse(rsp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("parse redirect: %v", err)
+	}
+
+	// the code is redeemed here rather than by rp.exchange to keep the access token
+	tokenRsp, err := http.PostForm(m.TokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {client.ID},
+		"code":          {location.Query().Get("code")},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testCodeVerifier},
+	})
+	if err != nil {
+		t.Fatalf("token request: %v", err)
+	}
+	defer tokenRsp.Body.Close()
+
+	if tokenRsp.StatusCode != http.StatusOK {
+		t.Fatalf("token request: status %d", tokenRsp.StatusCode)
+	}
+
+	var tokens tokenResponse
+	if err := json.NewDecoder(tokenRsp.Body).Decode(&tokens); err != nil {
+		t.Fatalf("decode token response: %v", err)
+	}
+
+	t.Run("id token", func(t *testing.T) {
+		if _, err := rp.verifyIDToken(ctx, tokens.IDToken, "other nonce"); err == nil {
+			t.Error("id token with other nonce is verified")
+		}
+
+		claims, err := rp.verifyIDToken(ctx, tokens.IDToken, "n-0S6_WzA2Mj")
+		if err != nil {
+			t.Fatalf("verify id token: %v", err)
+		}
+
+		if claims.Subject != strconv.FormatInt(user.ID, 10) || claims.Email != "alice@example.com" || !claims.EmailVerified {
+			t.Errorf("id token claims %+v", claims)
+		}
+	})
+
+	t.Run("id token is not access token", func(t *testing.T) {
+		if _, err := ts.decoder.Decode(tokens.IDToken); err == nil {
+			t.Error("id token is decoded as access token")
+		}
+
+		if code, _ := getUserinfo(t, discovery.UserinfoEndpoint, tokens.IDToken); code != http.StatusUnauthorized {
+			t.Errorf("userinfo with id token: status %d, want %d", code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("userinfo", func(t *testing.T) {
+		code, info := getUserinfo(t, discovery.UserinfoEndpoint, tokens.AccessToken)
+		if code != http.StatusOK {
+			t.Fatalf("userinfo: status %d", code)
+		}
+
+		if info.Subject != strconv.FormatInt(user.ID, 10) || info.Name != "alice" || info.Email != "alice@example.com" {
+			t.Errorf("userinfo %+v", info)
+		}
+	})
+}
+
+func getUserinfo(t *testing.T, endpoint string, accessToken string) (int, userinfoResponse) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		t.Fatalf("userinfo request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("userinfo request: %v", err)
+	}
+	defer rsp.Body.Close()
+
+	var info userinfoResponse
+	if rsp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(rsp.Body).Decode(&info); err != nil {
+			t.Fatalf("decode userinfo: %v", err)
+		}
+	}
+	return rsp.StatusCode, info
+}
@@ -0,0 +1,262 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/throttle"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+)
+
+const defaultCodeTTL = time.Minute
+
+// Scopes which can be granted to clients.
+const (
+	ScopeStorageRead  = token.ScopeStorageRead
+	ScopeStorageWrite = token.ScopeStorageWrite
+
+	// openid connect scopes, openid makes token response include id token.
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+var supportedScopes = map[string]bool{
+	ScopeStorageRead:  true,
+	ScopeStorageWrite: true,
+	ScopeOpenID:       true,
+	ScopeProfile:      true,
+	ScopeEmail:        true,
+}
+
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// Issuer is the external base url of the service, endpoints advertised by openid connect discovery are relative to it.
+	Issuer string `yaml:"issuer"`
+	// RegistrationToken is the bearer token required to register clients.
+	RegistrationToken string           `yaml:"registration_token"`
+	CodeTTLSec        int              `yaml:"code_ttl"`
+	Providers         []ProviderConfig `yaml:"providers"`
+	// DeviceCodeTTLSec and DevicePollIntervalSec configure device authorization, the page approving devices is served by the server.
+	DeviceCodeTTLSec      int `yaml:"device_code_ttl"`
+	DevicePollIntervalSec int `yaml:"device_poll_interval"`
+}
+
+// Authenticator checks password of the user the way Auth does, failures are audited and counted by the login throttle.
+// Errors are httperror errors, rejected credentials are reported by not found, not match and already exist codes.
+type Authenticator interface {
+	Authenticate(ctx context.Context, name string, password string) (*db.User, error)
+}
+
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+type userStorager interface {
+	GetByID(ctx context.Context, id int64) (*db.User, error)
+	GetByName(ctx context.Context, name string) (*db.User, error)
+	GetByEmail(ctx context.Context, email string) (*db.User, error)
+	Create(ctx context.Context, u *db.User) error
+}
+
+type storager interface {
+	CreateOAuthClient(ctx context.Context, c *db.OAuthClient) error
+	GetOAuthClient(ctx context.Context, id string) (*db.OAuthClient, error)
+	CreateOAuthCode(ctx context.Context, c *db.OAuthCode) error
+	ConsumeOAuthCode(ctx context.Context, codeHash string) (*db.OAuthCode, error)
+	SaveOAuthGrant(ctx context.Context, g *db.OAuthGrant) error
+	CreateSession(ctx context.Context, s *db.Session) error
+	GetSession(ctx context.Context, id string) (*db.Session, error)
+	CreateIdentity(ctx context.Context, i *db.Identity) error
+	GetIdentity(ctx context.Context, provider string, subject string) (*db.Identity, error)
+	TouchIdentity(ctx context.Context, provider string, subject string) error
+	GetDeviceCodeByUserCode(ctx context.Context, userCode string) (*db.DeviceCode, error)
+	DecideDeviceCode(ctx context.Context, userCode string, userID int64, status string) error
+	AddAuditEvent(ctx context.Context, e *db.AuditEvent) error
+}
+
+type tokenEncoder interface {
+	token.Encoder
+	token.IDTokenEncoder
+	token.Signer
+}
+
+type tokenDecoder interface {
+	token.Decoder
+	token.Verifier
+}
+
+// Server is the oauth 2.0 authorization server issuing service tokens to registered clients
+// by authorization code flow with PKCE, it is also openid connect provider for them.
+type Server struct {
+	l                 Logger
+	users             userStorager
+	repo              storager
+	encoder           tokenEncoder
+	decoder           tokenDecoder
+	issuer            string
+	providers         map[string]*provider
+	providerOrder     []string
+	registrationToken string
+	codeTTL           time.Duration
+	tokenTTL          time.Duration
+	loginThrottle     *throttle.Limiter
+	userCodeThrottle  *throttle.Limiter
+	authenticator     Authenticator
+}
+
+type Option func(s *Server)
+
+// WithLoginThrottle sets limiter locking user names out for the client address after failed logins on the server pages,
+// it is shared with Auth so failures are counted together. Logins aren't limited without it.
+func WithLoginThrottle(l *throttle.Limiter) Option {
+	return func(s *Server) {
+		s.loginThrottle = l
+	}
+}
+
+// WithUserCodeThrottle sets limiter locking client addresses out after invalid user codes entered on the device page.
+func WithUserCodeThrottle(l *throttle.Limiter) Option {
+	return func(s *Server) {
+		s.userCodeThrottle = l
+	}
+}
+
+// WithAuthenticator sets authenticator of users logging in on the server pages, so users of the directory can log in as well.
+// Only local passwords are checked without it.
+func WithAuthenticator(a Authenticator) Option {
+	return func(s *Server) {
+		s.authenticator = a
+	}
+}
+
+func NewServer(l Logger, cfg Config, users userStorager, repo storager, encoder tokenEncoder, decoder tokenDecoder, tokenTTL time.Duration, opts ...Option) (*Server, error) {
+	if cfg.RegistrationToken == "" {
+		return nil, errors.New("registration token is required")
+	}
+
+	issuer, err := url.Parse(cfg.Issuer)
+	if err != nil || !issuer.IsAbs() || issuer.RawQuery != "" || issuer.Fragment != "" {
+		return nil, fmt.Errorf("invalid issuer: %q", cfg.Issuer)
+	}
+
+	providers := make(map[string]*provider, len(cfg.Providers))
+	providerOrder := make([]string, 0, len(cfg.Providers))
+	for _, pc := range cfg.Providers {
+		if err := pc.validate(); err != nil {
+			return nil, err
+		}
+
+		if _, ok := providers[pc.Name]; ok {
+			return nil, fmt.Errorf("duplicate provider: %s", pc.Name)
+		}
+		providers[pc.Name] = newProvider(pc)
+		providerOrder = append(providerOrder, pc.Name)
+	}
+
+	codeTTL := time.Duration(cfg.CodeTTLSec) * time.Second
+	if codeTTL <= 0 {
+		codeTTL = defaultCodeTTL
+	}
+
+	s := Server{
+		l:                 l,
+		users:             users,
+		repo:              repo,
+		encoder:           encoder,
+		decoder:           decoder,
+		issuer:            strings.TrimSuffix(cfg.Issuer, "/"),
+		providers:         providers,
+		providerOrder:     providerOrder,
+		registrationToken: cfg.RegistrationToken,
+		codeTTL:           codeTTL,
+		tokenTTL:          tokenTTL,
+		loginThrottle:     throttle.NewLimiter(0, throttle.DefaultWindow),
+		userCodeThrottle:  throttle.NewLimiter(defaultUserCodeMaxFailures, throttle.DefaultWindow),
+	}
+
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	return &s, nil
+}
+
+// DiscoveryPath is the path of openid connect discovery document relative to the issuer.
+const DiscoveryPath = "/.well-known/openid-configuration"
+
+// Handler serves oauth endpoints under /oauth/ and DiscoveryPath.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/clients", s.register)
+	mux.HandleFunc("/oauth/authorize", s.authorize)
+	mux.HandleFunc("/oauth/token", s.token)
+	mux.HandleFunc("/oauth/userinfo", s.userinfo)
+	mux.HandleFunc("/oauth/jwks", s.jwks)
+	mux.HandleFunc(federationCallbackPath, s.federationCallback)
+	mux.HandleFunc(devicePath, s.device)
+	mux.HandleFunc(DiscoveryPath, s.discovery)
+	return mux
+}
+
+// errorResponse is the error body of json endpoints, see RFC 6749 section 5.2.
+type errorResponse struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, rsp interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(rsp)
+}
+
+func writeError(w http.ResponseWriter, code int, errCode string, description string) {
+	writeJSON(w, code, errorResponse{
+		Error:       errCode,
+		Description: description,
+	})
+}
+
+// audit records event with client info taken from r.
+func (s *Server) audit(r *http.Request, e db.AuditEvent) error {
+	e.ClientIP, e.UserAgent = shared.ClientInfo(r)
+	return s.repo.AddAuditEvent(r.Context(), &e)
+}
+
+// parseScope splits space separated scope and checks that every scope is supported.
+func parseScope(scope string) ([]string, bool) {
+	scopes := strings.Fields(scope)
+	for _, s := range scopes {
+		if !supportedScopes[s] {
+			return nil, false
+		}
+	}
+	return scopes, true
+}
+
+// containsAll reports whether every scope of requested is in allowed.
+func containsAll(allowed []string, requested []string) bool {
+	set := make(map[string]bool, len(allowed))
+	for _, s := range allowed {
+		set[s] = true
+	}
+
+	for _, s := range requested {
+		if !set[s] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,206 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+)
+
+const (
+	testRedirectURI  = "http://127.0.0.1/callback"
+	testCodeVerifier = "0123456789012345678901234567890123456789012345678901234567890123"
+)
+
+type testLogger struct {
+	t *testing.T
+}
+
+func (l testLogger) Infof(format string, args ...interface{}) {
+	l.t.Logf(format, args...)
+}
+
+func (l testLogger) Errorf(format string, args ...interface{}) {
+	l.t.Logf("ERROR: "+format, args...)
+}
+
+type testServer struct {
+	*httptest.Server
+	s       *Server
+	m       *db.Memory
+	encoder *token.RSAEncoder
+	decoder *token.RSADecoder
+}
+
+// newTestServer serves oauth server with memory storage, cfg is completed with issuer and registration token.
+func newTestServer(t *testing.T, cfg Config, opts ...Option) *testServer {
+	t.Helper()
+
+	encoder, err := token.NewRSAEncoder(time.Minute)
+	if err != nil {
+		t.Fatalf("create encoder: %v", err)
+	}
+
+	decoder, err := token.NewRSADecoder()
+	if err != nil {
+		t.Fatalf("create decoder: %v", err)
+	}
+
+	var handler http.Handler
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	cfg.Issuer = ts.URL
+	cfg.RegistrationToken = "registration"
+
+	m := db.NewMemory()
+	s, err := NewServer(testLogger{t}, cfg, m, m, encoder, decoder, time.Minute, opts...)
+	if err != nil {
+		t.Fatalf("create server: %v", err)
+	}
+	handler = s.Handler()
+
+	return &testServer{
+		Server:  ts,
+		s:       s,
+		m:       m,
+		encoder: encoder,
+		decoder: decoder,
+	}
+}
+
+func (ts *testServer) createUser(t *testing.T, name string, password string, emails ...db.Email) *db.User {
+	t.Helper()
+
+	u := db.User{
+		Name:   name,
+		Emails: emails,
+	}
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatalf("hash password: %v", err)
+		}
+		u.Pwd = sql.NullString{String: string(hash), Valid: true}
+	}
+
+	if err := ts.m.Create(context.Background(), &u); err != nil {
+		t.Fatalf("create user %s: %v", name, err)
+	}
+	return &u
+}
+
+func (ts *testServer) createClient(t *testing.T, scopes ...string) *db.OAuthClient {
+	t.Helper()
+
+	c := db.OAuthClient{
+		ID:           "client",
+		AuthMethod:   authMethodNone,
+		Name:         "Test client",
+		RedirectURIs: []string{testRedirectURI},
+		Scopes:       scopes,
+	}
+	if err := ts.m.CreateOAuthClient(context.Background(), &c); err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	return &c
+}
+
+// browser returns http client keeping cookies and not following redirects.
+func (ts *testServer) browser(t *testing.T) *http.Client {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("create cookie jar: %v", err)
+	}
+
+	return &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authorizeParams returns parameters of the authorization request of the client.
+func authorizeParams(client *db.OAuthClient, scope string, state string) url.Values {
+	return url.Values{
+		"client_id":             {client.ID},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {"code"},
+		"scope":                 {scope},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge(testCodeVerifier)},
+		"code_challenge_method": {codeChallengeMethodS256},
+		"nonce":                 {"nonce-" + state},
+	}
+}
+
+var csrfTokenRe = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// openPage gets the page and returns csrf token of its form.
+func openPage(t *testing.T, c *http.Client, pageURL string) string {
+	t.Helper()
+
+	rsp, err := c.Get(pageURL)
+	if err != nil {
+		t.Fatalf("get %s: %v", pageURL, err)
+	}
+	defer rsp.Body.Close()
+
+	body, _ := io.ReadAll(rsp.Body)
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("get %s: status %d: %s", pageURL, rsp.StatusCode, body)
+	}
+
+	m := csrfTokenRe.FindSubmatch(body)
+	if m == nil {
+		t.Fatalf("no csrf token on %s", pageURL)
+	}
+	return string(m[1])
+}
+
+func postForm(t *testing.T, c *http.Client, pageURL string, form url.Values) *http.Response {
+	t.Helper()
+
+	rsp, err := c.Post(pageURL, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatalf("post %s: %v", pageURL, err)
+	}
+	io.Copy(io.Discard, rsp.Body)
+	rsp.Body.Close()
+	return rsp
+}
+
+func withValues(v url.Values, kv ...string) url.Values {
+	merged := url.Values{}
+	for k, vv := range v {
+		merged[k] = vv
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		merged.Set(kv[i], kv[i+1])
+	}
+	return merged
+}
@@ -0,0 +1,217 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+)
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+// verifyCodeChallenge checks PKCE code verifier against S256 challenge, see RFC 7636 section 4.6.
+func verifyCodeChallenge(challenge string, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+var errInvalidClient = errors.New("invalid client")
+
+// clientCredentials returns client id, secret and the auth method the client used from basic auth or request body.
+// Clients must not use more than one method, see RFC 6749 section 2.3.
+func clientCredentials(r *http.Request) (string, string, string, error) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		if r.PostForm.Get("client_secret") != "" {
+			return "", "", "", errInvalidClient
+		}
+
+		// basic auth credentials are form url encoded, see RFC 6749 section 2.3.1
+		id, err := url.QueryUnescape(id)
+		if err != nil {
+			return "", "", "", err
+		}
+
+		secret, err = url.QueryUnescape(secret)
+		if err != nil {
+			return "", "", "", err
+		}
+		return id, secret, authMethodBasic, nil
+	}
+
+	if secret := r.PostForm.Get("client_secret"); secret != "" {
+		return r.PostForm.Get("client_id"), secret, authMethodPost, nil
+	}
+	return r.PostForm.Get("client_id"), "", authMethodNone, nil
+}
+
+// authenticateClient returns client of the request, clients must authenticate by the method they registered
+// and confidential clients must present the secret.
+func (s *Server) authenticateClient(r *http.Request) (*db.OAuthClient, error) {
+	id, secret, method, err := clientCredentials(r)
+	if err != nil || id == "" {
+		return nil, errInvalidClient
+	}
+
+	client, err := s.repo.GetOAuthClient(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			return nil, errInvalidClient
+		}
+		return nil, err
+	}
+
+	if method != client.AuthMethod {
+		return nil, errInvalidClient
+	}
+
+	if client.SecretHash == "" {
+		if secret != "" {
+			return nil, errInvalidClient
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(shared.HashSecret(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, errInvalidClient
+	}
+
+	return client, nil
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request", "method not allowed")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid form")
+		return
+	}
+
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		if errors.Is(err, errInvalidClient) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+			writeError(w, http.StatusUnauthorized, "invalid_client", "")
+			return
+		}
+		s.l.Errorf("authenticate oauth client error: %v", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	if grantType := r.PostForm.Get("grant_type"); grantType != "authorization_code" {
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	code, err := s.repo.ConsumeOAuthCode(r.Context(), shared.HashSecret(r.PostForm.Get("code")))
+	if err != nil {
+		if errors.Is(err, db.ErrNotExist) {
+			writeError(w, http.StatusBadRequest, "invalid_grant", "invalid authorization code")
+			return
+		}
+		s.l.Errorf("consume oauth code error: %v", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	if code.ClientID != client.ID || time.Now().After(code.ExpiresAt) {
+		writeError(w, http.StatusBadRequest, "invalid_grant", "invalid authorization code")
+		return
+	}
+
+	if code.RedirectURI != r.PostForm.Get("redirect_uri") {
+		writeError(w, http.StatusBadRequest, "invalid_grant", "redirect uri mismatch")
+		return
+	}
+
+	if !verifyCodeChallenge(code.CodeChallenge, r.PostForm.Get("code_verifier")) {
+		writeError(w, http.StatusBadRequest, "invalid_grant", "invalid code verifier")
+		return
+	}
+
+	rsp, err := s.issueToken(r, client, code)
+	if err != nil {
+		s.l.Errorf("issue oauth token error: %v", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rsp)
+}
+
+// issueToken starts session of the client on behalf of the user and returns token limited to the granted scope,
+// id token is issued as well when openid scope is granted.
+func (s *Server) issueToken(r *http.Request, client *db.OAuthClient, code *db.OAuthCode) (*tokenResponse, error) {
+	user, err := s.users.GetByID(r.Context(), code.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+
+	session := db.Session{
+		UserID: user.ID,
+	}
+	session.ClientIP, _ = shared.ClientInfo(r)
+	session.UserAgent = "oauth: " + client.Name
+
+	if err := s.repo.CreateSession(r.Context(), &session); err != nil {
+		return nil, fmt.Errorf("create session: %w", err)
+	}
+
+	accessToken, err := s.encoder.Encode(token.User{
+		ID:     user.ID,
+		Name:   user.Name,
+		Public: user.Public,
+	}, token.WithSessionID(session.ID), token.WithScope(client.ID, code.Scope))
+	if err != nil {
+		return nil, fmt.Errorf("encode token: %w", err)
+	}
+
+	rsp := tokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.tokenTTL.Seconds()),
+		Scope:       code.Scope,
+	}
+
+	if hasScope(strings.Fields(code.Scope), ScopeOpenID) {
+		rsp.IDToken, err = s.issueIDToken(user, client, code)
+		if err != nil {
+			return nil, fmt.Errorf("encode id token: %w", err)
+		}
+	}
+
+	if err := s.audit(r, db.AuditEvent{
+		Type:     db.AuditOAuthToken,
+		UserID:   user.ID,
+		UserName: user.Name,
+		Details:  fmt.Sprintf("client %s session %s scope %q", client.ID, session.ID, code.Scope),
+	}); err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+
+	return &rsp, nil
+}
@@ -0,0 +1,121 @@
+package oauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// registerClient registers client by the registration endpoint with the token endpoint auth method.
+func (ts *testServer) registerClient(t *testing.T, method string) registrationResponse {
+	t.Helper()
+
+	body, err := json.Marshal(registrationRequest{
+		ClientName:              "Test client",
+		RedirectURIs:            []string{testRedirectURI},
+		Scope:                   ScopeStorageRead,
+		TokenEndpointAuthMethod: method,
+	})
+	if err != nil {
+		t.Fatalf("marshal registration: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/oauth/clients", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("create registration request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer registration")
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("register client: %v", err)
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusCreated {
+		t.Fatalf("register client: status %d", rsp.StatusCode)
+	}
+
+	var registration registrationResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&registration); err != nil {
+		t.Fatalf("decode registration: %v", err)
+	}
+	return registration
+}
+
+func TestTokenEnforcesAuthMethod(t *testing.T) {
+	ts := newTestServer(t, Config{})
+	basic := ts.registerClient(t, "")
+	post := ts.registerClient(t, authMethodPost)
+	public := ts.registerClient(t, authMethodNone)
+
+	for _, c := range []registrationResponse{basic, post, public} {
+		stored, err := ts.m.GetOAuthClient(context.Background(), c.ClientID)
+		if err != nil {
+			t.Fatalf("get client: %v", err)
+		}
+
+		if stored.AuthMethod != c.TokenEndpointAuthMethod {
+			t.Errorf("client auth method %q, registered %q", stored.AuthMethod, c.TokenEndpointAuthMethod)
+		}
+	}
+
+	type credentials struct {
+		basicID, basicSecret string
+		form                 []string
+	}
+
+	for _, tc := range []struct {
+		name  string
+		creds credentials
+		valid bool
+	}{
+		{"basic", credentials{basicID: basic.ClientID, basicSecret: basic.ClientSecret}, true},
+		{"basic client by post", credentials{form: []string{"client_id", basic.ClientID, "client_secret", basic.ClientSecret}}, false},
+		{"basic client without secret", credentials{form: []string{"client_id", basic.ClientID}}, false},
+		{"post", credentials{form: []string{"client_id", post.ClientID, "client_secret", post.ClientSecret}}, true},
+		{"post client by basic", credentials{basicID: post.ClientID, basicSecret: post.ClientSecret}, false},
+		{"post client by both methods", credentials{basicID: post.ClientID, basicSecret: post.ClientSecret, form: []string{"client_secret", post.ClientSecret}}, false},
+		{"post client with wrong secret", credentials{form: []string{"client_id", post.ClientID, "client_secret", "wrong"}}, false},
+		{"public", credentials{form: []string{"client_id", public.ClientID}}, true},
+		{"public client by basic", credentials{basicID: public.ClientID}, false},
+		{"public client with secret", credentials{form: []string{"client_id", public.ClientID, "client_secret", "secret"}}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			form := withValues(url.Values{
+				"grant_type": {"authorization_code"},
+				"code":       {"unknown"},
+			}, tc.creds.form...)
+
+			req, err := http.NewRequest(http.MethodPost, ts.URL+"/oauth/token", strings.NewReader(form.Encode()))
+			if err != nil {
+				t.Fatalf("create token request: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tc.creds.basicID != "" {
+				req.SetBasicAuth(url.QueryEscape(tc.creds.basicID), url.QueryEscape(tc.creds.basicSecret))
+			}
+
+			rsp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("token request: %v", err)
+			}
+			rsp.Body.Close()
+
+			// authenticated client gets to the unknown code
+			want := http.StatusUnauthorized
+			if tc.valid {
+				want = http.StatusBadRequest
+			}
+
+			if rsp.StatusCode != want {
+				t.Errorf("status %d, want %d", rsp.StatusCode, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+)
+
+const (
+	upstreamTimeout = time.Second * 10
+	// jwksRefreshInterval limits refetching of provider keys on unknown key id.
+	jwksRefreshInterval = time.Minute
+	maxUpstreamResponse = 1 << 20
+)
+
+// Username policies of just-in-time provisioned users.
+const (
+	UsernamePreferred = "preferred_username"
+	UsernameEmail     = "email"
+	UsernameSubject   = "subject"
+)
+
+// ProviderConfig configures upstream openid connect provider users can log in with.
+type ProviderConfig struct {
+	// Name identifies the provider in identities, it must not change once users logged in.
+	Name         string   `yaml:"name"`
+	DisplayName  string   `yaml:"display_name"`
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+	// AutoProvision creates local user on the first login of unknown subject.
+	AutoProvision bool `yaml:"auto_provision"`
+	// UsernamePolicy selects claim the name of provisioned user is derived from:
+	// preferred_username (default), email (local part) or subject.
+	UsernamePolicy string `yaml:"username_policy"`
+	// LinkByEmail links unknown subject to existing user with the same email,
+	// both emails must be verified. Enable only for providers trusted to verify emails.
+	LinkByEmail bool `yaml:"link_by_email"`
+}
+
+func (c *ProviderConfig) validate() error {
+	if c.Name == "" || strings.ContainsAny(c.Name, "/ ") {
+		return fmt.Errorf("invalid provider name: %q", c.Name)
+	}
+
+	// identities of the directory are kept under its name
+	if c.Name == db.IdentityDirectory {
+		return fmt.Errorf("provider name %q is reserved", c.Name)
+	}
+
+	if u, err := url.Parse(c.Issuer); err != nil || !u.IsAbs() {
+		return fmt.Errorf("invalid issuer of provider %s: %q", c.Name, c.Issuer)
+	}
+
+	if c.ClientID == "" {
+		return fmt.Errorf("client_id of provider %s is required", c.Name)
+	}
+
+	switch c.UsernamePolicy {
+	case "", UsernamePreferred, UsernameEmail, UsernameSubject:
+	default:
+		return fmt.Errorf("invalid username_policy of provider %s: %q", c.Name, c.UsernamePolicy)
+	}
+
+	return nil
+}
+
+// upstreamClaims are claims of the upstream id token the service relies on.
+type upstreamClaims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+}
+
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// provider is openid connect relying party of the upstream provider,
+// metadata and keys are fetched on first use so the service starts while the provider is down.
+type provider struct {
+	cfg    ProviderConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	metadata    *providerMetadata
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+func newProvider(cfg ProviderConfig) *provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{ScopeOpenID, ScopeEmail, ScopeProfile}
+	}
+
+	if cfg.DisplayName == "" {
+		cfg.DisplayName = cfg.Name
+	}
+
+	return &provider{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: upstreamTimeout,
+		},
+	}
+}
+
+func (p *provider) getJSON(ctx context.Context, uri string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+
+	rsp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get %s: unexpected status %d", uri, rsp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(rsp.Body, maxUpstreamResponse)).Decode(v)
+}
+
+func (p *provider) discover(ctx context.Context) (*providerMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var m providerMetadata
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.cfg.Issuer, "/")+DiscoveryPath, &m); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+
+	if m.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovery: issuer mismatch: %q", m.Issuer)
+	}
+
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, errors.New("discovery: missing endpoints")
+	}
+
+	p.metadata = &m
+	return p.metadata, nil
+}
+
+// authURL returns url of the provider the user is redirected to.
+func (p *provider) authURL(ctx context.Context, redirectURI string, state string, nonce string, codeChallenge string) (string, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(m.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", codeChallengeMethodS256)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// exchange redeems authorization code and returns verified claims of the id token.
+func (p *provider) exchange(ctx context.Context, redirectURI string, code string, codeVerifier string, nonce string) (*upstreamClaims, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	rsp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request: %w", err)
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request: unexpected status %d", rsp.StatusCode)
+	}
+
+	var tokenRsp struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(rsp.Body, maxUpstreamResponse)).Decode(&tokenRsp); err != nil {
+		return nil, fmt.Errorf("token response: %w", err)
+	}
+
+	return p.verifyIDToken(ctx, tokenRsp.IDToken, nonce)
+}
+
+// verifyIDToken checks signature, issuer, audience, expiration and nonce of the id token.
+func (p *provider) verifyIDToken(ctx context.Context, idToken string, nonce string) (*upstreamClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	if !claims.VerifyIssuer(p.cfg.Issuer, true) {
+		return nil, errors.New("invalid id token: issuer mismatch")
+	}
+
+	if !claims.VerifyAudience(p.cfg.ClientID, true) {
+		return nil, errors.New("invalid id token: audience mismatch")
+	}
+
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("invalid id token: no expiration")
+	}
+
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, errors.New("invalid id token: nonce mismatch")
+	}
+
+	var c upstreamClaims
+	c.Subject, _ = claims["sub"].(string)
+	c.Email, _ = claims["email"].(string)
+	c.EmailVerified, _ = claims["email_verified"].(bool)
+	c.PreferredUsername, _ = claims["preferred_username"].(string)
+
+	if c.Subject == "" {
+		return nil, errors.New("invalid id token: no subject")
+	}
+
+	if len(c.Subject) > db.MaxIdentitySubjectLength {
+		return nil, errors.New("invalid id token: subject is too long")
+	}
+
+	// email that can't be stored is ignored, the user is linked and provisioned without it
+	if len(c.Email) > db.MaxEmailLength {
+		c.Email = ""
+		c.EmailVerified = false
+	}
+
+	return &c, nil
+}
+
+// key returns provider signing key by id, keys are refetched when the key is unknown.
+func (p *provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(p.keysFetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.metadata.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
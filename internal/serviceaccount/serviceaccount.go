@@ -0,0 +1,90 @@
+// Package serviceaccount creates accounts back-end services authenticate as, both the rpc handler and the cli use it.
+package serviceaccount
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/db"
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+)
+
+const (
+	idPrefix    = "svc_"
+	idBytes     = 8
+	secretBytes = 32
+	// MaxNameLength limits names of accounts, tokens are restricted to audiences of the same length.
+	MaxNameLength = 100
+)
+
+// scopes are api key scopes and the ones only back-end services can have.
+var scopes = map[string]bool{
+	token.ScopeStorageRead:  true,
+	token.ScopeStorageWrite: true,
+	token.ScopeAuditRead:    true,
+}
+
+// ParseScopes checks that scopes are supported by service accounts and removes duplicates.
+// It reports false if there is unsupported scope or no scope at all.
+func ParseScopes(requested []string) ([]string, bool) {
+	seen := make(map[string]bool, len(requested))
+	parsed := make([]string, 0, len(requested))
+	for _, s := range requested {
+		if !scopes[s] {
+			return nil, false
+		}
+
+		if !seen[s] {
+			seen[s] = true
+			parsed = append(parsed, s)
+		}
+	}
+	return parsed, len(parsed) > 0
+}
+
+// New returns account with random id ready to be stored.
+// The account authenticates by assertions verified with publicKeyPEM if it is set,
+// otherwise random secret is generated and returned, only its hash is kept by the account.
+func New(name string, requestedScopes []string, publicKeyPEM string) (*db.ServiceAccount, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > MaxNameLength {
+		return nil, "", errors.New("invalid name")
+	}
+
+	parsed, ok := ParseScopes(requestedScopes)
+	if !ok {
+		return nil, "", errors.New("invalid scopes")
+	}
+
+	id := make([]byte, idBytes)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+
+	a := db.ServiceAccount{
+		ID:     idPrefix + hex.EncodeToString(id),
+		Name:   name,
+		Scopes: parsed,
+	}
+
+	if publicKeyPEM != "" {
+		if _, err := jwt.ParseRSAPublicKeyFromPEM([]byte(publicKeyPEM)); err != nil {
+			return nil, "", fmt.Errorf("invalid public key: %w", err)
+		}
+		a.PublicKey = publicKeyPEM
+		return &a, "", nil
+	}
+
+	secret, err := shared.RandomString(secretBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	a.SecretHash = shared.HashSecret(secret)
+	return &a, secret, nil
+}
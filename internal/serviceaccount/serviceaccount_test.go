@@ -0,0 +1,46 @@
+package serviceaccount
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Mikhalevich/filesharing-auth-service/internal/shared"
+	"github.com/Mikhalevich/filesharing-auth-service/pkg/token"
+)
+
+func TestNew(t *testing.T) {
+	a, secret, err := New(" storage ", []string{token.ScopeStorageRead, token.ScopeAuditRead, token.ScopeStorageRead}, "")
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	if !strings.HasPrefix(a.ID, idPrefix) || a.Name != "storage" {
+		t.Errorf("account %+v", a)
+	}
+
+	if strings.Join(a.Scopes, " ") != token.ScopeStorageRead+" "+token.ScopeAuditRead {
+		t.Errorf("scopes %v, want duplicates removed", a.Scopes)
+	}
+
+	if secret == "" || a.SecretHash != shared.HashSecret(secret) || a.PublicKey != "" {
+		t.Errorf("secret %q does not match hash %q", secret, a.SecretHash)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		scopes []string
+		key    string
+	}{
+		{"", []string{token.ScopeStorageRead}, ""},
+		{strings.Repeat("n", MaxNameLength+1), []string{token.ScopeStorageRead}, ""},
+		{"storage", nil, ""},
+		{"storage", []string{"unknown"}, ""},
+		{"storage", []string{token.ScopeStorageRead}, "not a key"},
+	} {
+		if _, _, err := New(tc.name, tc.scopes, tc.key); err == nil {
+			t.Errorf("new %q %v %q: no error", tc.name, tc.scopes, tc.key)
+		}
+	}
+}
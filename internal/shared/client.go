@@ -0,0 +1,47 @@
+package shared
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/asim/go-micro/v3/metadata"
+)
+
+// Sizes of client info columns, client info is truncated to them as headers are set by the client.
+const (
+	MaxClientIPLength  = 64
+	MaxUserAgentLength = 256
+)
+
+// clientInfo returns client ip and user agent truncated to sizes of the columns they are stored in.
+func clientInfo(forwarded string, remote string, userAgent string) (string, string) {
+	return Truncate(clientIP(forwarded, remote), MaxClientIPLength), Truncate(userAgent, MaxUserAgentLength)
+}
+
+// clientIP returns the first address of X-Forwarded-For set by the gateway,
+// the host of the remote address of the connection otherwise.
+func clientIP(forwarded string, remote string) string {
+	if forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		return host
+	}
+	return remote
+}
+
+// ClientInfo returns client ip and user agent of the http request.
+func ClientInfo(r *http.Request) (string, string) {
+	return clientInfo(r.Header.Get("X-Forwarded-For"), r.RemoteAddr, r.UserAgent())
+}
+
+// ClientInfoFromContext returns client ip and user agent from rpc metadata.
+func ClientInfoFromContext(ctx context.Context) (string, string) {
+	forwarded, _ := metadata.Get(ctx, "X-Forwarded-For")
+	remote, _ := metadata.Get(ctx, "Remote")
+	userAgent, _ := metadata.Get(ctx, "User-Agent")
+	return clientInfo(forwarded, remote, userAgent)
+}
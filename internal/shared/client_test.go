@@ -0,0 +1,82 @@
+package shared
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/asim/go-micro/v3/metadata"
+)
+
+func TestClientInfo(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		forwarded string
+		remote    string
+		want      string
+	}{
+		{"forwarded", "203.0.113.7, 10.0.0.1", "10.0.0.1:5000", "203.0.113.7"},
+		{"remote", "", "198.51.100.2:5000", "198.51.100.2"},
+		{"remote without port", "", "198.51.100.2", "198.51.100.2"},
+		{"unknown", "", "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tc.remote
+			r.Header.Set("User-Agent", "test")
+			if tc.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tc.forwarded)
+			}
+
+			if ip, userAgent := ClientInfo(r); ip != tc.want || userAgent != "test" {
+				t.Errorf("http request: %q, %q, want %q, %q", ip, userAgent, tc.want, "test")
+			}
+
+			md := metadata.Metadata{"User-Agent": "test"}
+			if tc.forwarded != "" {
+				md["X-Forwarded-For"] = tc.forwarded
+			}
+			if tc.remote != "" {
+				md["Remote"] = tc.remote
+			}
+
+			if ip, userAgent := ClientInfoFromContext(metadata.NewContext(context.Background(), md)); ip != tc.want || userAgent != "test" {
+				t.Errorf("rpc metadata: %q, %q, want %q, %q", ip, userAgent, tc.want, "test")
+			}
+		})
+	}
+}
+
+func TestClientInfoTruncated(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Forwarded-For", strings.Repeat("1", MaxClientIPLength+10)+", 10.0.0.1")
+	r.Header.Set("User-Agent", strings.Repeat("ü", MaxUserAgentLength+10))
+
+	ip, userAgent := ClientInfo(r)
+	if ip != strings.Repeat("1", MaxClientIPLength) {
+		t.Errorf("ip %q is not truncated", ip)
+	}
+
+	if userAgent != strings.Repeat("ü", MaxUserAgentLength) {
+		t.Errorf("user agent %q is not truncated to %d characters", userAgent, MaxUserAgentLength)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"abc", 3, "abc"},
+		{"abcd", 3, "abc"},
+		{"äöüß", 2, "äö"},
+		{"ab\xffc", 3, "abc"},
+		{"", 0, ""},
+	} {
+		if got := Truncate(tc.s, tc.n); got != tc.want {
+			t.Errorf("truncate %q to %d: %q, want %q", tc.s, tc.n, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package shared
+
+import "strings"
+
+// Truncate returns s without invalid UTF-8 cut to at most n characters, so it can be stored in varchar(n) column.
+func Truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, "")
+	if len(s) <= n {
+		return s
+	}
+
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
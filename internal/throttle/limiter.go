@@ -0,0 +1,138 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultWindow is the period failures are counted within.
+const DefaultWindow = time.Minute * 15
+
+// maxEntries bounds keys failures are counted for, the oldest one is forgotten when a new key fails.
+const maxEntries = 10000
+
+type entry struct {
+	failures    int
+	windowStart time.Time
+}
+
+// Limiter locks keys out after repeated failures.
+// Failures are counted within the window started by the first one, the key is locked
+// for the rest of the window once maxFailures is reached.
+// Failures are kept in process, so every replica counts them on its own.
+type Limiter struct {
+	mu          sync.Mutex
+	maxFailures int
+	maxEntries  int
+	window      time.Duration
+	entries     map[string]*entry
+	lastSweep   time.Time
+}
+
+// Key returns key of attempts of the name from the client address,
+// so failures from one address don't lock the name out for clients at other addresses.
+func Key(clientIP string, name string) string {
+	return clientIP + " " + name
+}
+
+// NewLimiter returns limiter allowing maxFailures within the window, zero maxFailures disables locking.
+func NewLimiter(maxFailures int, window time.Duration) *Limiter {
+	return &Limiter{
+		maxFailures: maxFailures,
+		maxEntries:  maxEntries,
+		window:      window,
+		entries:     make(map[string]*entry),
+		lastSweep:   time.Now(),
+	}
+}
+
+// active returns entry of the key if its window isn't over yet.
+func (l *Limiter) active(key string, now time.Time) (*entry, bool) {
+	e, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if now.Sub(e.windowStart) >= l.window {
+		delete(l.entries, key)
+		return nil, false
+	}
+
+	return e, true
+}
+
+// Locked reports whether the key has reached the failures limit.
+func (l *Limiter) Locked(key string) bool {
+	if l.maxFailures <= 0 {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.active(key, time.Now())
+	return ok && e.failures >= l.maxFailures
+}
+
+// Fail records failure of the key.
+func (l *Limiter) Fail(key string) {
+	if l.maxFailures <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	if e, ok := l.active(key, now); ok {
+		e.failures++
+		return
+	}
+
+	if len(l.entries) >= l.maxEntries {
+		l.evictOldest()
+	}
+
+	l.entries[key] = &entry{
+		failures:    1,
+		windowStart: now,
+	}
+}
+
+// Reset forgets failures of the key after successful attempt.
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, key)
+}
+
+// sweep removes entries with windows over, so keys failed once don't pile up.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	l.lastSweep = now
+
+	for key, e := range l.entries {
+		if now.Sub(e.windowStart) >= l.window {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// evictOldest removes entry with the earliest window, so the map doesn't grow with keys of distinct failures.
+func (l *Limiter) evictOldest() {
+	var (
+		oldestKey string
+		oldest    *entry
+	)
+	for key, e := range l.entries {
+		if oldest == nil || e.windowStart.Before(oldest.windowStart) {
+			oldestKey, oldest = key, e
+		}
+	}
+	delete(l.entries, oldestKey)
+}
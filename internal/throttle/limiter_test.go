@@ -0,0 +1,87 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterLocksAfterMaxFailures(t *testing.T) {
+	l := NewLimiter(3, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		l.Fail("alice")
+	}
+
+	if l.Locked("alice") {
+		t.Fatal("alice is locked before max failures")
+	}
+
+	l.Fail("alice")
+	if !l.Locked("alice") {
+		t.Fatal("alice is not locked after max failures")
+	}
+
+	if l.Locked("bob") {
+		t.Error("bob is locked by failures of alice")
+	}
+
+	l.Reset("alice")
+	if l.Locked("alice") {
+		t.Error("alice is locked after reset")
+	}
+}
+
+func TestLimiterWindow(t *testing.T) {
+	l := NewLimiter(1, time.Millisecond*10)
+
+	l.Fail("alice")
+	l.Fail("carol")
+	if !l.Locked("alice") {
+		t.Fatal("alice is not locked")
+	}
+
+	time.Sleep(time.Millisecond * 20)
+	if l.Locked("alice") {
+		t.Error("alice is locked after the window")
+	}
+
+	// failure after the window triggers the sweep of expired entries
+	l.Fail("bob")
+	if _, ok := l.entries["carol"]; ok {
+		t.Error("expired entry of carol is kept")
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	l := NewLimiter(0, time.Minute)
+
+	for i := 0; i < 10; i++ {
+		l.Fail("alice")
+	}
+
+	if l.Locked("alice") {
+		t.Error("alice is locked by disabled limiter")
+	}
+}
+
+func TestLimiterBoundsEntries(t *testing.T) {
+	l := NewLimiter(1, time.Minute)
+	l.maxEntries = 2
+
+	l.Fail("alice")
+	time.Sleep(time.Millisecond)
+	l.Fail("bob")
+	l.Fail("carol")
+
+	if len(l.entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(l.entries))
+	}
+
+	if l.Locked("alice") {
+		t.Error("the oldest entry of alice is kept")
+	}
+
+	if !l.Locked("bob") || !l.Locked("carol") {
+		t.Error("recent entries are evicted")
+	}
+}
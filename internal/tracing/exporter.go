@@ -0,0 +1,143 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Exporter sends finished spans to the tracing backend.
+type Exporter interface {
+	Export(s *Span) error
+	Close() error
+}
+
+// Config describes exporter in the service config.
+type Config struct {
+	// Exporter is one of none (default), stdout or file.
+	Exporter string `yaml:"exporter"`
+	// File is the path spans are appended to by the file exporter.
+	File string `yaml:"file"`
+}
+
+// NewExporter creates exporter described by cfg, nil exporter is returned if tracing is disabled.
+func NewExporter(cfg Config) (Exporter, error) {
+	switch cfg.Exporter {
+	case "", "none":
+		return nil, nil
+	case "stdout":
+		return NewWriterExporter(nopCloser{os.Stdout}), nil
+	case "file":
+		if cfg.File == "" {
+			return nil, fmt.Errorf("file is not set for file exporter")
+		}
+
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open spans file: %w", err)
+		}
+		return NewWriterExporter(f), nil
+	}
+
+	return nil, fmt.Errorf("unsupported exporter: %s", cfg.Exporter)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+type jsonSpan struct {
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_id,omitempty"`
+	Name       string            `json:"name"`
+	Start      time.Time         `json:"start"`
+	DurationMs float64           `json:"duration_ms"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// WriterExporter writes spans as json lines.
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.WriteCloser
+}
+
+func NewWriterExporter(w io.WriteCloser) *WriterExporter {
+	return &WriterExporter{
+		w: w,
+	}
+}
+
+func (we *WriterExporter) Export(s *Span) error {
+	js := jsonSpan{
+		TraceID:    s.Context.TraceID.String(),
+		SpanID:     s.Context.SpanID.String(),
+		Name:       s.Name,
+		Start:      s.Start,
+		DurationMs: float64(s.End.Sub(s.Start)) / float64(time.Millisecond),
+		Attributes: s.Attributes,
+	}
+
+	if s.ParentID.IsValid() {
+		js.ParentID = s.ParentID.String()
+	}
+
+	if s.Err != nil {
+		js.Error = s.Err.Error()
+	}
+
+	b, err := json.Marshal(js)
+	if err != nil {
+		return err
+	}
+
+	we.mu.Lock()
+	defer we.mu.Unlock()
+
+	_, err = we.w.Write(append(b, '\n'))
+	return err
+}
+
+func (we *WriterExporter) Close() error {
+	we.mu.Lock()
+	defer we.mu.Unlock()
+
+	return we.w.Close()
+}
+
+var (
+	exporterMu sync.RWMutex
+	exporter   Exporter
+)
+
+// SetExporter sets exporter for all spans, nil disables tracing.
+func SetExporter(e Exporter) {
+	exporterMu.Lock()
+	exporter = e
+	exporterMu.Unlock()
+}
+
+func enabled() bool {
+	exporterMu.RLock()
+	defer exporterMu.RUnlock()
+
+	return exporter != nil
+}
+
+func export(s *Span) {
+	exporterMu.RLock()
+	e := exporter
+	exporterMu.RUnlock()
+
+	if e != nil {
+		e.Export(s)
+	}
+}
@@ -0,0 +1,145 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// TraceID identifies the whole trace across services.
+type TraceID [16]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid reports whether trace id is not zero.
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// SpanID identifies single span within the trace.
+type SpanID [8]byte
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid reports whether span id is not zero.
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// SpanContext is the part of the span propagated to child spans and other services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+}
+
+// IsValid reports whether both trace and span ids are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Span is a single timed operation.
+type Span struct {
+	Name       string
+	Context    SpanContext
+	ParentID   SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Err        error
+
+	mu    sync.Mutex
+	ended bool
+}
+
+// SetAttribute attaches key/value to the span, values must not contain user data.
+func (s *Span) SetAttribute(key string, value string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.Err = err
+	s.mu.Unlock()
+}
+
+// Finish ends the span and passes it to the exporter, subsequent calls are ignored.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	export(s)
+}
+
+type spanKey struct{}
+
+// FromContext returns the current span, nil if there is no one.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+type remoteKey struct{}
+
+// WithRemoteParent sets span context received from other service as parent of the next started span.
+func WithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// StartSpan starts span as a child of the span from ctx (or of the remote parent),
+// new trace is started if there is no parent.
+// Spans are not created if no exporter is set, the returned nil span is safe to use.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	if !enabled() {
+		return ctx, nil
+	}
+
+	s := Span{
+		Name:  name,
+		Start: time.Now(),
+	}
+
+	if parent := FromContext(ctx); parent != nil {
+		s.Context.TraceID = parent.Context.TraceID
+		s.ParentID = parent.Context.SpanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok && remote.IsValid() {
+		s.Context.TraceID = remote.TraceID
+		s.ParentID = remote.SpanID
+	} else {
+		rand.Read(s.Context.TraceID[:])
+	}
+
+	rand.Read(s.Context.SpanID[:])
+
+	return context.WithValue(ctx, spanKey{}, &s), &s
+}
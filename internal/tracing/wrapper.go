@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/asim/go-micro/v3/metadata"
+	"github.com/asim/go-micro/v3/server"
+)
+
+// traceparentKey is the metadata key of w3c trace context.
+const traceparentKey = "traceparent"
+
+// ParseTraceparent parses w3c traceparent value: version-traceid-spanid-flags.
+func ParseTraceparent(value string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[3]) != 2 {
+		return SpanContext{}, fmt.Errorf("invalid traceparent format")
+	}
+
+	var sc SpanContext
+	if err := decodeHex(parts[1], sc.TraceID[:]); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid trace id: %w", err)
+	}
+
+	if err := decodeHex(parts[2], sc.SpanID[:]); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid span id: %w", err)
+	}
+
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("zero trace or span id")
+	}
+
+	return sc, nil
+}
+
+func decodeHex(s string, dst []byte) error {
+	if len(s) != hex.EncodedLen(len(dst)) {
+		return fmt.Errorf("invalid length %d", len(s))
+	}
+
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+// FormatTraceparent formats span context as w3c traceparent value.
+func FormatTraceparent(sc SpanContext) string {
+	return fmt.Sprintf("00-%s-%s-01", sc.TraceID, sc.SpanID)
+}
+
+// Inject adds the current span context to outgoing go-micro metadata.
+func Inject(ctx context.Context) context.Context {
+	s := FromContext(ctx)
+	if s == nil {
+		return ctx
+	}
+
+	return metadata.Set(ctx, traceparentKey, FormatTraceparent(s.Context))
+}
+
+// Extract returns context with parent span context received in incoming go-micro metadata.
+func Extract(ctx context.Context) context.Context {
+	value, ok := metadata.Get(ctx, traceparentKey)
+	if !ok {
+		return ctx
+	}
+
+	sc, err := ParseTraceparent(value)
+	if err != nil {
+		return ctx
+	}
+
+	return WithRemoteParent(ctx, sc)
+}
+
+// HandlerWrapper starts span for every rpc call continuing trace from the incoming metadata.
+func HandlerWrapper() server.HandlerWrapper {
+	return func(fn server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, rsp interface{}) error {
+			ctx, span := StartSpan(Extract(ctx), req.Method())
+			defer span.Finish()
+
+			span.SetAttribute("rpc.service", req.Service())
+			span.SetAttribute("rpc.method", req.Method())
+
+			err := fn(ctx, req, rsp)
+			span.SetError(err)
+			return err
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/asim/go-micro/v3/metadata"
+	"github.com/asim/go-micro/v3/server"
+)
+
+// recordingExporter keeps exported spans.
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *recordingExporter) Export(s *Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.spans = append(e.spans, s)
+	return nil
+}
+
+func (e *recordingExporter) Close() error {
+	return nil
+}
+
+// record sets recording exporter for the test.
+func record(t *testing.T) *recordingExporter {
+	t.Helper()
+
+	e := &recordingExporter{}
+	SetExporter(e)
+	t.Cleanup(func() {
+		SetExporter(nil)
+	})
+	return e
+}
+
+type testRequest struct {
+	server.Request
+}
+
+func (testRequest) Service() string {
+	return "auth"
+}
+
+func (testRequest) Method() string {
+	return "Auth.Token"
+}
+
+func TestParseTraceparent(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		valid bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{" 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00 ", true},
+		{"", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false},
+		{"000-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b-01", false},
+		{"00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+	} {
+		sc, err := ParseTraceparent(tc.value)
+		if tc.valid != (err == nil) {
+			t.Errorf("parse %q: %v, want valid %v", tc.value, err, tc.valid)
+			continue
+		}
+
+		if tc.valid && (sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7") {
+			t.Errorf("parse %q: %s-%s", tc.value, sc.TraceID, sc.SpanID)
+		}
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	record(t)
+
+	ctx, span := StartSpan(context.Background(), "outgoing")
+	defer span.Finish()
+
+	value, ok := metadata.Get(Inject(ctx), traceparentKey)
+	if !ok {
+		t.Fatal("traceparent isn't injected")
+	}
+
+	sc, err := ParseTraceparent(value)
+	if err != nil {
+		t.Fatalf("parse injected traceparent: %v", err)
+	}
+
+	if sc != span.Context {
+		t.Errorf("span context %+v, want %+v", sc, span.Context)
+	}
+}
+
+func TestHandlerWrapperContinuesTrace(t *testing.T) {
+	e := record(t)
+
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := metadata.Set(context.Background(), traceparentKey, parent)
+
+	errFailed := errors.New("failed")
+	var child *Span
+	handler := HandlerWrapper()(func(ctx context.Context, req server.Request, rsp interface{}) error {
+		_, child = StartSpan(ctx, "sql.query")
+		child.Finish()
+		return errFailed
+	})
+
+	if err := handler(ctx, testRequest{}, nil); !errors.Is(err, errFailed) {
+		t.Fatalf("handler: %v, want %v", err, errFailed)
+	}
+
+	if len(e.spans) != 2 {
+		t.Fatalf("%d spans exported, want 2", len(e.spans))
+	}
+
+	rpc := e.spans[1]
+	if rpc.Name != "Auth.Token" || rpc.Attributes["rpc.service"] != "auth" || !errors.Is(rpc.Err, errFailed) {
+		t.Errorf("rpc span %+v", rpc)
+	}
+
+	if rpc.Context.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || rpc.ParentID.String() != "00f067aa0ba902b7" {
+		t.Errorf("rpc span trace %s parent %s, want the incoming traceparent", rpc.Context.TraceID, rpc.ParentID)
+	}
+
+	if child.Context.TraceID != rpc.Context.TraceID || child.ParentID != rpc.Context.SpanID {
+		t.Errorf("child span trace %s parent %s, want rpc span %s", child.Context.TraceID, child.ParentID, rpc.Context.SpanID)
+	}
+}
+
+func TestHandlerWrapperIgnoresInvalidTraceparent(t *testing.T) {
+	e := record(t)
+
+	ctx := metadata.Set(context.Background(), traceparentKey, "garbage")
+	handler := HandlerWrapper()(func(ctx context.Context, req server.Request, rsp interface{}) error {
+		return nil
+	})
+
+	if err := handler(ctx, testRequest{}, nil); err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+
+	if len(e.spans) != 1 || !e.spans[0].Context.IsValid() || e.spans[0].ParentID.IsValid() {
+		t.Errorf("spans %+v, want single root span of new trace", e.spans)
+	}
+}
+
+func TestSpansDisabledWithoutExporter(t *testing.T) {
+	ctx, span := StartSpan(context.Background(), "noop")
+	if span != nil || FromContext(ctx) != nil {
+		t.Fatal("span is started without exporter")
+	}
+
+	// nil span is safe to use
+	span.SetAttribute("key", "value")
+	span.SetError(errors.New("failed"))
+	span.Finish()
+}
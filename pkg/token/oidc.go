@@ -0,0 +1,71 @@
+package token
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// IDTokenClaims are the claims of openid connect id token.
+// Issuer, Subject and Audience are set by the caller, expiration and issue time by the encoder.
+type IDTokenClaims struct {
+	Nonce         string `json:"nonce,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	jwt.StandardClaims
+}
+
+type IDTokenEncoder interface {
+	EncodeIDToken(claims IDTokenClaims) (string, error)
+	JWK() JWK
+}
+
+// JWK is the public part of the signing key in json web key format, see RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func newJWK(key *rsa.PublicKey) JWK {
+	jwk := JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: jwt.SigningMethodRS256.Alg(),
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+
+	// key id is the key thumbprint, see RFC 7638
+	thumbprint := sha256.Sum256([]byte(`{"e":"` + jwk.E + `","kty":"RSA","n":"` + jwk.N + `"}`))
+	jwk.Kid = base64.RawURLEncoding.EncodeToString(thumbprint[:])
+	return jwk
+}
+
+// JWK returns public signing key, tokens are signed with the key id in header.
+func (re *RSAEncoder) JWK() JWK {
+	return re.jwk
+}
+
+// EncodeIDToken signs id token valid for the token expiration period.
+// Issuer must be the provider url, Decode tells id tokens from access tokens by it.
+func (re *RSAEncoder) EncodeIDToken(claims IDTokenClaims) (string, error) {
+	if claims.Issuer == "" || claims.Issuer == Issuer || claims.Audience == "" {
+		return "", errors.New("id token requires provider issuer and client audience")
+	}
+
+	now := time.Now()
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(re.expirationPeriod).Unix()
+
+	return re.sign(IDTokenType, claims)
+}
@@ -1,12 +1,18 @@
 package token
 
 import (
+	"crypto"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt"
@@ -20,15 +26,54 @@ var (
 	privatePEMData []byte
 )
 
+const tokenIDBytes = 16
+
+// MaxClockSkew bounds the clock skew decoders can tolerate.
+const MaxClockSkew = time.Minute * 5
+
+// Types of tokens in typ header. Access tokens are typed as in RFC 9068,
+// id tokens signed with the same key keep plain type openid connect clients expect.
+const (
+	AccessTokenType = "at+jwt"
+	IDTokenType     = "JWT"
+)
+
 type RSADecoder struct {
-	key *rsa.PublicKey
+	key       *rsa.PublicKey
+	audience  string
+	issuer    string
+	clockSkew time.Duration
+}
+
+// DecoderOption sets additional checks of decoded tokens.
+type DecoderOption func(rd *RSADecoder)
+
+// WithRequiredAudience makes decoder accept only tokens intended for the audience.
+func WithRequiredAudience(audience string) DecoderOption {
+	return func(rd *RSADecoder) {
+		rd.audience = audience
+	}
 }
 
-func NewRSADecoder() (*RSADecoder, error) {
-	return NewRSADecoderWithPublicKey(publicPEMData)
+// WithRequiredIssuer makes decoder accept only tokens of the issuer, usually Issuer.
+func WithRequiredIssuer(issuer string) DecoderOption {
+	return func(rd *RSADecoder) {
+		rd.issuer = issuer
+	}
+}
+
+// WithClockSkew tolerates clock difference with the encoder when exp, nbf and iat are checked, up to MaxClockSkew.
+func WithClockSkew(skew time.Duration) DecoderOption {
+	return func(rd *RSADecoder) {
+		rd.clockSkew = skew
+	}
 }
 
-func NewRSADecoderWithPublicKey(pubPEMData []byte) (*RSADecoder, error) {
+func NewRSADecoder(opts ...DecoderOption) (*RSADecoder, error) {
+	return NewRSADecoderWithPublicKey(publicPEMData, opts...)
+}
+
+func NewRSADecoderWithPublicKey(pubPEMData []byte, opts ...DecoderOption) (*RSADecoder, error) {
 	block, _ := pem.Decode(pubPEMData)
 	if block == nil {
 		return nil, errors.New("failed to decode PEM block containing rsa public key")
@@ -44,13 +89,30 @@ func NewRSADecoderWithPublicKey(pubPEMData []byte) (*RSADecoder, error) {
 		return nil, fmt.Errorf("not a public key: %v", key)
 	}
 
-	return &RSADecoder{
+	rd := RSADecoder{
 		key: pub,
-	}, nil
+	}
+
+	for _, opt := range opts {
+		opt(&rd)
+	}
+
+	if rd.clockSkew < 0 || rd.clockSkew > MaxClockSkew {
+		return nil, fmt.Errorf("invalid clock skew: %v", rd.clockSkew)
+	}
+
+	return &rd, nil
 }
 
+// Decode verifies token signature and time claims of the access token, audience and issuer are checked if they are required.
+// Id tokens are rejected.
 func (rd *RSADecoder) Decode(tokenString string) (*CustomClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
+	// time claims are validated below with clock skew
+	parser := jwt.Parser{
+		SkipClaimsValidation: true,
+	}
+
+	token, err := parser.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
@@ -70,19 +132,84 @@ func (rd *RSADecoder) Decode(tokenString string) (*CustomClaims, error) {
 		return nil, errors.New("invalid token: unable to parse custom claims")
 	}
 
+	typ, _ := token.Header["typ"].(string)
+	if err := rd.validate(typ, claims); err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
 	return claims, nil
 }
 
+func (rd *RSADecoder) validate(typ string, claims *CustomClaims) error {
+	switch typ {
+	case AccessTokenType:
+	case "", IDTokenType:
+		// access tokens issued before they were typed are told from id tokens by the issuer,
+		// id tokens are issued by the openid connect provider url
+		if claims.Issuer != Issuer {
+			return errors.New("not an access token")
+		}
+	default:
+		return fmt.Errorf("unexpected token type %q", typ)
+	}
+
+	now := time.Now()
+	if !claims.VerifyExpiresAt(now.Add(-rd.clockSkew).Unix(), false) {
+		return errors.New("token is expired")
+	}
+
+	if !claims.VerifyNotBefore(now.Add(rd.clockSkew).Unix(), false) {
+		return errors.New("token is not valid yet")
+	}
+
+	if !claims.VerifyIssuedAt(now.Add(rd.clockSkew).Unix(), false) {
+		return errors.New("token used before issued")
+	}
+
+	if rd.audience != "" && !claims.VerifyAudience(rd.audience, true) {
+		return errors.New("audience mismatch")
+	}
+
+	if rd.issuer != "" && !claims.VerifyIssuer(rd.issuer, true) {
+		return errors.New("issuer mismatch")
+	}
+
+	return nil
+}
+
+// Verify checks base64 encoded RS256 signature of data made by RSAEncoder.Sign.
+func (rd *RSADecoder) Verify(data []byte, signature string) error {
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("unable to decode signature: %w", err)
+	}
+
+	hash := sha256.Sum256(data)
+	return rsa.VerifyPKCS1v15(rd.key, crypto.SHA256, hash[:], sig)
+}
+
 type RSAEncoder struct {
 	key              *rsa.PrivateKey
+	jwk              JWK
 	expirationPeriod time.Duration
+	audience         string
+}
+
+// EncoderOption configures encoder.
+type EncoderOption func(re *RSAEncoder)
+
+// WithDefaultAudience sets audience of tokens encoded without WithAudience.
+func WithDefaultAudience(audience string) EncoderOption {
+	return func(re *RSAEncoder) {
+		re.audience = audience
+	}
 }
 
-func NewRSAEncoder(ep time.Duration) (*RSAEncoder, error) {
-	return NewRSAEncoderWithPrivateKey(privatePEMData, ep)
+func NewRSAEncoder(ep time.Duration, opts ...EncoderOption) (*RSAEncoder, error) {
+	return NewRSAEncoderWithPrivateKey(privatePEMData, ep, opts...)
 }
 
-func NewRSAEncoderWithPrivateKey(priPEMData []byte, ep time.Duration) (*RSAEncoder, error) {
+func NewRSAEncoderWithPrivateKey(priPEMData []byte, ep time.Duration, opts ...EncoderOption) (*RSAEncoder, error) {
 	block, _ := pem.Decode(priPEMData)
 	if block == nil {
 		return nil, errors.New("failed to decode PEM block containing rsa private key")
@@ -98,25 +225,67 @@ func NewRSAEncoderWithPrivateKey(priPEMData []byte, ep time.Duration) (*RSAEncod
 		return nil, fmt.Errorf("not a rsa private key: %v", key)
 	}
 
-	return &RSAEncoder{
+	re := RSAEncoder{
 		key:              pri,
+		jwk:              newJWK(&pri.PublicKey),
 		expirationPeriod: ep,
-	}, nil
+	}
+
+	for _, opt := range opts {
+		opt(&re)
+	}
+
+	return &re, nil
 }
 
-// Encode a user object into a JWT string
-func (re *RSAEncoder) Encode(user User) (string, error) {
-	expirationTime := time.Now().Add(re.expirationPeriod).Unix()
+// Encode a user object into a JWT string.
+// Subject is the user id or the service account id, every token has unique id.
+func (re *RSAEncoder) Encode(user User, opts ...EncodeOption) (string, error) {
+	id := make([]byte, tokenIDBytes)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("unable to generate token id: %w", err)
+	}
 
+	now := time.Now()
 	claims := CustomClaims{
-		user,
-		jwt.StandardClaims{
-			ExpiresAt: expirationTime,
-			Issuer:    "filesharing.auth.service",
+		User: user,
+		StandardClaims: jwt.StandardClaims{
+			Id:        hex.EncodeToString(id),
+			Audience:  re.audience,
+			ExpiresAt: now.Add(re.expirationPeriod).Unix(),
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			Issuer:    Issuer,
+			Subject:   strconv.FormatInt(user.ID, 10),
 		},
 	}
 
+	for _, opt := range opts {
+		opt(&claims)
+	}
+
+	if claims.Service != nil {
+		claims.Subject = claims.Service.ID
+	}
+
+	return re.sign(AccessTokenType, claims)
+}
+
+func (re *RSAEncoder) sign(typ string, claims jwt.Claims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["typ"] = typ
+	token.Header["kid"] = re.jwk.Kid
 
 	return token.SignedString(re.key)
 }
+
+// Sign returns base64 encoded RS256 signature of data made with the token signing key.
+func (re *RSAEncoder) Sign(data []byte) (string, error) {
+	hash := sha256.Sum256(data)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, re.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(sig), nil
+}
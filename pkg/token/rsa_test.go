@@ -0,0 +1,233 @@
+package token
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func newTestCodec(t *testing.T) (*RSAEncoder, *RSADecoder) {
+	t.Helper()
+
+	encoder, err := NewRSAEncoder(time.Minute)
+	if err != nil {
+		t.Fatalf("create encoder: %v", err)
+	}
+
+	decoder, err := NewRSADecoder()
+	if err != nil {
+		t.Fatalf("create decoder: %v", err)
+	}
+	return encoder, decoder
+}
+
+func TestDecodeAccessToken(t *testing.T) {
+	encoder, decoder := newTestCodec(t)
+
+	tokenString, err := encoder.Encode(User{ID: 7, Name: "alice"}, WithSessionID("session"))
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	claims, err := decoder.Decode(tokenString)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if claims.User.ID != 7 || claims.SessionID != "session" {
+		t.Errorf("claims %+v, want user 7 of session", claims)
+	}
+}
+
+func TestDecodeUntypedAccessToken(t *testing.T) {
+	encoder, decoder := newTestCodec(t)
+
+	// access tokens issued before they were typed
+	now := time.Now()
+	tokenString, err := encoder.sign(IDTokenType, CustomClaims{
+		User: User{ID: 7, Name: "alice"},
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: now.Add(time.Minute).Unix(),
+			IssuedAt:  now.Unix(),
+			Issuer:    Issuer,
+			Subject:   strconv.Itoa(7),
+		},
+	})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if _, err := decoder.Decode(tokenString); err != nil {
+		t.Errorf("decode: %v", err)
+	}
+}
+
+func TestDecodeRejectsIDToken(t *testing.T) {
+	encoder, decoder := newTestCodec(t)
+
+	claims := IDTokenClaims{
+		Nonce: "nonce",
+		Name:  "alice",
+	}
+	claims.Issuer = "https://auth.example.com"
+	claims.Subject = "7"
+	claims.Audience = "client"
+
+	idToken, err := encoder.EncodeIDToken(claims)
+	if err != nil {
+		t.Fatalf("encode id token: %v", err)
+	}
+
+	if _, err := decoder.Decode(idToken); err == nil {
+		t.Error("id token is decoded as access token")
+	}
+
+	claims.Issuer = Issuer
+	if _, err := encoder.EncodeIDToken(claims); err == nil {
+		t.Error("id token is encoded with access token issuer")
+	}
+}
+
+func TestDecodeRejectsUnknownType(t *testing.T) {
+	encoder, decoder := newTestCodec(t)
+
+	now := time.Now()
+	tokenString, err := encoder.sign("logout+jwt", CustomClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: now.Add(time.Minute).Unix(),
+			Issuer:    Issuer,
+		},
+	})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if _, err := decoder.Decode(tokenString); err == nil {
+		t.Error("token of unknown type is decoded")
+	}
+}
+
+func TestDecodeAudienceAndIssuer(t *testing.T) {
+	encoder, _ := newTestCodec(t)
+
+	decoder, err := NewRSADecoder(WithRequiredAudience("storage"), WithRequiredIssuer(Issuer))
+	if err != nil {
+		t.Fatalf("create decoder: %v", err)
+	}
+
+	now := time.Now()
+	for _, tc := range []struct {
+		name     string
+		audience string
+		issuer   string
+		valid    bool
+	}{
+		{"matching", "storage", Issuer, true},
+		{"missing audience", "", Issuer, false},
+		{"other audience", "billing", Issuer, false},
+		{"missing issuer", "storage", "", false},
+		{"other issuer", "storage", "other.auth.service", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tokenString, err := encoder.sign(AccessTokenType, CustomClaims{
+				StandardClaims: jwt.StandardClaims{
+					Audience:  tc.audience,
+					Issuer:    tc.issuer,
+					ExpiresAt: now.Add(time.Minute).Unix(),
+				},
+			})
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+
+			if _, err := decoder.Decode(tokenString); (err == nil) != tc.valid {
+				t.Errorf("decode: %v, want valid %v", err, tc.valid)
+			}
+		})
+	}
+}
+
+func TestDecodeClockSkew(t *testing.T) {
+	encoder, _ := newTestCodec(t)
+
+	decoder, err := NewRSADecoder(WithClockSkew(time.Minute))
+	if err != nil {
+		t.Fatalf("create decoder: %v", err)
+	}
+
+	now := time.Now()
+	for _, tc := range []struct {
+		name   string
+		claims jwt.StandardClaims
+		valid  bool
+	}{
+		{"expired within skew", jwt.StandardClaims{ExpiresAt: now.Add(-time.Second * 30).Unix()}, true},
+		{"expired beyond skew", jwt.StandardClaims{ExpiresAt: now.Add(-time.Minute * 2).Unix()}, false},
+		{"not before within skew", jwt.StandardClaims{NotBefore: now.Add(time.Second * 30).Unix()}, true},
+		{"not before beyond skew", jwt.StandardClaims{NotBefore: now.Add(time.Minute * 2).Unix()}, false},
+		{"issued within skew", jwt.StandardClaims{IssuedAt: now.Add(time.Second * 30).Unix()}, true},
+		{"issued beyond skew", jwt.StandardClaims{IssuedAt: now.Add(time.Minute * 2).Unix()}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.claims.Issuer = Issuer
+			tokenString, err := encoder.sign(AccessTokenType, CustomClaims{StandardClaims: tc.claims})
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+
+			if _, err := decoder.Decode(tokenString); (err == nil) != tc.valid {
+				t.Errorf("decode: %v, want valid %v", err, tc.valid)
+			}
+		})
+	}
+}
+
+func TestNewRSADecoderClockSkew(t *testing.T) {
+	for _, skew := range []time.Duration{-time.Second, MaxClockSkew + time.Second} {
+		if _, err := NewRSADecoder(WithClockSkew(skew)); err == nil {
+			t.Errorf("decoder with clock skew %v is created", skew)
+		}
+	}
+
+	for _, skew := range []time.Duration{0, MaxClockSkew} {
+		if _, err := NewRSADecoder(WithClockSkew(skew)); err != nil {
+			t.Errorf("create decoder with clock skew %v: %v", skew, err)
+		}
+	}
+}
+
+func TestEncodeAudience(t *testing.T) {
+	_, decoder := newTestCodec(t)
+
+	encoder, err := NewRSAEncoder(time.Minute, WithDefaultAudience("gateway"))
+	if err != nil {
+		t.Fatalf("create encoder: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []EncodeOption
+		want string
+	}{
+		{"default", nil, "gateway"},
+		{"explicit", []EncodeOption{WithAudience("storage")}, "storage"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tokenString, err := encoder.Encode(User{ID: 7}, tc.opts...)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+
+			claims, err := decoder.Decode(tokenString)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+
+			if claims.Audience != tc.want {
+				t.Errorf("audience %q, want %q", claims.Audience, tc.want)
+			}
+		})
+	}
+}
@@ -3,27 +3,134 @@ package token
 import (
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/golang-jwt/jwt"
 )
 
+// Scopes of storage access tokens can be limited to.
+const (
+	ScopeStorageRead  = "storage:read"
+	ScopeStorageWrite = "storage:write"
+)
+
+// ScopeAuditRead allows service accounts to list audit events of all users.
+const ScopeAuditRead = "audit:read"
+
+// Issuer is the iss claim of tokens, assertions of service accounts are addressed to it.
+const Issuer = "filesharing.auth.service"
+
 type User struct {
 	ID     int64  `json:"id"`
 	Name   string `json:"name"`
 	Public bool   `json:"public"`
 }
 
+// Service is the service account, a principal of back-end service rather than human user.
+type Service struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Actor is the service acting on behalf of the token user, see RFC 8693 section 4.1.
+// Actor of the actor is the previous service in the delegation chain.
+type Actor struct {
+	Subject string `json:"sub"`
+	Actor   *Actor `json:"act,omitempty"`
+}
+
 type CustomClaims struct {
 	User User `json:"user"`
+	// SessionID ties token to the login session, empty for tokens not bound to a session.
+	SessionID string `json:"sid,omitempty"`
+	// Scope is space separated list of scopes granted to the oauth client, empty for first-party tokens.
+	Scope string `json:"scope,omitempty"`
+	// ClientID is the oauth client the token is issued to.
+	ClientID string `json:"client_id,omitempty"`
+	// APIKeyID is the personal access token the token is exchanged for.
+	APIKeyID string `json:"api_key,omitempty"`
+	// Service is set for tokens of service accounts, User is empty for them.
+	Service *Service `json:"service,omitempty"`
+	// Actor is set for tokens exchanged by services calling other services on behalf of the user.
+	Actor *Actor `json:"act,omitempty"`
 	jwt.StandardClaims
 }
 
+// IsService reports whether the token is issued to the service account rather than the user.
+func (c *CustomClaims) IsService() bool {
+	return c.Service != nil
+}
+
+// EncodeOption sets additional claims of the encoded token.
+type EncodeOption func(c *CustomClaims)
+
+// WithSessionID binds token to the login session.
+func WithSessionID(id string) EncodeOption {
+	return func(c *CustomClaims) {
+		c.SessionID = id
+	}
+}
+
+// WithScope limits token to the scopes granted to the oauth client.
+func WithScope(clientID string, scope string) EncodeOption {
+	return func(c *CustomClaims) {
+		c.ClientID = clientID
+		c.Scope = scope
+	}
+}
+
+// WithAPIKey limits token to the scopes of the personal access token it is exchanged for.
+func WithAPIKey(id string, scope string) EncodeOption {
+	return func(c *CustomClaims) {
+		c.APIKeyID = id
+		c.Scope = scope
+	}
+}
+
+// WithService issues token to the service account limited to the scope.
+func WithService(s Service, scope string) EncodeOption {
+	return func(c *CustomClaims) {
+		c.Service = &s
+		c.Scope = scope
+	}
+}
+
+// WithActor delegates token of the user to the actor limited to the scope.
+func WithActor(a Actor, scope string) EncodeOption {
+	return func(c *CustomClaims) {
+		c.Actor = &a
+		c.Scope = scope
+	}
+}
+
+// WithAudience restricts token to the service it is intended for.
+func WithAudience(audience string) EncodeOption {
+	return func(c *CustomClaims) {
+		c.Audience = audience
+	}
+}
+
+// WithExpiresAt sets token expiration time instead of the encoder expiration period.
+func WithExpiresAt(t time.Time) EncodeOption {
+	return func(c *CustomClaims) {
+		c.ExpiresAt = t.Unix()
+	}
+}
+
 type Decoder interface {
 	Decode(tokenString string) (*CustomClaims, error)
 }
 
 type Encoder interface {
-	Encode(user User) (string, error)
+	Encode(user User, opts ...EncodeOption) (string, error)
+}
+
+type Signer interface {
+	Sign(data []byte) (string, error)
+}
+
+type Verifier interface {
+	Verify(data []byte, signature string) error
 }
 
 func LoadCertFromFile(fileName string) ([]byte, error) {